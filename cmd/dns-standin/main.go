@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/nikhil/url-shortner-backend/pkg/dnsstandin"
+)
+
+// A local DNS server: point DNS_RESOLVER_ADDR at it and publish verification records with
+// PUT http://localhost:8053/records?name=<name>&value=<value>
+func main() {
+	dnsAddr := flag.String("dns-addr", "localhost:5353", "address to answer DNS queries on, over UDP")
+	httpAddr := flag.String("http-addr", "localhost:8053", "address to manage records on")
+	flag.Parse()
+
+	server := dnsstandin.NewServer()
+	conn, err := net.ListenPacket("udp", *dnsAddr)
+	if err != nil {
+		log.Fatalf("DNS stand-in can't listen: %v", err)
+	}
+	go func() {
+		if err := server.ServeUDP(conn); err != nil {
+			log.Fatalf("DNS stand-in stopped: %v", err)
+		}
+	}()
+
+	log.Printf("DNS stand-in listening on %s, records on http://%s/records", *dnsAddr, *httpAddr)
+	if err := http.ListenAndServe(*httpAddr, server); err != nil {
+		log.Fatalf("DNS stand-in stopped: %v", err)
+	}
+}
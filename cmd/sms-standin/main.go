@@ -0,0 +1,22 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/nikhil/url-shortner-backend/pkg/sms"
+)
+
+// A local SMS provider: point SMS_PROVIDER_URL at http://localhost:8090/messages and read the
+// messages from the log or from GET /messages?to=<phone>
+func main() {
+	addr := flag.String("addr", "localhost:8090", "address to listen on")
+	token := flag.String("token", "", "bearer token required from senders, SMS_PROVIDER_TOKEN of the api")
+	flag.Parse()
+
+	log.Printf("SMS stand-in listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, sms.NewStandIn(*token)); err != nil {
+		log.Fatalf("SMS stand-in stopped: %v", err)
+	}
+}
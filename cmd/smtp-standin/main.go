@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/nikhil/url-shortner-backend/pkg/smtpstandin"
+)
+
+// A local SMTP server: point SMTP_HOST and SMTP_PORT at it and read the emails from
+// GET http://localhost:8025/messages?to=<address>
+func main() {
+	smtpAddr := flag.String("smtp-addr", "localhost:1025", "address to accept SMTP on")
+	httpAddr := flag.String("http-addr", "localhost:8025", "address to list messages on")
+	flag.Parse()
+
+	server := smtpstandin.NewServer()
+	listener, err := net.Listen("tcp", *smtpAddr)
+	if err != nil {
+		log.Fatalf("SMTP stand-in can't listen: %v", err)
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Fatalf("SMTP stand-in stopped: %v", err)
+		}
+	}()
+
+	log.Printf("SMTP stand-in listening on %s, messages on http://%s/messages", *smtpAddr, *httpAddr)
+	if err := http.ListenAndServe(*httpAddr, server); err != nil {
+		log.Fatalf("SMTP stand-in stopped: %v", err)
+	}
+}
@@ -1,8 +1,14 @@
 package config
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/pkg/token"
 	"github.com/spf13/viper"
+	"net/url"
+	"strings"
+	"time"
 )
 
 type EmailConfig struct {
@@ -24,20 +30,43 @@ type Config struct {
 	Env              string `mapstructure:"ENV"`
 	Component        string `mapstructure:"COMPONENT"`
 	ServerPort       string `mapstructure:"SERVER_PORT"`
+	PublicBaseURL    string `mapstructure:"PUBLIC_BASE_URL"`
 	DBHost           string `mapstructure:"DB_HOST"`
 	DBPort           string `mapstructure:"DB_PORT"`
 	DBUser           string `mapstructure:"DB_USER"`
 	DBPassword       string `mapstructure:"DB_PASSWORD"`
 	DBName           string `mapstructure:"DB_NAME"`
 	AccessJWTSecret  string `mapstructure:"ACCESS_JWT_SECRET"`
-	RefreshJWTSecret string `mapstructure:"REFRESH_JWT_SECRET"`
-	EmailConfig      `mapstructure:",squash"`
-	RedisConfig      `mapstructure:",squash"`
+	LinkAccessSecret string `mapstructure:"LINK_ACCESS_SECRET"`
+	// DataEncryptionKey encrypts secrets stored in the database, such as the JWT signing keys
+	DataEncryptionKey      string        `mapstructure:"DATA_ENCRYPTION_KEY"`
+	JWTSigningAlgorithm    string        `mapstructure:"JWT_SIGNING_ALGORITHM"`
+	JWTKeyRotationInterval time.Duration `mapstructure:"JWT_KEY_ROTATION_INTERVAL"`
+	ReservedAliases        []string      `mapstructure:"RESERVED_ALIASES"`
+	AdminEmails            []string      `mapstructure:"ADMIN_EMAILS"` // promoted to admins on startup, to create the first admin
+	DNSResolverAddr        string        `mapstructure:"DNS_RESOLVER_ADDR"`
+	// SMSProviderURL is the messages endpoint of the SMS gateway, codes can't be texted without it
+	SMSProviderURL   string `mapstructure:"SMS_PROVIDER_URL"`
+	SMSProviderToken string `mapstructure:"SMS_PROVIDER_TOKEN"`
+	// OTPWebhookAllowPrivateNetworks lets OTP webhooks reach local addresses, for development only
+	OTPWebhookAllowPrivateNetworks bool `mapstructure:"OTP_WEBHOOK_ALLOW_PRIVATE_NETWORKS"`
+	// MagicLinkURL is the page emailed sign in links open, it gets the token as the token query parameter
+	MagicLinkURL string `mapstructure:"MAGIC_LINK_URL"`
+	// EmailTemplatesDir overrides the embedded email templates, files are read again when they change
+	EmailTemplatesDir string `mapstructure:"EMAIL_TEMPLATES_DIR"`
+	DefaultLocale     string `mapstructure:"DEFAULT_LOCALE"`
+	SupportEmail      string `mapstructure:"SUPPORT_EMAIL"`
+	EmailConfig       `mapstructure:",squash"`
+	RedisConfig       `mapstructure:",squash"`
 }
 
 func Load() (*Config, error) {
 	// Set default values
 	viper.SetDefault("SERVER_PORT", "8080")
+	viper.SetDefault("PUBLIC_BASE_URL", "http://localhost:8080")
+	viper.SetDefault("JWT_SIGNING_ALGORITHM", common_constants.DefaultJWTSigningAlgorithm)
+	viper.SetDefault("JWT_KEY_ROTATION_INTERVAL", common_constants.DefaultJWTKeyRotationInterval.String())
+	viper.SetDefault("DEFAULT_LOCALE", common_constants.DefaultLocale)
 
 	// Tell Viper to look for the .env file
 	viper.SetConfigName(".env") // Name of config file (without extension)
@@ -66,13 +95,27 @@ func Load() (*Config, error) {
 	viper.BindEnv("SMTP_PASSWORD")
 	viper.BindEnv("FROM_EMAIL")
 	viper.BindEnv("SERVER_PORT")
+	viper.BindEnv("PUBLIC_BASE_URL")
 	viper.BindEnv("DB_HOST")
 	viper.BindEnv("DB_PORT")
 	viper.BindEnv("DB_USER")
 	viper.BindEnv("DB_PASSWORD")
 	viper.BindEnv("DB_NAME")
 	viper.BindEnv("ACCESS_JWT_SECRET")
-	viper.BindEnv("REFRESH_JWT_SECRET")
+	viper.BindEnv("LINK_ACCESS_SECRET")
+	viper.BindEnv("DATA_ENCRYPTION_KEY")
+	viper.BindEnv("JWT_SIGNING_ALGORITHM")
+	viper.BindEnv("JWT_KEY_ROTATION_INTERVAL")
+	viper.BindEnv("RESERVED_ALIASES")
+	viper.BindEnv("ADMIN_EMAILS")
+	viper.BindEnv("DNS_RESOLVER_ADDR")
+	viper.BindEnv("SMS_PROVIDER_URL")
+	viper.BindEnv("SMS_PROVIDER_TOKEN")
+	viper.BindEnv("OTP_WEBHOOK_ALLOW_PRIVATE_NETWORKS")
+	viper.BindEnv("EMAIL_TEMPLATES_DIR")
+	viper.BindEnv("DEFAULT_LOCALE")
+	viper.BindEnv("SUPPORT_EMAIL")
+	viper.BindEnv("MAGIC_LINK_URL")
 
 	// Unmarshal into the Config struct
 	var config Config
@@ -90,8 +133,26 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("ACCESS_JWT_SECRET is required")
 	}
 
-	if config.RefreshJWTSecret == "" {
-		return nil, fmt.Errorf("ACCESS_JWT_SECRET is required")
+	switch config.JWTSigningAlgorithm {
+	case token.AlgorithmRS256, token.AlgorithmEdDSA, token.AlgorithmHS256:
+	default:
+		return nil, fmt.Errorf("JWT_SIGNING_ALGORITHM must be one of RS256, EdDSA or HS256")
+	}
+
+	// Keys must live long enough to be published ahead of signing
+	if config.JWTKeyRotationInterval < common_constants.SigningKeyPublishLeadTime {
+		return nil, fmt.Errorf("JWT_KEY_ROTATION_INTERVAL must be at least %s", common_constants.SigningKeyPublishLeadTime)
+	}
+
+	// Unlock cookies of protected links are signed with the access token secret unless a dedicated one is set
+	if config.LinkAccessSecret == "" {
+		config.LinkAccessSecret = config.AccessJWTSecret
+	}
+
+	// Short links and QR codes are built from the public base URL
+	publicBaseURL, err := url.Parse(config.PublicBaseURL)
+	if err != nil || (publicBaseURL.Scheme != "http" && publicBaseURL.Scheme != "https") || publicBaseURL.Host == "" {
+		return nil, fmt.Errorf("PUBLIC_BASE_URL must be an absolute http(s) URL")
 	}
 
 	// Make sure email config is set
@@ -99,5 +160,38 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("required email configuration missing")
 	}
 
+	// Emails point users at the sender address for help unless a support address is set
+	if config.SupportEmail == "" {
+		config.SupportEmail = config.EmailConfig.FromEmail
+	}
+
+	// Magic links open the verify endpoint of the API unless a frontend page is set
+	if config.MagicLinkURL == "" {
+		config.MagicLinkURL = strings.TrimSuffix(config.PublicBaseURL, "/") + "/api/v1/auth/magic-link/verify"
+	}
+	magicLinkURL, err := url.Parse(config.MagicLinkURL)
+	if err != nil || (magicLinkURL.Scheme != "http" && magicLinkURL.Scheme != "https") || magicLinkURL.Host == "" {
+		return nil, fmt.Errorf("MAGIC_LINK_URL must be an absolute http(s) URL")
+	}
+
 	return &config, nil
 }
+
+// PublicHostname returns the host (with port, if any) of the public base URL
+func (c *Config) PublicHostname() string {
+	publicBaseURL, err := url.Parse(c.PublicBaseURL)
+	if err != nil {
+		return ""
+	}
+	return publicBaseURL.Host
+}
+
+// EncryptionKey returns the AES-256 key derived from DATA_ENCRYPTION_KEY, or from ACCESS_JWT_SECRET when it isn't set
+func (c *Config) EncryptionKey() []byte {
+	secret := c.DataEncryptionKey
+	if secret == "" {
+		secret = c.AccessJWTSecret
+	}
+	key := sha256.Sum256([]byte(secret))
+	return key[:]
+}
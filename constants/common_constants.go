@@ -9,8 +9,260 @@ const (
 	UserRoleUser  UserRole = "user"
 )
 
+// RedirectType is how a short link sends visitors to its long URL: an HTTP redirect status or an HTML page
+type RedirectType string
+
+const (
+	RedirectTypeMovedPermanently  RedirectType = "301"
+	RedirectTypeFound             RedirectType = "302"
+	RedirectTypeTemporaryRedirect RedirectType = "307"
+	RedirectTypePermanentRedirect RedirectType = "308"
+	RedirectTypeInterstitial      RedirectType = "interstitial"
+	// DefaultRedirectType isn't cached by browsers, so every visit is counted
+	DefaultRedirectType = RedirectTypeFound
+	// InterstitialRedirectDelay is how long the interstitial page is shown, in seconds
+	InterstitialRedirectDelay = 3
+)
+
 const (
 	OTPCacheTimeOut        time.Duration = 5 * time.Minute
 	UserSignupCacheTimeout time.Duration = 5 * time.Minute
 	UserSessionTimeout     time.Duration = 7 * 24 * time.Hour
 )
+
+const (
+	ClickFlushInterval   time.Duration = 5 * time.Second
+	ClickFlushBatchSize  int           = 1000
+	ClickBufferMaxEvents int           = 50000
+	ShutdownGracePeriod  time.Duration = 15 * time.Second
+)
+
+const (
+	URLCacheTTL         time.Duration = 1 * time.Hour
+	URLNegativeCacheTTL time.Duration = 1 * time.Minute
+)
+
+// ReservedAliases can never be claimed as custom aliases since they clash with routes or could be used for phishing
+var ReservedAliases = []string{
+	"api", "admin", "administrator", "auth", "login", "logout", "signin", "signup", "register",
+	"account", "settings", "dashboard", "password", "reset", "verify", "static", "assets",
+	"health", "status", "metrics", "help", "support", "docs", "www", "mail", "wellknown", "root",
+}
+
+// ProfaneAliases is the built-in profanity list, extended through the RESERVED_ALIASES setting
+var ProfaneAliases = []string{
+	"fuck", "fucker", "fucking", "shit", "bitch", "bastard", "asshole", "cunt", "dick", "pussy", "slut", "whore",
+}
+
+const (
+	MaxShortCodeGenerationAttempts = 3
+)
+
+const (
+	// DefaultDomainID is the domain id of links served from the main host
+	DefaultDomainID            uint          = 0
+	DomainCacheTTL             time.Duration = 1 * time.Hour
+	DomainNegativeCacheTTL     time.Duration = 1 * time.Minute
+	DomainVerificationRecord   string        = "_url-shortener-challenge"
+	DomainVerificationTXTValue string        = "url-shortener-verification="
+)
+
+const (
+	QRCodeDefaultSize       int           = 256
+	QRCodeDefaultQuietZone  int           = 4
+	QRCodeDefaultForeground string        = "000000"
+	QRCodeDefaultBackground string        = "ffffff"
+	QRCodeCacheMaxAge       time.Duration = 1 * time.Hour
+	QRCodeImageURLTTL       time.Duration = 24 * time.Hour // how long signed QR code image URLs work
+)
+
+const (
+	ExpirySweepInterval  time.Duration = 1 * time.Minute
+	ExpirySweepBatchSize int           = 500
+)
+
+const (
+	LinkAccessCookieName string        = "link_access"
+	LinkAccessTTL        time.Duration = 30 * time.Minute
+	CSRFCookieName       string        = "csrf_token"
+	CSRFTokenTTL         time.Duration = 1 * time.Hour
+	MaxUnlockAttempts    int64         = 5
+	UnlockAttemptWindow  time.Duration = 15 * time.Minute
+)
+
+const (
+	LoginFailureWindow          time.Duration = 15 * time.Minute
+	MaxFailedLoginAttemptsPerIP int64         = 20
+)
+
+const (
+	SessionLastSeenInterval time.Duration = 1 * time.Minute
+)
+
+const (
+	AccessTokenTTL  time.Duration = 15 * time.Minute
+	RefreshTokenTTL time.Duration = 7 * 24 * time.Hour
+)
+
+const (
+	DefaultJWTSigningAlgorithm    string        = "RS256"
+	DefaultJWTKeyRotationInterval time.Duration = 30 * 24 * time.Hour
+	// SigningKeyPublishLeadTime is how long a new key sits in the JWKS before it signs anything, so
+	// that every instance and every verifier caching the JWKS knows it by then
+	SigningKeyPublishLeadTime time.Duration = 15 * time.Minute
+	SigningKeyRefreshInterval time.Duration = 5 * time.Minute
+	SigningKeyRotationLockTTL time.Duration = 1 * time.Minute
+	JWKSCacheMaxAge           time.Duration = 5 * time.Minute
+)
+
+// APIKeyScope limits what an API key can do. Scopes are ordered, each one includes the ones before it.
+type APIKeyScope string
+
+const (
+	APIKeyScopeRead   APIKeyScope = "read"   // list and fetch links, stats and domains
+	APIKeyScopeCreate APIKeyScope = "create" // also create links
+	APIKeyScopeManage APIKeyScope = "manage" // also update and delete links and domains
+)
+
+// Includes reports whether the scope grants everything the other scope does
+func (s APIKeyScope) Includes(other APIKeyScope) bool {
+	return apiKeyScopeLevels[s] >= apiKeyScopeLevels[other]
+}
+
+var apiKeyScopeLevels = map[APIKeyScope]int{
+	APIKeyScopeRead:   1,
+	APIKeyScopeCreate: 2,
+	APIKeyScopeManage: 3,
+}
+
+const (
+	APIKeyHeader   string = "X-API-Key"
+	APIKeyPrefix   string = "usk_"
+	APIKeyAuthType string = "ApiKey"
+	// APIKeyDisplayLength is how many leading characters of a key are kept to tell keys apart
+	APIKeyDisplayLength    int           = 12
+	MaxAPIKeysPerUser      int64         = 25
+	APIKeyLastUsedInterval time.Duration = 1 * time.Minute
+)
+
+// WorkspaceRole is what a member may do in a workspace. Roles are ordered, each one includes the ones before it.
+type WorkspaceRole string
+
+const (
+	WorkspaceRoleViewer WorkspaceRole = "viewer" // read links and their stats
+	WorkspaceRoleEditor WorkspaceRole = "editor" // also create, update and delete links
+	WorkspaceRoleOwner  WorkspaceRole = "owner"  // also manage the workspace and its members
+)
+
+// Includes reports whether the role grants everything the other role does
+func (r WorkspaceRole) Includes(other WorkspaceRole) bool {
+	return workspaceRoleLevels[r] >= workspaceRoleLevels[other]
+}
+
+var workspaceRoleLevels = map[WorkspaceRole]int{
+	WorkspaceRoleViewer: 1,
+	WorkspaceRoleEditor: 2,
+	WorkspaceRoleOwner:  3,
+}
+
+const (
+	// WorkspaceHeader selects the workspace of a request, the personal workspace when missing
+	WorkspaceHeader        string        = "X-Workspace-ID"
+	WorkspaceInvitationTTL time.Duration = 7 * 24 * time.Hour
+)
+
+const (
+	// TwoFactorChallengeTTL is how long the challenge token returned by a password login stays valid
+	TwoFactorChallengeTTL time.Duration = 5 * time.Minute
+	// TOTPAllowedSkew is how many 30 second steps a code may be early or late, for clock drift
+	TOTPAllowedSkew   int = 1
+	RecoveryCodeCount int = 10
+)
+
+const (
+	// MagicLinkTTL is how long an emailed sign in link stays valid
+	MagicLinkTTL time.Duration = 10 * time.Minute
+	// MagicLinkCooldown is how long after a link is emailed no other link is sent to the same user
+	MagicLinkCooldown time.Duration = 1 * time.Minute
+	// MagicLinkNonceCookie binds a link to the browser it was requested from
+	MagicLinkNonceCookie string = "magic_link_nonce"
+)
+
+// OTPPurpose binds a one-time code to the flow it was sent for, so a code of one flow can't be used in another
+type OTPPurpose string
+
+const (
+	OTPPurposeSignup        OTPPurpose = "signup"
+	OTPPurposeResetPassword OTPPurpose = "reset_password"
+	OTPPurposeUnlockAccount OTPPurpose = "unlock_account"
+	OTPPurposeVerifyPhone   OTPPurpose = "verify_phone"
+	// OTPPurposeLogin codes sign users in without their password, over the channel they picked
+	OTPPurposeLogin OTPPurpose = "login"
+	// OTPPurposeConfirmOTPChange codes are sent over the current channel to confirm moving codes elsewhere
+	OTPPurposeConfirmOTPChange OTPPurpose = "confirm_otp_change"
+)
+
+// OTPChannel is how one-time codes reach a user
+type OTPChannel string
+
+const (
+	OTPChannelEmail   OTPChannel = "email"
+	OTPChannelSMS     OTPChannel = "sms"
+	OTPChannelWebhook OTPChannel = "webhook"
+)
+
+const (
+	OTPWebhookTimeout         time.Duration = 5 * time.Second
+	OTPWebhookSignatureHeader string        = "X-Signature-256"
+)
+
+const (
+	OTPDigits int = 6
+	// MaxOTPAttempts wrong guesses invalidate a code, a new one has to be requested
+	MaxOTPAttempts    int64         = 5
+	OTPResendCooldown time.Duration = 1 * time.Minute
+)
+
+// EmailTemplate names a transactional email of the template registry
+type EmailTemplate string
+
+const (
+	EmailTemplateOTP                 EmailTemplate = "otp"
+	EmailTemplatePasswordReset       EmailTemplate = "password_reset"
+	EmailTemplateLockoutNotice       EmailTemplate = "lockout_notice"
+	EmailTemplateLinkExpiryNotice    EmailTemplate = "link_expiry_notice"
+	EmailTemplateWorkspaceInvitation EmailTemplate = "workspace_invitation"
+	EmailTemplateMagicLink           EmailTemplate = "magic_link"
+	EmailTemplateOTPChangeNotice     EmailTemplate = "otp_change_notice"
+)
+
+// DefaultLocale is the locale of emails to users without one, and the fallback of missing translations
+const DefaultLocale string = "en"
+
+// EmailStatus is the delivery state of an email of the outbox
+type EmailStatus string
+
+const (
+	EmailStatusPending EmailStatus = "pending"
+	EmailStatusSent    EmailStatus = "sent"
+	// EmailStatusDead emails failed every attempt, they are only sent again when an admin resends them
+	EmailStatusDead EmailStatus = "dead"
+)
+
+const (
+	EmailOutboxPollInterval time.Duration = 2 * time.Second
+	// EmailSendLease is how long a claimed email stays hidden from other senders, if a sender dies
+	// while sending it another one picks it up after the lease
+	EmailSendLease      time.Duration = 2 * time.Minute
+	MaxEmailAttempts    int           = 8
+	EmailRetryBaseDelay time.Duration = 30 * time.Second
+	EmailRetryMaxDelay  time.Duration = 1 * time.Hour
+	// SMTPIdleTimeout closes the pooled SMTP connection when nothing was sent for a while
+	SMTPIdleTimeout time.Duration = 30 * time.Second
+)
+
+const (
+	// SentEmailRetention is how long records of sent emails are kept, for support
+	SentEmailRetention time.Duration = 7 * 24 * time.Hour
+	EmailPurgeInterval time.Duration = 1 * time.Hour
+)
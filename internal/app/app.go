@@ -1,19 +1,34 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/nikhil/url-shortner-backend/config"
+	"github.com/nikhil/url-shortner-backend/constants"
 	"github.com/nikhil/url-shortner-backend/internal/database"
 	"github.com/nikhil/url-shortner-backend/internal/utils"
 	"github.com/nikhil/url-shortner-backend/pkg/redis"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
+// backgroundWorker is a long-running job started with the app and drained on shutdown
+type backgroundWorker interface {
+	Start()
+	Stop()
+}
+
 type App struct {
-	router *gin.Engine
-	cfg    *config.Config
+	router  *gin.Engine
+	cfg     *config.Config
+	workers []backgroundWorker
 }
 
 func NewApp(cfg *config.Config) *App {
@@ -29,13 +44,42 @@ func (a *App) Run() {
 	err := utils.InitializeSnowflakeNode(1)
 	if err != nil {
 		panic("failed to initialize snowflake node")
-		return
 	}
 	a.setupRoutes(db, cacheClient)
-	err = a.router.Run(":" + a.cfg.ServerPort)
-	if err != nil {
-		panic(err)
+	for _, worker := range a.workers {
+		worker.Start()
+	}
+
+	server := &http.Server{
+		Addr:    ":" + a.cfg.ServerPort,
+		Handler: a.router,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			panic(err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), common_constants.ShutdownGracePeriod)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+
+	// Stop workers in reverse start order so that anything still buffered gets drained
+	for i := len(a.workers) - 1; i >= 0; i-- {
+		a.workers[i].Stop()
 	}
+	log.Println("Server exited")
+}
+
+func (a *App) addWorker(worker backgroundWorker) {
+	a.workers = append(a.workers, worker)
 }
 
 func (a *App) setupDatabase() *gorm.DB {
@@ -47,7 +91,7 @@ func (a *App) setupDatabase() *gorm.DB {
 		a.cfg.DBPort,
 	)
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		panic("Failed to connect to database")
 	}
@@ -1,7 +1,9 @@
 package app
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
 	"github.com/nikhil/url-shortner-backend/internal/handler"
 	"github.com/nikhil/url-shortner-backend/internal/middleware"
 	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
@@ -9,7 +11,10 @@ import (
 	"github.com/nikhil/url-shortner-backend/internal/service"
 	"github.com/nikhil/url-shortner-backend/internal/service/email_service"
 	"github.com/nikhil/url-shortner-backend/internal/service/otp_service"
+	"github.com/nikhil/url-shortner-backend/pkg/dns"
 	"github.com/nikhil/url-shortner-backend/pkg/redis"
+	"github.com/nikhil/url-shortner-backend/pkg/sms"
+	"github.com/nikhil/url-shortner-backend/pkg/token"
 	"gorm.io/gorm"
 )
 
@@ -18,8 +23,8 @@ func CORSMiddleware() gin.HandlerFunc {
 
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST,HEAD,PATCH, OPTIONS, GET, PUT")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, X-Workspace-ID, accept, origin, Cache-Control, X-Requested-With")
+		c.Header("Access-Control-Allow-Methods", "POST,HEAD,PATCH, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -34,16 +39,77 @@ func (a *App) setupRoutes(db *gorm.DB, cache redis.CacheClient) {
 	userRepo := repository.NewUserRepository(db, cache)
 	otpRepo := repository.NewOTPRepository(cache)
 	sessionRepo := repository.NewSessionRepository(cache)
-	urlRepo := repository.NewURLRepository(db)
+	urlRepo := repository.NewURLRepository(db, cache)
+	clickEventRepo := repository.NewClickEventRepository(db)
+	domainRepo := repository.NewDomainRepository(db, cache)
+	rateLimitRepo := repository.NewRateLimitRepository(cache)
+	signingKeyRepo := repository.NewSigningKeyRepository(db, cache)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	workspaceRepo := repository.NewWorkspaceRepository(db)
+	recoveryCodeRepo := repository.NewRecoveryCodeRepository(db)
+	rolePolicyRepo := repository.NewRolePolicyRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
 
-	emailService := email_service.GetSMTPEmailService(a.cfg.EmailConfig)
-	otpService := otp_service.NewOTPService(emailService, otpRepo)
+	// Emails are queued in the outbox and sent in the background, requests never wait for SMTP
+	outbox := email_service.NewOutbox(
+		outboxRepo, email_service.NewSMTPSender(a.cfg.EmailConfig), a.cfg.FromEmail, logger.NewLogger(a.cfg.Env, a.cfg.Component),
+	)
+	a.addWorker(outbox)
+	var emailService email_service.IEmailService = outbox
+	emailTemplates, err := email_service.NewTemplateRegistry(
+		a.cfg.EmailTemplatesDir, a.cfg.DefaultLocale, a.cfg.SupportEmail, logger.NewLogger(a.cfg.Env, a.cfg.Component),
+	)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load email templates: %v", err))
+	}
+	otpChannels := []otp_service.IOTPChannel{
+		otp_service.NewEmailChannel(emailService, emailTemplates),
+		otp_service.NewWebhookChannel(a.cfg.OTPWebhookAllowPrivateNetworks),
+	}
+	if a.cfg.SMSProviderURL != "" {
+		otpChannels = append(otpChannels, otp_service.NewSMSChannel(sms.NewHTTPProvider(a.cfg.SMSProviderURL, a.cfg.SMSProviderToken)))
+	}
+	otpService := otp_service.NewOTPService(otpRepo, a.cfg.EncryptionKey(), otpChannels...)
 
-	authService := service.NewAuthService(userRepo, sessionRepo, otpService, a.cfg.AccessJWTSecret, a.cfg.RefreshJWTSecret)
-	urlService := service.NewURLService(urlRepo)
+	tokenIssuer := token.NewKeySetIssuer(a.cfg.PublicBaseURL)
+	keyManager := service.NewKeyManager(
+		signingKeyRepo, tokenIssuer, a.cfg.EncryptionKey(), a.cfg.JWTSigningAlgorithm, a.cfg.JWTKeyRotationInterval,
+		logger.NewLogger(a.cfg.Env, a.cfg.Component),
+	)
+	if err := keyManager.Init(); err != nil {
+		panic(fmt.Sprintf("Failed to load signing keys: %v", err))
+	}
+	a.addWorker(keyManager)
+
+	authService := service.NewAuthService(
+		userRepo, sessionRepo, rateLimitRepo, otpService, emailService, emailTemplates, tokenIssuer,
+		recoveryCodeRepo, rolePolicyRepo, a.cfg.EncryptionKey(), a.cfg.PublicHostname(), a.cfg.MagicLinkURL,
+	)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	workspaceService := service.NewWorkspaceService(workspaceRepo, userRepo, urlRepo, emailService, emailTemplates)
+	clickTracker := service.NewClickTracker(urlRepo, clickEventRepo, logger.NewLogger(a.cfg.Env, a.cfg.Component))
+	a.addWorker(clickTracker)
+	aliasPolicy := service.NewAliasPolicy(a.cfg.ReservedAliases)
+	domainService := service.NewDomainService(domainRepo, urlRepo, dns.NewResolver(a.cfg.DNSResolverAddr), a.cfg.PublicHostname())
+	linkAccess := service.NewLinkAccess(a.cfg.LinkAccessSecret)
+	qrCodeSigner := service.NewQRCodeSigner(a.cfg.LinkAccessSecret)
+	urlService := service.NewURLService(
+		urlRepo, clickEventRepo, clickTracker, aliasPolicy, domainService, rateLimitRepo, linkAccess, qrCodeSigner,
+		a.cfg.PublicBaseURL,
+	)
+	adminService := service.NewAdminService(userRepo, sessionRepo, rolePolicyRepo, outboxRepo, urlService, emailTemplates)
+	if err := adminService.BootstrapAdmins(logger.NewLogger(a.cfg.Env, a.cfg.Component), a.cfg.AdminEmails); err != nil {
+		panic(fmt.Sprintf("Failed to bootstrap admins: %v", err))
+	}
+	a.addWorker(service.NewExpirySweeper(urlRepo, urlService, emailService, emailTemplates, logger.NewLogger(a.cfg.Env, a.cfg.Component)))
 
 	authHandler := handler.NewAuthHandler(authService, otpService)
 	urlHandler := handler.NewURLHandler(urlService)
+	domainHandler := handler.NewDomainHandler(domainService)
+	jwksHandler := handler.NewJWKSHandler(tokenIssuer)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
+	workspaceHandler := handler.NewWorkspaceHandler(workspaceService)
+	adminHandler := handler.NewAdminHandler(adminService)
 
 	// Router Groups
 	a.router.LoadHTMLGlob("templates/*")
@@ -57,30 +123,136 @@ func (a *App) setupRoutes(db *gorm.DB, cache redis.CacheClient) {
 	{
 		authRouterGroup.POST("/signup", authHandler.SignUp)
 		authRouterGroup.POST("/verify-registration-otp", authHandler.VerifyRegistrationOTP)
+		authRouterGroup.POST("/resend-otp", authHandler.ResendOTP)
 		authRouterGroup.POST("/login", authHandler.Login)
+		authRouterGroup.POST("/login/2fa", authHandler.LoginTwoFactor)
+		authRouterGroup.POST("/login/2fa/enroll", authHandler.EnrollTwoFactorChallenge)
+		authRouterGroup.POST("/login/code", authHandler.RequestLoginCode)
+		authRouterGroup.POST("/login/code/verify", authHandler.LoginWithCode)
+		authRouterGroup.POST("/magic-link", authHandler.RequestMagicLink)
+		authRouterGroup.GET("/magic-link/verify", authHandler.LoginWithMagicLink)
+		authRouterGroup.POST("/magic-link/verify", authHandler.LoginWithMagicLink)
 		authRouterGroup.POST("/refresh-token", authHandler.RefreshToken)
-		authRouterGroup.POST("/logout", authHandler.Logout)
 		authRouterGroup.POST("/forgot-password", authHandler.ForgotPassword)
 		authRouterGroup.POST("/reset-password", authHandler.ResetPassword)
+		authRouterGroup.POST("/unlock-account/request", authHandler.RequestAccountUnlock)
+		authRouterGroup.POST("/unlock-account", authHandler.UnlockAccount)
 	}
 
-	// URL redirect route (public)
-	urlRouterGroup := routerGroup.Group("/url")
-	{
-		urlRouterGroup.GET("/:shortCode", urlHandler.RedirectToLongURL)
-	}
+	// QR code images (public), authorized by the signature of the URL so that <img> tags can load them
+	routerGroup.GET("/qr/:id", urlHandler.GetSignedQRCode)
+
+	// Public signing keys, so other services can verify our tokens
+	a.router.GET("/.well-known/jwks.json", jwksHandler.GetJWKS)
+
+	// URL redirect route (public), served from the root so short links stay short
+	a.router.GET("/:shortCode", urlHandler.RedirectToLongURL)
+	a.router.POST("/:shortCode/unlock", urlHandler.UnlockURL)
 
 	// Protected routes - authentication middleware
+	// Short links shared before redirects moved to the root point at /api/v1/url/:shortCode, which now
+	// fetches a link. Unauthenticated visits there are still redirected.
 	protectedRouterGroup := routerGroup.Group("")
-	protectedRouterGroup.Use(middleware.AuthMiddleware(sessionRepo, a.cfg.AccessJWTSecret))
+	protectedRouterGroup.Use(
+		middleware.LegacyRedirectMiddleware(routerGroup.BasePath()+"/url/:shortCode"),
+		middleware.AuthMiddleware(sessionRepo, tokenIssuer, apiKeyService),
+	)
 	{
-		// URL management routes
-		protectedURLRouterGroup := protectedRouterGroup.Group("/url")
+		// Session management routes
+		protectedAuthRouterGroup := protectedRouterGroup.Group("/auth", middleware.RequireSession())
+		{
+			protectedAuthRouterGroup.POST("/logout", authHandler.Logout)
+			protectedAuthRouterGroup.GET("/sessions", authHandler.ListSessions)
+			protectedAuthRouterGroup.DELETE("/sessions", authHandler.RevokeAllSessions)
+			protectedAuthRouterGroup.DELETE("/sessions/:id", authHandler.RevokeSession)
+			protectedAuthRouterGroup.GET("/2fa", authHandler.GetTwoFactorStatus)
+			protectedAuthRouterGroup.POST("/2fa/enroll", authHandler.EnrollTwoFactor)
+			protectedAuthRouterGroup.POST("/2fa/confirm", authHandler.ConfirmTwoFactor)
+			protectedAuthRouterGroup.POST("/2fa/disable", authHandler.DisableTwoFactor)
+			protectedAuthRouterGroup.POST("/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+			protectedAuthRouterGroup.PUT("/locale", authHandler.UpdateLocale)
+			protectedAuthRouterGroup.GET("/otp-preference", authHandler.GetOTPPreference)
+			protectedAuthRouterGroup.PUT("/otp-preference", authHandler.UpdateOTPPreference)
+			protectedAuthRouterGroup.POST("/otp-preference/code", authHandler.SendOTPChangeCode)
+			protectedAuthRouterGroup.PUT("/phone", authHandler.RegisterPhone)
+			protectedAuthRouterGroup.POST("/phone/verify", authHandler.VerifyPhone)
+			protectedAuthRouterGroup.DELETE("/phone", authHandler.RemovePhone)
+		}
+
+		// API key routes, keys can only be managed from a logged in session
+		protectedAPIKeyRouterGroup := protectedRouterGroup.Group("/api-keys", middleware.RequireSession())
+		{
+			protectedAPIKeyRouterGroup.POST("", apiKeyHandler.CreateAPIKey)
+			protectedAPIKeyRouterGroup.GET("", apiKeyHandler.ListAPIKeys)
+			protectedAPIKeyRouterGroup.DELETE("/:id", apiKeyHandler.RevokeAPIKey)
+		}
+
+		// Admin routes
+		adminRouterGroup := protectedRouterGroup.Group(
+			"/admin", middleware.RequireSession(), middleware.RequireRole(userRepo, common_constants.UserRoleAdmin),
+		)
+		{
+			adminRouterGroup.GET("/users", adminHandler.ListUsers)
+			adminRouterGroup.GET("/users/:id", adminHandler.GetUser)
+			adminRouterGroup.POST("/users/:id/disable", adminHandler.DisableUser)
+			adminRouterGroup.POST("/users/:id/enable", adminHandler.EnableUser)
+			adminRouterGroup.POST("/users/:id/logout", adminHandler.LogoutUser)
+			adminRouterGroup.GET("/users/:id/urls", adminHandler.ListUserURLs)
+			adminRouterGroup.POST("/urls/:id/disable", adminHandler.DisableURL)
+			adminRouterGroup.POST("/urls/:id/enable", adminHandler.EnableURL)
+			adminRouterGroup.GET("/role-policies", adminHandler.ListRolePolicies)
+			adminRouterGroup.PUT("/role-policies/:role", adminHandler.UpdateRolePolicy)
+			adminRouterGroup.GET("/email-templates", adminHandler.ListEmailTemplates)
+			adminRouterGroup.GET("/email-templates/:name/preview", adminHandler.PreviewEmailTemplate)
+			adminRouterGroup.GET("/emails", adminHandler.ListEmails)
+			adminRouterGroup.GET("/emails/:id", adminHandler.GetEmail)
+			adminRouterGroup.POST("/emails/:id/resend", adminHandler.ResendEmail)
+		}
+
+		// Workspace routes, the workspace of /:id routes comes from the path
+		owner := middleware.RequireWorkspaceRole(common_constants.WorkspaceRoleOwner)
+		editor := middleware.RequireWorkspaceRole(common_constants.WorkspaceRoleEditor)
+		protectedWorkspaceRouterGroup := protectedRouterGroup.Group("/workspaces", middleware.RequireSession())
+		{
+			protectedWorkspaceRouterGroup.POST("", workspaceHandler.CreateWorkspace)
+			protectedWorkspaceRouterGroup.GET("", workspaceHandler.ListWorkspaces)
+			protectedWorkspaceRouterGroup.POST("/invitations/accept", workspaceHandler.AcceptInvitation)
+
+			workspaceRouterGroup := protectedWorkspaceRouterGroup.Group("/:id", middleware.WorkspaceParamMiddleware(workspaceService))
+			workspaceRouterGroup.PATCH("", owner, workspaceHandler.UpdateWorkspace)
+			workspaceRouterGroup.DELETE("", owner, workspaceHandler.DeleteWorkspace)
+			workspaceRouterGroup.GET("/members", workspaceHandler.ListMembers)
+			workspaceRouterGroup.PATCH("/members/:userId", owner, workspaceHandler.UpdateMember)
+			workspaceRouterGroup.DELETE("/members/:userId", workspaceHandler.RemoveMember)
+			workspaceRouterGroup.POST("/invitations", owner, workspaceHandler.InviteMember)
+			workspaceRouterGroup.GET("/invitations", owner, workspaceHandler.ListInvitations)
+			workspaceRouterGroup.DELETE("/invitations/:invitationId", owner, workspaceHandler.RevokeInvitation)
+		}
+
+		// URL management routes, scoped to the workspace of the X-Workspace-ID header
+		read := middleware.RequireScope(common_constants.APIKeyScopeRead)
+		create := middleware.RequireScope(common_constants.APIKeyScopeCreate)
+		manage := middleware.RequireScope(common_constants.APIKeyScopeManage)
+		protectedURLRouterGroup := protectedRouterGroup.Group("/url", middleware.WorkspaceMiddleware(workspaceService))
+		{
+			protectedURLRouterGroup.POST("", create, editor, urlHandler.CreateShortURL)
+			protectedURLRouterGroup.POST("/bulk", create, editor, urlHandler.CreateBulkShortURLs)
+			protectedURLRouterGroup.GET("", read, urlHandler.GetWorkspaceURLs)
+			protectedURLRouterGroup.GET("/qr/:shortCode", read, urlHandler.GenerateQRCode)
+			protectedURLRouterGroup.GET("/alias-available", read, urlHandler.CheckAliasAvailability)
+			protectedURLRouterGroup.GET("/:shortCode", read, urlHandler.GetShortURL)
+			protectedURLRouterGroup.PATCH("/:shortCode", manage, editor, urlHandler.UpdateShortURL)
+			protectedURLRouterGroup.DELETE("/:shortCode", manage, editor, urlHandler.DeleteShortURL)
+			protectedURLRouterGroup.GET("/:shortCode/stats", read, urlHandler.GetURLStats)
+		}
+
+		// Custom domain routes
+		protectedDomainRouterGroup := protectedRouterGroup.Group("/domains")
 		{
-			protectedURLRouterGroup.POST("", urlHandler.CreateShortURL)
-			protectedURLRouterGroup.POST("/bulk", urlHandler.CreateBulkShortURLs)
-			protectedURLRouterGroup.GET("", urlHandler.GetUserURLs)
-			protectedURLRouterGroup.GET("/qr/:shortCode", urlHandler.GenerateQRCode)
+			protectedDomainRouterGroup.POST("", manage, domainHandler.AddDomain)
+			protectedDomainRouterGroup.GET("", read, domainHandler.ListDomains)
+			protectedDomainRouterGroup.POST("/:id/verify", manage, domainHandler.VerifyDomain)
+			protectedDomainRouterGroup.DELETE("/:id", manage, domainHandler.DeleteDomain)
 		}
 	}
 }
@@ -2,23 +2,161 @@ package database
 
 import (
 	"fmt"
+	common_constants "github.com/nikhil/url-shortner-backend/constants"
 	"github.com/nikhil/url-shortner-backend/internal/model"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 func RunMigrations(db *gorm.DB) error {
 	fmt.Println("Running database migrations...")
 
+	if err := checkDuplicateShortCodes(db); err != nil {
+		return err
+	}
+
 	// Add migrations here
 	err := db.AutoMigrate(
 		&model.User{},
 		&model.URL{},
+		&model.ClickEvent{},
+		&model.Domain{},
+		&model.SigningKey{},
+		&model.APIKey{},
+		&model.Workspace{},
+		&model.WorkspaceMember{},
+		&model.WorkspaceInvitation{},
+		&model.RecoveryCode{},
+		&model.RolePolicy{},
+		&model.OutboxEmail{},
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %v", err)
 	}
 
+	// Short codes used to be unique across all links, they are now unique per domain
+	if db.Migrator().HasIndex(&model.URL{}, "idx_urls_short_code") {
+		if err = db.Migrator().DropIndex(&model.URL{}, "idx_urls_short_code"); err != nil {
+			return fmt.Errorf("failed to drop global short code index: %v", err)
+		}
+	}
+
+	if err = backfillURLProtection(db); err != nil {
+		return fmt.Errorf("failed to backfill url protection: %v", err)
+	}
+
+	if err = backfillPersonalWorkspaces(db); err != nil {
+		return fmt.Errorf("failed to backfill personal workspaces: %v", err)
+	}
+
 	fmt.Println("Migrations completed successfully")
 	return nil
 }
+
+// urlProtectionBackfillBatchSize is how many legacy links backfillURLProtection checks at a time
+const urlProtectionBackfillBatchSize = 500
+
+// backfillURLProtection fills is_protected for links created before the flag existed. Unprotected
+// links of that time stored a bcrypt hash of the empty password: their hash is cleared, every other
+// link is flagged protected. Links are left out of the query once handled, so this only does work
+// on the first start after the upgrade.
+func backfillURLProtection(db *gorm.DB) error {
+	var afterID uint
+	for {
+		var urls []model.URL
+		err := db.Unscoped().Select("id", "password").
+			Where("is_protected = ? AND password <> '' AND id > ?", false, afterID).
+			Order("id").
+			Limit(urlProtectionBackfillBatchSize).
+			Find(&urls).Error
+		if err != nil {
+			return err
+		}
+		if len(urls) == 0 {
+			return nil
+		}
+
+		var unprotectedIDs, protectedIDs []uint
+		for _, url := range urls {
+			if bcrypt.CompareHashAndPassword([]byte(url.Password), []byte("")) == nil {
+				unprotectedIDs = append(unprotectedIDs, url.ID)
+			} else {
+				protectedIDs = append(protectedIDs, url.ID)
+			}
+		}
+		if len(unprotectedIDs) > 0 {
+			err = db.Unscoped().Model(&model.URL{}).Where("id IN ?", unprotectedIDs).UpdateColumn("password", "").Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(protectedIDs) > 0 {
+			err = db.Unscoped().Model(&model.URL{}).Where("id IN ?", protectedIDs).UpdateColumn("is_protected", true).Error
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Backfilled protection of %d urls\n", len(urls))
+		afterID = urls[len(urls)-1].ID
+	}
+}
+
+// backfillPersonalWorkspaces gives every existing user a personal workspace and moves the links
+// they created before workspaces existed into it.
+func backfillPersonalWorkspaces(db *gorm.DB) error {
+	var users []model.User
+	err := db.Select("id", "name").
+		Where("NOT EXISTS (SELECT 1 FROM workspaces WHERE workspaces.personal_user_id = users.id)").
+		Find(&users).Error
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		userID := user.ID
+		err = db.Transaction(func(tx *gorm.DB) error {
+			workspace := &model.Workspace{Name: user.Name, PersonalUserID: &userID}
+			if err := tx.Create(workspace).Error; err != nil {
+				return err
+			}
+			return tx.Create(&model.WorkspaceMember{
+				WorkspaceID: workspace.ID,
+				UserID:      userID,
+				Role:        common_constants.WorkspaceRoleOwner,
+			}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return db.Exec(`UPDATE urls SET workspace_id = workspaces.id FROM workspaces
+		WHERE workspaces.personal_user_id = urls.user_id AND urls.workspace_id = 0`).Error
+}
+
+// checkDuplicateShortCodes fails early with an actionable message when the unique index on
+// urls (domain_id, short_code) can't be created because two links already share a short code.
+func checkDuplicateShortCodes(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&model.URL{}) {
+		return nil
+	}
+	// Before custom domains every link lived on the main host
+	group := "short_code"
+	if db.Migrator().HasColumn(&model.URL{}, "DomainID") {
+		group = "domain_id, short_code"
+	}
+	var duplicates []string
+	err := db.Unscoped().Model(&model.URL{}).
+		Select("short_code").
+		Group(group).
+		Having("COUNT(*) > 1").
+		Pluck("short_code", &duplicates).Error
+	if err != nil {
+		return fmt.Errorf("failed to check duplicate short codes: %v", err)
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("short codes used by more than one url, rename them before migrating: %v", duplicates)
+	}
+	return nil
+}
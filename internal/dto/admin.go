@@ -0,0 +1,42 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+)
+
+type AdminListUsersRequest struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Search string `form:"q" binding:"omitempty,max=200"`
+	Role   string `form:"role" binding:"omitempty,oneof=admin user"`
+	Status string `form:"status" binding:"omitempty,oneof=active disabled"`
+}
+
+// AdminUserResponse is a user as seen by admins, without the password hash
+type AdminUserResponse struct {
+	ID               uint                      `json:"id"`
+	Email            string                    `json:"email"`
+	Name             string                    `json:"name"`
+	UserRole         common_constants.UserRole `json:"user_role"`
+	DisabledAt       *time.Time                `json:"disabled_at"`
+	TwoFactorEnabled bool                      `json:"two_factor_enabled"`
+	CreatedAt        time.Time                 `json:"created_at"`
+	UpdatedAt        time.Time                 `json:"updated_at"`
+}
+
+type AdminListEmailsRequest struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Status string `form:"status" binding:"omitempty,oneof=pending sent dead"`
+}
+
+type EmailTemplatePreviewRequest struct {
+	Locale string `form:"locale" binding:"omitempty,max=35"`
+	Format string `form:"format" binding:"omitempty,oneof=json html text"`
+}
+
+type UpdateRolePolicyRequest struct {
+	RequireTwoFactor *bool `json:"require_two_factor" binding:"required"`
+}
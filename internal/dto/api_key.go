@@ -0,0 +1,14 @@
+package dto
+
+import "github.com/nikhil/url-shortner-backend/internal/model"
+
+type CreateAPIKeyRequest struct {
+	Name  string `json:"name" binding:"required,max=100"`
+	Scope string `json:"scope" binding:"required,oneof=read create manage"`
+}
+
+// CreateAPIKeyResponse is the only response that ever contains the key
+type CreateAPIKeyResponse struct {
+	*model.APIKey
+	Key string `json:"key"`
+}
@@ -1,9 +1,12 @@
 package dto
 
+import "time"
+
 type SignupRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=6,max=20"`
 	Name     string `json:"name" binding:"required"`
+	Locale   string `json:"locale" binding:"omitempty,bcp47_language_tag"` // language of emails, from Accept-Language when empty
 }
 
 type VerifyRegistrationOTPRequest struct {
@@ -12,20 +15,82 @@ type VerifyRegistrationOTPRequest struct {
 }
 
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6,max=20"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required,min=6,max=20"`
+	DeviceName string `json:"device_name" binding:"omitempty,max=100"`
 }
 
 type LoginResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+	// ChallengeToken is returned instead of the tokens when the login needs a TOTP code
+	ChallengeToken         string   `json:"challenge_token,omitempty"`
+	TwoFactorSetupRequired bool     `json:"two_factor_setup_required,omitempty"`
+	RecoveryCodes          []string `json:"recovery_codes,omitempty"` // set when the login completed a required enrollment
+}
+
+type LoginCodeRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type LoginWithCodeRequest struct {
+	Email      string `json:"email" binding:"required,email"`
+	OTP        string `json:"otp" binding:"required"`
+	DeviceName string `json:"device_name" binding:"omitempty,max=100"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// MagicLinkLoginRequest is bound from the query of a clicked link or from the JSON body of a frontend
+type MagicLinkLoginRequest struct {
+	Token      string `json:"token" form:"token" binding:"required"`
+	DeviceName string `json:"device_name" form:"device_name" binding:"omitempty,max=100"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required,max=32"` // TOTP or recovery code
+	DeviceName     string `json:"device_name" binding:"omitempty,max=100"`
+}
+
+type TwoFactorChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required,max=32"`
+}
+
+type TwoFactorEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+	QRCode     string `json:"qr_code"` // PNG data URI of the otpauth URL
+}
+
+type TwoFactorStatusResponse struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabled_at"`
+	Required          bool       `json:"required"` // required by the policy of the user's role
+	RecoveryCodesLeft int64      `json:"recovery_codes_left"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
 }
 
 type RefreshTokenResponse struct {
-	AccessToken string `json:"access_token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"-"` // sent as a cookie
 }
 
 type SendOTPRequest struct {
+	Email   string `json:"email" binding:"required,email"`
+	Purpose string `json:"purpose" binding:"required,oneof=signup reset_password unlock_account login"`
+}
+
+type RequestAccountUnlockRequest struct {
 	Email string `json:"email" binding:"required,email"`
 }
 
@@ -38,3 +103,62 @@ type ResetPasswordRequest struct {
 	OTP         string `json:"otp" binding:"required"`
 	NewPassword string `json:"new_password" binding:"required,min=6,max=20"`
 }
+
+type UnlockAccountRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	OTP   string `json:"otp" binding:"required"`
+}
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+type OTPPreferenceResponse struct {
+	Channel           string     `json:"channel"`
+	WebhookURL        string     `json:"webhook_url,omitempty"`
+	WebhookSecret     string     `json:"webhook_secret,omitempty"` // only returned when a webhook is set, sign checks use it
+	Phone             string     `json:"phone,omitempty"`
+	PhoneVerifiedAt   *time.Time `json:"phone_verified_at"`
+	PendingPhone      string     `json:"pending_phone,omitempty"`
+	AvailableChannels []string   `json:"available_channels"`
+}
+
+// Reauthentication confirms a change of where codes go, with the password of the user or a code
+// sent over the current channel by POST /auth/otp-preference/code
+type Reauthentication struct {
+	Password string `json:"password" binding:"max=72"`
+	OTP      string `json:"otp" binding:"max=16"`
+}
+
+type UpdateOTPPreferenceRequest struct {
+	Reauthentication
+	Channel    string `json:"channel" binding:"required,oneof=email sms webhook"`
+	WebhookURL string `json:"webhook_url" binding:"required_if=Channel webhook,omitempty,url,max=2048"`
+}
+
+type RegisterPhoneRequest struct {
+	Reauthentication
+	Phone string `json:"phone" binding:"required,e164"`
+}
+
+type RemovePhoneRequest struct {
+	Reauthentication
+}
+
+type VerifyPhoneRequest struct {
+	OTP string `json:"otp" binding:"required"`
+}
+
+type UpdateLocaleRequest struct {
+	Locale string `json:"locale" binding:"required,bcp47_language_tag"`
+}
+
+type LocaleResponse struct {
+	Locale string `json:"locale"`
+}
@@ -0,0 +1,14 @@
+package dto
+
+import "github.com/nikhil/url-shortner-backend/internal/model"
+
+type AddDomainRequest struct {
+	Hostname string `json:"hostname" binding:"required,max=253"`
+}
+
+type DomainResponse struct {
+	*model.Domain
+	Verified              bool   `json:"verified"`
+	VerificationRecord    string `json:"verification_record"`
+	VerificationTXTRecord string `json:"verification_txt_record"`
+}
@@ -1,8 +1,124 @@
 package dto
 
+import (
+	common_constants "github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"time"
+)
+
+// RedirectURL is what a redirect needs of a link, and what the short code cache holds. It carries a
+// fingerprint of the password instead of the password hash.
+type RedirectURL struct {
+	ID                  uint                          `json:"id"`
+	DomainID            uint                          `json:"domain_id"`
+	ShortCode           string                        `json:"short_code"`
+	LongURL             string                        `json:"long_url"`
+	IsProtected         bool                          `json:"is_protected"`
+	PasswordFingerprint string                        `json:"password_fingerprint,omitempty"`
+	RedirectType        common_constants.RedirectType `json:"redirect_type"`
+	Clicks              int64                         `json:"clicks"`
+	ExpiresAt           *time.Time                    `json:"expires_at"`
+	MaxClicks           *int64                        `json:"max_clicks"`
+	ExpiredAt           *time.Time                    `json:"expired_at"`
+	DisabledAt          *time.Time                    `json:"disabled_at"`
+}
+
+func NewRedirectURL(url *model.URL) *RedirectURL {
+	redirectURL := &RedirectURL{
+		ID:           url.ID,
+		DomainID:     url.DomainID,
+		ShortCode:    url.ShortCode,
+		LongURL:      url.LongURL,
+		IsProtected:  url.IsProtected,
+		RedirectType: url.RedirectType,
+		Clicks:       url.Clicks,
+		ExpiresAt:    url.ExpiresAt,
+		MaxClicks:    url.MaxClicks,
+		ExpiredAt:    url.ExpiredAt,
+		DisabledAt:   url.DisabledAt,
+	}
+	if url.IsProtected {
+		redirectURL.PasswordFingerprint = url.PasswordFingerprint()
+	}
+	return redirectURL
+}
+
+// CreateShortURLRequest creates a link that never expires unless expires_days, expires_at
+// (mutually exclusive) or max_clicks is set
 type CreateShortURLRequest struct {
-	LongURL     string `json:"long_url" binding:"required,url"`
-	ExpiresDays int    `json:"expires_days" binding:"omitempty,min=0,max=30"`
-	Password    string `json:"password" binding:"omitempty,min=6,max=20"`
-	Alias       string `json:"alias" binding:"omitempty,min=6,max=20"`
+	LongURL        string     `json:"long_url" binding:"required,url"`
+	ExpiresDays    int        `json:"expires_days" binding:"omitempty,min=1,max=3650"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	MaxClicks      int64      `json:"max_clicks" binding:"omitempty,min=1"`
+	NotifyOnExpiry bool       `json:"notify_on_expiry"`
+	RedirectType   string     `json:"redirect_type" binding:"omitempty,oneof=301 302 307 308 interstitial"`
+	Password       string     `json:"password" binding:"omitempty,min=6,max=20"`
+	Alias          string     `json:"alias" binding:"omitempty,min=6,max=20"`
+	Domain         string     `json:"domain" binding:"omitempty,max=253"`
+}
+
+type UpdateShortURLRequest struct {
+	LongURL         *string    `json:"long_url" binding:"omitempty,url"`
+	ExpiresDays     *int       `json:"expires_days" binding:"omitempty,min=1,max=3650"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	RemoveExpiry    bool       `json:"remove_expiry"`
+	MaxClicks       *int64     `json:"max_clicks" binding:"omitempty,min=1"`
+	RemoveMaxClicks bool       `json:"remove_max_clicks"`
+	NotifyOnExpiry  *bool      `json:"notify_on_expiry"`
+	RedirectType    *string    `json:"redirect_type" binding:"omitempty,oneof=301 302 307 308 interstitial"`
+	Password        *string    `json:"password" binding:"omitempty,min=6,max=20"`
+	RemovePassword  bool       `json:"remove_password"`
+	Alias           *string    `json:"alias" binding:"omitempty,min=6,max=20"`
+}
+
+type ListURLsRequest struct {
+	Cursor      string    `form:"cursor"`
+	Limit       int       `form:"limit" binding:"omitempty,min=1,max=100"`
+	Status      string    `form:"status" binding:"omitempty,oneof=active expired disabled"`
+	Protected   *bool     `form:"protected"`
+	CreatedFrom time.Time `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo   time.Time `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	SortBy      string    `form:"sort_by" binding:"omitempty,oneof=created_at clicks expires_at"`
+	Order       string    `form:"order" binding:"omitempty,oneof=asc desc"`
+	Search      string    `form:"q" binding:"omitempty,max=200"`
+}
+
+type AliasAvailabilityRequest struct {
+	Alias  string `form:"alias" binding:"required,min=6,max=20"`
+	Domain string `form:"domain" binding:"omitempty,max=253"`
+}
+
+type AliasAvailabilityResponse struct {
+	Alias     string `json:"alias"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type URLStatsRequest struct {
+	Bucket string    `form:"bucket" binding:"omitempty,oneof=hour day week"`
+	From   time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit  int       `form:"limit" binding:"omitempty,min=1,max=50"`
+}
+
+type URLStatsResponse struct {
+	ShortCode     string                      `json:"short_code"`
+	ShortURL      string                      `json:"short_url"`
+	TotalClicks   int64                       `json:"total_clicks"`
+	Bucket        string                      `json:"bucket"`
+	From          time.Time                   `json:"from"`
+	To            time.Time                   `json:"to"`
+	Clicks        []model.ClickBucketCount    `json:"clicks"`
+	TopReferrers  []model.ClickDimensionCount `json:"top_referrers"`
+	TopUserAgents []model.ClickDimensionCount `json:"top_user_agents"`
+}
+
+type QRCodeRequest struct {
+	Size       int    `form:"size" binding:"omitempty,min=64,max=4096"`
+	Level      string `form:"level" binding:"omitempty,oneof=L M Q H l m q h"`
+	Foreground string `form:"fg" binding:"omitempty,max=9"`
+	Background string `form:"bg" binding:"omitempty,max=9"`
+	QuietZone  *int   `form:"quiet_zone" binding:"omitempty,min=0,max=20"`
+	Format     string `form:"format" binding:"omitempty,oneof=png svg"`
+	Raw        bool   `form:"raw"`
 }
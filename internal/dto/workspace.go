@@ -0,0 +1,43 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+)
+
+type CreateWorkspaceRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+type UpdateWorkspaceRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+type WorkspaceResponse struct {
+	*model.Workspace
+	Personal bool                           `json:"personal"`
+	Role     common_constants.WorkspaceRole `json:"role"` // role of the caller
+}
+
+type InviteWorkspaceMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=owner editor viewer"`
+}
+
+type AcceptWorkspaceInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type UpdateWorkspaceMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner editor viewer"`
+}
+
+type WorkspaceMemberResponse struct {
+	UserID   uint                           `json:"user_id"`
+	Email    string                         `json:"email"`
+	Name     string                         `json:"name"`
+	Role     common_constants.WorkspaceRole `json:"role"`
+	JoinedAt time.Time                      `json:"joined_at"`
+}
@@ -0,0 +1,389 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/dto"
+	"github.com/nikhil/url-shortner-backend/internal/service"
+	"github.com/nikhil/url-shortner-backend/internal/service/email_service"
+	"github.com/nikhil/url-shortner-backend/internal/utils"
+)
+
+type AdminHandler struct {
+	adminService *service.AdminService
+}
+
+func NewAdminHandler(adminService *service.AdminService) *AdminHandler {
+	return &AdminHandler{
+		adminService: adminService,
+	}
+}
+
+func (h *AdminHandler) ListUsers(ctx *gin.Context) {
+	var listUsersRequest dto.AdminListUsersRequest
+	if err := ctx.ShouldBindQuery(&listUsersRequest); err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid query parameters").
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+
+	users, pagination, err := h.adminService.ListUsers(ctx, &listUsersRequest)
+	if err != nil {
+		h.respondAdminError(ctx, err, "Failed to fetch users")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Users fetched successfully").
+		SetErrorCode("").
+		SetData(users).
+		SetMeta(pagination).
+		Build(ctx)
+}
+
+func (h *AdminHandler) GetUser(ctx *gin.Context) {
+	userID, ok := h.idParam(ctx, "Invalid user id")
+	if !ok {
+		return
+	}
+
+	user, err := h.adminService.GetUser(ctx, userID)
+	if err != nil {
+		h.respondAdminError(ctx, err, "Failed to fetch user")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("User fetched successfully").
+		SetErrorCode("").
+		SetData(user).
+		Build(ctx)
+}
+
+func (h *AdminHandler) DisableUser(ctx *gin.Context) {
+	userID, ok := h.idParam(ctx, "Invalid user id")
+	if !ok {
+		return
+	}
+
+	user, err := h.adminService.DisableUser(ctx, ctx.GetUint("user_id"), userID)
+	if err != nil {
+		h.respondAdminError(ctx, err, "Failed to disable user")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("User disabled successfully").
+		SetErrorCode("").
+		SetData(user).
+		Build(ctx)
+}
+
+func (h *AdminHandler) EnableUser(ctx *gin.Context) {
+	userID, ok := h.idParam(ctx, "Invalid user id")
+	if !ok {
+		return
+	}
+
+	user, err := h.adminService.EnableUser(ctx, ctx.GetUint("user_id"), userID)
+	if err != nil {
+		h.respondAdminError(ctx, err, "Failed to enable user")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("User enabled successfully").
+		SetErrorCode("").
+		SetData(user).
+		Build(ctx)
+}
+
+func (h *AdminHandler) LogoutUser(ctx *gin.Context) {
+	userID, ok := h.idParam(ctx, "Invalid user id")
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.LogoutUser(ctx, ctx.GetUint("user_id"), userID); err != nil {
+		h.respondAdminError(ctx, err, "Failed to log out user")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("User logged out of every session").
+		SetErrorCode("").
+		SetData(nil).
+		Build(ctx)
+}
+
+func (h *AdminHandler) ListUserURLs(ctx *gin.Context) {
+	userID, ok := h.idParam(ctx, "Invalid user id")
+	if !ok {
+		return
+	}
+	var listURLsRequest dto.ListURLsRequest
+	if err := ctx.ShouldBindQuery(&listURLsRequest); err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid query parameters").
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+
+	urls, pagination, err := h.adminService.ListUserURLs(ctx, userID, &listURLsRequest)
+	if err != nil {
+		h.respondAdminError(ctx, err, "Failed to fetch user URLs")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("User URLs fetched successfully").
+		SetErrorCode("").
+		SetData(urls).
+		SetMeta(pagination).
+		Build(ctx)
+}
+
+func (h *AdminHandler) DisableURL(ctx *gin.Context) {
+	h.setURLDisabled(ctx, true, "URL disabled successfully")
+}
+
+func (h *AdminHandler) EnableURL(ctx *gin.Context) {
+	h.setURLDisabled(ctx, false, "URL enabled successfully")
+}
+
+func (h *AdminHandler) setURLDisabled(ctx *gin.Context, disabled bool, message string) {
+	urlID, ok := h.idParam(ctx, "Invalid url id")
+	if !ok {
+		return
+	}
+
+	url, err := h.adminService.SetURLDisabled(ctx, ctx.GetUint("user_id"), urlID, disabled)
+	if err != nil {
+		h.respondAdminError(ctx, err, "Failed to update URL")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage(message).
+		SetErrorCode("").
+		SetData(url).
+		Build(ctx)
+}
+
+func (h *AdminHandler) ListRolePolicies(ctx *gin.Context) {
+	policies, err := h.adminService.ListRolePolicies(ctx)
+	if err != nil {
+		h.respondAdminError(ctx, err, "Failed to fetch role policies")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Role policies fetched successfully").
+		SetErrorCode("").
+		SetData(policies).
+		Build(ctx)
+}
+
+func (h *AdminHandler) UpdateRolePolicy(ctx *gin.Context) {
+	var updateRolePolicyRequest dto.UpdateRolePolicyRequest
+	if err := ctx.ShouldBindJSON(&updateRolePolicyRequest); err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid request body").
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+
+	role := common_constants.UserRole(ctx.Param("role"))
+	policy, err := h.adminService.UpdateRolePolicy(ctx, ctx.GetUint("user_id"), role, &updateRolePolicyRequest)
+	if err != nil {
+		h.respondAdminError(ctx, err, "Failed to update role policy")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Role policy updated successfully").
+		SetErrorCode("").
+		SetData(policy).
+		Build(ctx)
+}
+
+func (h *AdminHandler) ListEmails(ctx *gin.Context) {
+	var listEmailsRequest dto.AdminListEmailsRequest
+	if err := ctx.ShouldBindQuery(&listEmailsRequest); err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid query parameters").
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+
+	emails, pagination, err := h.adminService.ListEmails(ctx, &listEmailsRequest)
+	if err != nil {
+		h.respondAdminError(ctx, err, "Failed to fetch emails")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Emails fetched successfully").
+		SetErrorCode("").
+		SetData(emails).
+		SetMeta(pagination).
+		Build(ctx)
+}
+
+func (h *AdminHandler) GetEmail(ctx *gin.Context) {
+	emailID, ok := h.idParam(ctx, "Invalid email id")
+	if !ok {
+		return
+	}
+
+	email, err := h.adminService.GetEmail(ctx, emailID)
+	if err != nil {
+		h.respondAdminError(ctx, err, "Failed to fetch email")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Email fetched successfully").
+		SetErrorCode("").
+		SetData(email).
+		Build(ctx)
+}
+
+func (h *AdminHandler) ResendEmail(ctx *gin.Context) {
+	emailID, ok := h.idParam(ctx, "Invalid email id")
+	if !ok {
+		return
+	}
+
+	email, err := h.adminService.ResendEmail(ctx, ctx.GetUint("user_id"), emailID)
+	if err != nil {
+		h.respondAdminError(ctx, err, "Failed to resend email")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Email queued for sending").
+		SetErrorCode("").
+		SetData(email).
+		Build(ctx)
+}
+
+func (h *AdminHandler) ListEmailTemplates(ctx *gin.Context) {
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Email templates fetched successfully").
+		SetErrorCode("").
+		SetData(h.adminService.ListEmailTemplates(ctx)).
+		Build(ctx)
+}
+
+// PreviewEmailTemplate renders a template with sample data, as JSON or as the raw html or text part
+func (h *AdminHandler) PreviewEmailTemplate(ctx *gin.Context) {
+	var previewRequest dto.EmailTemplatePreviewRequest
+	if err := ctx.ShouldBindQuery(&previewRequest); err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid query parameters").
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+
+	email, err := h.adminService.PreviewEmailTemplate(ctx, ctx.Param("name"), previewRequest.Locale)
+	if errors.Is(err, email_service.ErrUnknownTemplate) {
+		h.respondAdminError(ctx, err, "Failed to render email template")
+		return
+	}
+	if err != nil {
+		// Broken overrides are reported to whoever is editing them
+		utils.NewResponse().
+			SetStatus(http.StatusUnprocessableEntity).
+			SetMessage(err.Error()).
+			SetErrorCode("TEMPLATE_ERROR").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+
+	switch previewRequest.Format {
+	case "html":
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(email.HTML))
+	case "text":
+		ctx.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(email.Text))
+	default:
+		utils.NewResponse().
+			SetStatus(http.StatusOK).
+			SetMessage("Email template rendered successfully").
+			SetErrorCode("").
+			SetData(email).
+			Build(ctx)
+	}
+}
+
+func (h *AdminHandler) idParam(ctx *gin.Context, message string) (uint, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage(message).
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondAdminError maps admin service errors to API responses
+func (h *AdminHandler) respondAdminError(ctx *gin.Context, err error, message string) {
+	status, errorCode := http.StatusInternalServerError, "INTERNAL_ERROR"
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrURLNotFound), errors.Is(err, service.ErrUnknownRole),
+		errors.Is(err, service.ErrEmailNotFound):
+		status, errorCode, message = http.StatusNotFound, "NOT_FOUND", err.Error()
+	case errors.Is(err, service.ErrCannotDisableSelf), errors.Is(err, service.ErrCannotDisableAdmin):
+		status, errorCode, message = http.StatusConflict, "CANNOT_DISABLE", err.Error()
+	case errors.Is(err, service.ErrEmailNotDead):
+		status, errorCode, message = http.StatusConflict, "EMAIL_NOT_DEAD", err.Error()
+	case errors.Is(err, service.ErrInvalidCursor):
+		status, errorCode, message = http.StatusBadRequest, "BAD_REQUEST", err.Error()
+	case errors.Is(err, email_service.ErrUnknownTemplate):
+		status, errorCode, message = http.StatusNotFound, "NOT_FOUND", err.Error()
+	}
+	utils.NewResponse().
+		SetStatus(status).
+		SetMessage(message).
+		SetErrorCode(errorCode).
+		SetData(nil).
+		Build(ctx)
+}
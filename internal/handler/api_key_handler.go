@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/internal/dto"
+	"github.com/nikhil/url-shortner-backend/internal/service"
+	"github.com/nikhil/url-shortner-backend/internal/utils"
+)
+
+type APIKeyHandler struct {
+	apiKeyService *service.APIKeyService
+}
+
+func NewAPIKeyHandler(apiKeyService *service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+	}
+}
+
+func (h *APIKeyHandler) CreateAPIKey(ctx *gin.Context) {
+	var createAPIKeyRequest dto.CreateAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&createAPIKeyRequest); err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid request payload").
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	apiKey, err := h.apiKeyService.CreateAPIKey(ctx, userID, &createAPIKeyRequest)
+	if err != nil {
+		h.respondAPIKeyError(ctx, err, "Failed to create api key")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusCreated).
+		SetMessage("API key created, store it now as it won't be shown again").
+		SetErrorCode("").
+		SetData(apiKey).
+		Build(ctx)
+}
+
+func (h *APIKeyHandler) ListAPIKeys(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+	apiKeys, err := h.apiKeyService.ListAPIKeys(ctx, userID)
+	if err != nil {
+		h.respondAPIKeyError(ctx, err, "Failed to fetch api keys")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("API keys fetched successfully").
+		SetErrorCode("").
+		SetData(apiKeys).
+		Build(ctx)
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(ctx *gin.Context) {
+	apiKeyID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid api key id").
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	if err = h.apiKeyService.RevokeAPIKey(ctx, userID, uint(apiKeyID)); err != nil {
+		h.respondAPIKeyError(ctx, err, "Failed to revoke api key")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("API key revoked successfully").
+		SetErrorCode("").
+		SetData(nil).
+		Build(ctx)
+}
+
+// respondAPIKeyError maps api key service errors to API responses
+func (h *APIKeyHandler) respondAPIKeyError(ctx *gin.Context, err error, message string) {
+	status, errorCode := http.StatusInternalServerError, "INTERNAL_ERROR"
+	switch {
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		status, errorCode, message = http.StatusNotFound, "NOT_FOUND", err.Error()
+	case errors.Is(err, service.ErrInvalidAPIKeyScope):
+		status, errorCode, message = http.StatusBadRequest, "INVALID_SCOPE", err.Error()
+	case errors.Is(err, service.ErrTooManyAPIKeys):
+		status, errorCode, message = http.StatusConflict, "API_KEY_LIMIT_REACHED", err.Error()
+	}
+	utils.NewResponse().
+		SetStatus(status).
+		SetMessage(message).
+		SetErrorCode(errorCode).
+		SetData(nil).
+		Build(ctx)
+}
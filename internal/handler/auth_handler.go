@@ -1,10 +1,15 @@
 package handler
 
 import (
+	"errors"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
 	"github.com/nikhil/url-shortner-backend/internal/dto"
 	"github.com/nikhil/url-shortner-backend/internal/service"
 	"github.com/nikhil/url-shortner-backend/internal/service/otp_service"
@@ -38,6 +43,9 @@ func (h *AuthHandler) SignUp(c *gin.Context) {
 	}
 
 	user, err := h.authService.SignUp(c, &signUpReq)
+	if h.respondOTPError(c, err) {
+		return
+	}
 	if err != nil {
 		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage(err.Error()).SetErrorCode("INTERNAL_ERROR").Build(c)
 		return
@@ -54,6 +62,9 @@ func (h *AuthHandler) VerifyRegistrationOTP(c *gin.Context) {
 	}
 
 	err := h.authService.RegisterUser(c, verifyRegistrationOTPRequest.Email, verifyRegistrationOTPRequest.OTP)
+	if h.respondOTPError(c, err) {
+		return
+	}
 	if err != nil {
 		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage(err.Error()).SetErrorCode("INTERNAL_ERROR").Build(c)
 		return
@@ -68,15 +79,160 @@ func (h *AuthHandler) Login(ctx *gin.Context) {
 		return
 	}
 
-	token, err := h.authService.Login(ctx, loginRequest.Email, loginRequest.Password)
+	token, err := h.authService.Login(ctx, loginRequest.Email, loginRequest.Password, loginRequest.DeviceName)
+	if h.respondLoginThrottled(ctx, err) {
+		return
+	}
+	if errors.Is(err, service.ErrAccountDisabled) {
+		utils.NewResponse().SetStatus(http.StatusForbidden).SetMessage("Account has been disabled").SetErrorCode("ACCOUNT_DISABLED").Build(ctx)
+		return
+	}
 	if err != nil {
 		utils.NewResponse().SetStatus(http.StatusUnauthorized).SetMessage("Unauthorized").SetErrorCode("UNAUTHORIZED").Build(ctx)
 		return
 	}
+	h.respondLogin(ctx, token)
+}
+
+// respondLogin answers a login with its tokens, or with the challenge of its second factor
+func (h *AuthHandler) respondLogin(ctx *gin.Context, token *dto.LoginResponse) {
+	if token.ChallengeToken != "" {
+		data := map[string]interface{}{"challenge_token": token.ChallengeToken, "two_factor_setup_required": token.TwoFactorSetupRequired}
+		utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Two-factor authentication required").SetData(data).Build(ctx)
+		return
+	}
 	h.setSecureCookie(ctx, "refresh_token", token.RefreshToken, 7*24*60*60, os.Getenv("ENV"))
 	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Login successful").SetData(map[string]string{"access_token": token.AccessToken}).Build(ctx)
 }
 
+// RequestLoginCode sends a sign in code over the user's OTP channel. The answer is the same whether
+// the email belongs to an account or not.
+func (h *AuthHandler) RequestLoginCode(ctx *gin.Context) {
+	var loginCodeRequest dto.LoginCodeRequest
+	if err := ctx.ShouldBindJSON(&loginCodeRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+	err := h.authService.RequestLoginCode(ctx, loginCodeRequest.Email)
+	if h.respondLoginThrottled(ctx, err) {
+		return
+	}
+	if err != nil {
+		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage("Something went wrong").SetErrorCode("INTERNAL_ERROR").Build(ctx)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("If the email belongs to an account, a sign in code has been sent").Build(ctx)
+}
+
+// LoginWithCode exchanges a sign in code for a session, or for the challenge of a second factor
+func (h *AuthHandler) LoginWithCode(ctx *gin.Context) {
+	var loginWithCodeRequest dto.LoginWithCodeRequest
+	if err := ctx.ShouldBindJSON(&loginWithCodeRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+	token, err := h.authService.LoginWithCode(ctx, loginWithCodeRequest.Email, loginWithCodeRequest.OTP, loginWithCodeRequest.DeviceName)
+	if h.respondLoginThrottled(ctx, err) || h.respondOTPError(ctx, err) {
+		return
+	}
+	if errors.Is(err, service.ErrAccountDisabled) {
+		utils.NewResponse().SetStatus(http.StatusForbidden).SetMessage("Account has been disabled").SetErrorCode("ACCOUNT_DISABLED").Build(ctx)
+		return
+	}
+	if err != nil {
+		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage("Something went wrong").SetErrorCode("INTERNAL_ERROR").Build(ctx)
+		return
+	}
+	h.respondLogin(ctx, token)
+}
+
+// RequestMagicLink emails a sign in link and keeps the nonce binding it to this browser in a cookie.
+// The answer is the same whether the email belongs to an account or not.
+func (h *AuthHandler) RequestMagicLink(ctx *gin.Context) {
+	var magicLinkRequest dto.MagicLinkRequest
+	if err := ctx.ShouldBindJSON(&magicLinkRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+
+	nonce, _ := ctx.Cookie(common_constants.MagicLinkNonceCookie)
+	nonce, err := h.authService.RequestMagicLink(ctx, magicLinkRequest.Email, nonce)
+	if h.respondLoginThrottled(ctx, err) {
+		return
+	}
+	if err != nil {
+		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage("Something went wrong").SetErrorCode("INTERNAL_ERROR").Build(ctx)
+		return
+	}
+	h.setSecureCookie(ctx, common_constants.MagicLinkNonceCookie, nonce, int(common_constants.MagicLinkTTL/time.Second), os.Getenv("ENV"))
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("If an account exists for this email, a sign in link has been sent to it").Build(ctx)
+}
+
+// LoginWithMagicLink exchanges a magic link for a session. The token comes from the query when the
+// link is opened directly, or from the JSON body when a frontend page posts it.
+func (h *AuthHandler) LoginWithMagicLink(ctx *gin.Context) {
+	var magicLinkLoginRequest dto.MagicLinkLoginRequest
+	if err := ctx.ShouldBind(&magicLinkLoginRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+
+	nonce, _ := ctx.Cookie(common_constants.MagicLinkNonceCookie)
+	token, err := h.authService.LoginWithMagicLink(ctx, magicLinkLoginRequest.Token, nonce, magicLinkLoginRequest.DeviceName)
+	switch {
+	case errors.Is(err, service.ErrMagicLinkWrongBrowser):
+		utils.NewResponse().SetStatus(http.StatusUnauthorized).SetMessage("Open the link in the browser you requested it from").SetErrorCode("MAGIC_LINK_WRONG_BROWSER").Build(ctx)
+		return
+	case errors.Is(err, service.ErrInvalidMagicLink):
+		utils.NewResponse().SetStatus(http.StatusUnauthorized).SetMessage("The link is invalid, expired or has already been used").SetErrorCode("INVALID_MAGIC_LINK").Build(ctx)
+		return
+	case errors.Is(err, service.ErrAccountDisabled):
+		utils.NewResponse().SetStatus(http.StatusForbidden).SetMessage("Account has been disabled").SetErrorCode("ACCOUNT_DISABLED").Build(ctx)
+		return
+	case err != nil:
+		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage("Something went wrong").SetErrorCode("INTERNAL_ERROR").Build(ctx)
+		return
+	}
+	h.respondLogin(ctx, token)
+}
+
+// LoginTwoFactor exchanges the challenge token of a login and a TOTP or recovery code for a session
+func (h *AuthHandler) LoginTwoFactor(ctx *gin.Context) {
+	var twoFactorLoginRequest dto.TwoFactorLoginRequest
+	if err := ctx.ShouldBindJSON(&twoFactorLoginRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+
+	token, err := h.authService.LoginTwoFactor(ctx, twoFactorLoginRequest.ChallengeToken, twoFactorLoginRequest.Code, twoFactorLoginRequest.DeviceName)
+	if err != nil {
+		h.respondTwoFactorError(ctx, err)
+		return
+	}
+	data := map[string]interface{}{"access_token": token.AccessToken}
+	if len(token.RecoveryCodes) > 0 {
+		data["recovery_codes"] = token.RecoveryCodes
+	}
+	h.setSecureCookie(ctx, "refresh_token", token.RefreshToken, 7*24*60*60, os.Getenv("ENV"))
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Login successful").SetData(data).Build(ctx)
+}
+
+// EnrollTwoFactorChallenge starts the enrollment required by the role of a user logging in
+func (h *AuthHandler) EnrollTwoFactorChallenge(ctx *gin.Context) {
+	var twoFactorChallengeRequest dto.TwoFactorChallengeRequest
+	if err := ctx.ShouldBindJSON(&twoFactorChallengeRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+
+	enrollment, err := h.authService.EnrollTwoFactorChallenge(ctx, twoFactorChallengeRequest.ChallengeToken)
+	if err != nil {
+		h.respondTwoFactorError(ctx, err)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Scan the QR code and log in with a code of your authenticator").SetData(enrollment).Build(ctx)
+}
+
 func (h *AuthHandler) RefreshToken(ctx *gin.Context) {
 	refreshToken, err := ctx.Cookie("refresh_token")
 	if err != nil {
@@ -84,23 +240,30 @@ func (h *AuthHandler) RefreshToken(ctx *gin.Context) {
 		return
 	}
 	refreshTokenResponse, err := h.authService.RefreshToken(ctx, refreshToken)
+	if errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+		h.setSecureCookie(ctx, "refresh_token", "", -1, os.Getenv("ENV"))
+		utils.NewResponse().SetStatus(http.StatusUnauthorized).SetMessage("Invalid refresh token").SetErrorCode("UNAUTHORIZED").Build(ctx)
+		return
+	}
+	// The cookie is kept: the concurrent refresh that won has set a new one in its response
+	if errors.Is(err, service.ErrRefreshConflict) {
+		utils.NewResponse().SetStatus(http.StatusConflict).SetMessage("Session was refreshed by another request").SetErrorCode("REFRESH_CONFLICT").Build(ctx)
+		return
+	}
 	if err != nil {
 		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage("Something went wrong").SetErrorCode("INTERNAL_ERROR").Build(ctx)
 		return
 	}
+	h.setSecureCookie(ctx, "refresh_token", refreshTokenResponse.RefreshToken, 7*24*60*60, os.Getenv("ENV"))
 	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Token refreshed successfully").SetData(refreshTokenResponse).Build(ctx)
 }
 
 func (h *AuthHandler) Logout(ctx *gin.Context) {
-	refreshToken, err := ctx.Cookie("refresh_token")
-	if err != nil {
-		utils.NewResponse().SetStatus(http.StatusUnauthorized).SetMessage("Missing refresh token").SetErrorCode("UNAUTHORIZED").Build(ctx)
-		return
-	}
-	if err = h.authService.Logout(ctx, refreshToken); err != nil {
+	if err := h.authService.Logout(ctx, ctx.GetUint("user_id"), ctx.GetString("session_id")); err != nil {
 		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage("Something went wrong").SetErrorCode("INTERNAL_ERROR").Build(ctx)
 		return
 	}
+	h.setSecureCookie(ctx, "refresh_token", "", -1, os.Getenv("ENV"))
 	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Successfully logged out").Build(ctx)
 }
 
@@ -110,7 +273,11 @@ func (h *AuthHandler) ForgotPassword(ctx *gin.Context) {
 		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
 		return
 	}
-	if err := h.authService.ForgotPassword(ctx, forgotPasswordRequest.Email); err != nil {
+	err := h.authService.ForgotPassword(ctx, forgotPasswordRequest.Email)
+	if h.respondOTPError(ctx, err) {
+		return
+	}
+	if err != nil {
 		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage("Something went wrong").SetErrorCode("INTERNAL_ERROR").Build(ctx)
 		return
 	}
@@ -123,9 +290,323 @@ func (h *AuthHandler) ResetPassword(ctx *gin.Context) {
 		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
 		return
 	}
-	if err := h.authService.ResetPassword(ctx, resetPasswordRequest.Email, resetPasswordRequest.OTP, resetPasswordRequest.NewPassword); err != nil {
+	err := h.authService.ResetPassword(ctx, resetPasswordRequest.Email, resetPasswordRequest.OTP, resetPasswordRequest.NewPassword)
+	if h.respondOTPError(ctx, err) {
+		return
+	}
+	if err != nil {
 		utils.NewResponse().SetStatus(http.StatusUnauthorized).SetMessage("Something went wrong").SetErrorCode("UNAUTHORIZED").Build(ctx)
 		return
 	}
 	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Password reset successful").Build(ctx)
 }
+
+func (h *AuthHandler) RequestAccountUnlock(ctx *gin.Context) {
+	var requestAccountUnlockRequest dto.RequestAccountUnlockRequest
+	if err := ctx.ShouldBindJSON(&requestAccountUnlockRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+	err := h.authService.RequestAccountUnlock(ctx, requestAccountUnlockRequest.Email)
+	if h.respondOTPError(ctx, err) {
+		return
+	}
+	if err != nil {
+		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage("Something went wrong").SetErrorCode("INTERNAL_ERROR").Build(ctx)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("If the account is locked, an OTP has been sent").Build(ctx)
+}
+
+func (h *AuthHandler) UnlockAccount(ctx *gin.Context) {
+	var unlockAccountRequest dto.UnlockAccountRequest
+	if err := ctx.ShouldBindJSON(&unlockAccountRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+	err := h.authService.UnlockAccount(ctx, unlockAccountRequest.Email, unlockAccountRequest.OTP)
+	if h.respondOTPError(ctx, err) {
+		return
+	}
+	if err != nil {
+		utils.NewResponse().SetStatus(http.StatusUnauthorized).SetMessage("Invalid OTP").SetErrorCode("UNAUTHORIZED").Build(ctx)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Account unlocked").Build(ctx)
+}
+
+// ResendOTP sends a new code of a pending signup, password reset or account unlock
+func (h *AuthHandler) ResendOTP(ctx *gin.Context) {
+	var sendOTPRequest dto.SendOTPRequest
+	if err := ctx.ShouldBindJSON(&sendOTPRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+	err := h.authService.ResendOTP(ctx, common_constants.OTPPurpose(sendOTPRequest.Purpose), sendOTPRequest.Email)
+	if h.respondLoginThrottled(ctx, err) || h.respondOTPError(ctx, err) {
+		return
+	}
+	if err != nil {
+		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage("Something went wrong").SetErrorCode("INTERNAL_ERROR").Build(ctx)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("If a code is pending for this email, a new one has been sent").Build(ctx)
+}
+
+func (h *AuthHandler) ListSessions(ctx *gin.Context) {
+	sessions, err := h.authService.ListSessions(ctx, ctx.GetUint("user_id"), ctx.GetString("session_id"))
+	if err != nil {
+		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage("Something went wrong").SetErrorCode("INTERNAL_ERROR").Build(ctx)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Sessions fetched successfully").SetData(sessions).Build(ctx)
+}
+
+func (h *AuthHandler) RevokeSession(ctx *gin.Context) {
+	err := h.authService.RevokeSession(ctx, ctx.GetUint("user_id"), ctx.Param("id"))
+	if errors.Is(err, service.ErrSessionNotFound) {
+		utils.NewResponse().SetStatus(http.StatusNotFound).SetMessage("Session not found").SetErrorCode("NOT_FOUND").Build(ctx)
+		return
+	}
+	if err != nil {
+		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage("Something went wrong").SetErrorCode("INTERNAL_ERROR").Build(ctx)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Session revoked").Build(ctx)
+}
+
+// RevokeAllSessions logs the user out of every device, including the current one
+func (h *AuthHandler) RevokeAllSessions(ctx *gin.Context) {
+	if err := h.authService.RevokeAllSessions(ctx, ctx.GetUint("user_id")); err != nil {
+		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage("Something went wrong").SetErrorCode("INTERNAL_ERROR").Build(ctx)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Logged out of all sessions").Build(ctx)
+}
+
+func (h *AuthHandler) GetTwoFactorStatus(ctx *gin.Context) {
+	status, err := h.authService.GetTwoFactorStatus(ctx, ctx.GetUint("user_id"))
+	if err != nil {
+		h.respondTwoFactorError(ctx, err)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Two-factor status fetched successfully").SetData(status).Build(ctx)
+}
+
+func (h *AuthHandler) EnrollTwoFactor(ctx *gin.Context) {
+	enrollment, err := h.authService.EnrollTwoFactor(ctx, ctx.GetUint("user_id"))
+	if err != nil {
+		h.respondTwoFactorError(ctx, err)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Scan the QR code and confirm with a code of your authenticator").SetData(enrollment).Build(ctx)
+}
+
+func (h *AuthHandler) ConfirmTwoFactor(ctx *gin.Context) {
+	var twoFactorCodeRequest dto.TwoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&twoFactorCodeRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+	recoveryCodes, err := h.authService.ConfirmTwoFactor(ctx, ctx.GetUint("user_id"), twoFactorCodeRequest.Code)
+	if err != nil {
+		h.respondTwoFactorError(ctx, err)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Two-factor authentication enabled").SetData(&dto.RecoveryCodesResponse{RecoveryCodes: recoveryCodes}).Build(ctx)
+}
+
+func (h *AuthHandler) DisableTwoFactor(ctx *gin.Context) {
+	var twoFactorCodeRequest dto.TwoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&twoFactorCodeRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+	if err := h.authService.DisableTwoFactor(ctx, ctx.GetUint("user_id"), twoFactorCodeRequest.Code); err != nil {
+		h.respondTwoFactorError(ctx, err)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Two-factor authentication disabled").Build(ctx)
+}
+
+func (h *AuthHandler) RegenerateRecoveryCodes(ctx *gin.Context) {
+	var twoFactorCodeRequest dto.TwoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&twoFactorCodeRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+	recoveryCodes, err := h.authService.RegenerateRecoveryCodes(ctx, ctx.GetUint("user_id"), twoFactorCodeRequest.Code)
+	if err != nil {
+		h.respondTwoFactorError(ctx, err)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Recovery codes regenerated").SetData(&dto.RecoveryCodesResponse{RecoveryCodes: recoveryCodes}).Build(ctx)
+}
+
+func (h *AuthHandler) UpdateLocale(ctx *gin.Context) {
+	var updateLocaleRequest dto.UpdateLocaleRequest
+	if err := ctx.ShouldBindJSON(&updateLocaleRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid locale").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+	locale, err := h.authService.UpdateLocale(ctx, ctx.GetUint("user_id"), updateLocaleRequest.Locale)
+	if err != nil {
+		utils.NewResponse().SetStatus(http.StatusInternalServerError).SetMessage("Failed to update locale").SetErrorCode("INTERNAL_ERROR").Build(ctx)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Locale updated successfully").SetData(locale).Build(ctx)
+}
+
+func (h *AuthHandler) GetOTPPreference(ctx *gin.Context) {
+	preference, err := h.authService.GetOTPPreference(ctx, ctx.GetUint("user_id"))
+	if err != nil {
+		h.respondOTPPreferenceError(ctx, err)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("OTP preference fetched successfully").SetData(preference).Build(ctx)
+}
+
+func (h *AuthHandler) UpdateOTPPreference(ctx *gin.Context) {
+	var updateOTPPreferenceRequest dto.UpdateOTPPreferenceRequest
+	if err := ctx.ShouldBindJSON(&updateOTPPreferenceRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+	preference, err := h.authService.UpdateOTPPreference(ctx, ctx.GetUint("user_id"), &updateOTPPreferenceRequest)
+	if err != nil {
+		h.respondOTPPreferenceError(ctx, err)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("OTP preference updated successfully").SetData(preference).Build(ctx)
+}
+
+// SendOTPChangeCode sends a code over the current channel, which confirms moving codes elsewhere
+func (h *AuthHandler) SendOTPChangeCode(ctx *gin.Context) {
+	if err := h.authService.SendOTPChangeCode(ctx, ctx.GetUint("user_id")); err != nil {
+		h.respondOTPPreferenceError(ctx, err)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("OTP sent over the current channel").Build(ctx)
+}
+
+func (h *AuthHandler) RegisterPhone(ctx *gin.Context) {
+	var registerPhoneRequest dto.RegisterPhoneRequest
+	if err := ctx.ShouldBindJSON(&registerPhoneRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid phone number, use the E.164 format").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+	preference, err := h.authService.RegisterPhone(ctx, ctx.GetUint("user_id"), &registerPhoneRequest)
+	if err != nil {
+		h.respondOTPPreferenceError(ctx, err)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("OTP sent to the phone number").SetData(preference).Build(ctx)
+}
+
+func (h *AuthHandler) VerifyPhone(ctx *gin.Context) {
+	var verifyPhoneRequest dto.VerifyPhoneRequest
+	if err := ctx.ShouldBindJSON(&verifyPhoneRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+	preference, err := h.authService.VerifyPhone(ctx, ctx.GetUint("user_id"), verifyPhoneRequest.OTP)
+	if err != nil {
+		h.respondOTPPreferenceError(ctx, err)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Phone number verified successfully").SetData(preference).Build(ctx)
+}
+
+func (h *AuthHandler) RemovePhone(ctx *gin.Context) {
+	var removePhoneRequest dto.RemovePhoneRequest
+	if err := ctx.ShouldBindJSON(&removePhoneRequest); err != nil {
+		utils.NewResponse().SetStatus(http.StatusBadRequest).SetMessage("Invalid request").SetErrorCode("BAD_REQUEST").Build(ctx)
+		return
+	}
+	preference, err := h.authService.RemovePhone(ctx, ctx.GetUint("user_id"), &removePhoneRequest)
+	if err != nil {
+		h.respondOTPPreferenceError(ctx, err)
+		return
+	}
+	utils.NewResponse().SetStatus(http.StatusOK).SetMessage("Phone number removed successfully").SetData(preference).Build(ctx)
+}
+
+// respondLoginThrottled answers locked accounts and throttled IPs, it reports whether err was one of them
+func (h *AuthHandler) respondLoginThrottled(ctx *gin.Context, err error) bool {
+	var throttledErr *service.LoginThrottledError
+	if !errors.As(err, &throttledErr) {
+		return false
+	}
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttledErr.RetryAfter().Seconds()))))
+	if errors.Is(err, service.ErrAccountLocked) {
+		utils.NewResponse().SetStatus(http.StatusLocked).SetMessage("Account is temporarily locked after too many failed logins").SetErrorCode("ACCOUNT_LOCKED").Build(ctx)
+		return true
+	}
+	utils.NewResponse().SetStatus(http.StatusTooManyRequests).SetMessage("Too many failed logins, try again later").SetErrorCode("TOO_MANY_ATTEMPTS").Build(ctx)
+	return true
+}
+
+// respondOTPError answers wrong, expired and too frequent OTPs, it reports whether err was one of them
+func (h *AuthHandler) respondOTPError(ctx *gin.Context, err error) bool {
+	var cooldownErr *otp_service.ResendCooldownError
+	switch {
+	case errors.As(err, &cooldownErr):
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(cooldownErr.RetryAfter().Seconds()))))
+		utils.NewResponse().SetStatus(http.StatusTooManyRequests).SetMessage("An OTP was sent recently, try again later").SetErrorCode("OTP_COOLDOWN").Build(ctx)
+	case errors.Is(err, otp_service.ErrTooManyOTPAttempts):
+		utils.NewResponse().SetStatus(http.StatusUnauthorized).SetMessage("Too many wrong OTPs, request a new one").SetErrorCode("OTP_ATTEMPTS_EXCEEDED").Build(ctx)
+	case errors.Is(err, otp_service.ErrInvalidOTP), errors.Is(err, otp_service.ErrOTPExpired):
+		utils.NewResponse().SetStatus(http.StatusUnauthorized).SetMessage("Invalid or expired OTP").SetErrorCode("INVALID_OTP").Build(ctx)
+	default:
+		return false
+	}
+	return true
+}
+
+// respondTwoFactorError maps two-factor errors to API responses
+func (h *AuthHandler) respondTwoFactorError(ctx *gin.Context, err error) {
+	if h.respondLoginThrottled(ctx, err) {
+		return
+	}
+	status, errorCode, message := http.StatusInternalServerError, "INTERNAL_ERROR", "Something went wrong"
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		status, errorCode, message = http.StatusUnauthorized, "INVALID_CODE", err.Error()
+	case errors.Is(err, service.ErrInvalidChallenge):
+		status, errorCode, message = http.StatusUnauthorized, "UNAUTHORIZED", err.Error()
+	case errors.Is(err, service.ErrAccountDisabled):
+		status, errorCode, message = http.StatusForbidden, "ACCOUNT_DISABLED", "Account has been disabled"
+	case errors.Is(err, service.ErrTwoFactorRequired):
+		status, errorCode, message = http.StatusForbidden, "TWO_FACTOR_REQUIRED", err.Error()
+	case errors.Is(err, service.ErrTwoFactorAlreadyEnabled):
+		status, errorCode, message = http.StatusConflict, "TWO_FACTOR_ENABLED", err.Error()
+	case errors.Is(err, service.ErrTwoFactorNotEnabled), errors.Is(err, service.ErrTwoFactorNotEnrolled):
+		status, errorCode, message = http.StatusBadRequest, "TWO_FACTOR_NOT_ENABLED", err.Error()
+	}
+	utils.NewResponse().SetStatus(status).SetMessage(message).SetErrorCode(errorCode).Build(ctx)
+}
+
+// respondOTPPreferenceError maps OTP preference and phone verification errors to API responses
+func (h *AuthHandler) respondOTPPreferenceError(ctx *gin.Context, err error) {
+	if h.respondLoginThrottled(ctx, err) || h.respondOTPError(ctx, err) {
+		return
+	}
+	status, errorCode, message := http.StatusInternalServerError, "INTERNAL_ERROR", "Something went wrong"
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		status, errorCode, message = http.StatusNotFound, "NOT_FOUND", err.Error()
+	case errors.Is(err, service.ErrReauthenticationRequired):
+		status, errorCode, message = http.StatusUnauthorized, "REAUTHENTICATION_REQUIRED", err.Error()
+	case errors.Is(err, service.ErrInvalidCredentials):
+		status, errorCode, message = http.StatusUnauthorized, "INVALID_PASSWORD", "Incorrect password"
+	case errors.Is(err, service.ErrInvalidOTPChannel):
+		status, errorCode, message = http.StatusBadRequest, "CHANNEL_UNAVAILABLE", err.Error()
+	case errors.Is(err, service.ErrInvalidWebhookURL):
+		status, errorCode, message = http.StatusBadRequest, "INVALID_WEBHOOK_URL", err.Error()
+	case errors.Is(err, service.ErrPhoneNotVerified):
+		status, errorCode, message = http.StatusConflict, "PHONE_NOT_VERIFIED", err.Error()
+	case errors.Is(err, service.ErrNoPendingPhone):
+		status, errorCode, message = http.StatusConflict, "NO_PENDING_PHONE", err.Error()
+	}
+	utils.NewResponse().SetStatus(status).SetMessage(message).SetErrorCode(errorCode).Build(ctx)
+}
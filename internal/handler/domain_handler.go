@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/internal/dto"
+	"github.com/nikhil/url-shortner-backend/internal/service"
+	"github.com/nikhil/url-shortner-backend/internal/utils"
+)
+
+type DomainHandler struct {
+	domainService *service.DomainService
+}
+
+func NewDomainHandler(domainService *service.DomainService) *DomainHandler {
+	return &DomainHandler{
+		domainService: domainService,
+	}
+}
+
+func (h *DomainHandler) AddDomain(ctx *gin.Context) {
+	var addDomainRequest dto.AddDomainRequest
+	if err := ctx.ShouldBindJSON(&addDomainRequest); err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid request payload").
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	domain, err := h.domainService.AddDomain(ctx, userID, &addDomainRequest)
+	if err != nil {
+		h.respondDomainError(ctx, err, "Failed to add domain")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusCreated).
+		SetMessage("Domain added, publish the verification TXT record then verify it").
+		SetErrorCode("").
+		SetData(domain).
+		Build(ctx)
+}
+
+func (h *DomainHandler) ListDomains(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+	domains, err := h.domainService.ListDomains(ctx, userID)
+	if err != nil {
+		h.respondDomainError(ctx, err, "Failed to fetch domains")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Domains fetched successfully").
+		SetErrorCode("").
+		SetData(domains).
+		Build(ctx)
+}
+
+func (h *DomainHandler) VerifyDomain(ctx *gin.Context) {
+	domainID, ok := h.domainIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	domain, err := h.domainService.VerifyDomain(ctx, userID, domainID)
+	if err != nil {
+		h.respondDomainError(ctx, err, "Failed to verify domain")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Domain verified successfully").
+		SetErrorCode("").
+		SetData(domain).
+		Build(ctx)
+}
+
+func (h *DomainHandler) DeleteDomain(ctx *gin.Context) {
+	domainID, ok := h.domainIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	if err := h.domainService.DeleteDomain(ctx, userID, domainID); err != nil {
+		h.respondDomainError(ctx, err, "Failed to delete domain")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Domain deleted successfully").
+		SetErrorCode("").
+		SetData(nil).
+		Build(ctx)
+}
+
+func (h *DomainHandler) domainIDParam(ctx *gin.Context) (uint, bool) {
+	domainID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid domain id").
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return 0, false
+	}
+	return uint(domainID), true
+}
+
+// respondDomainError maps domain service errors to API responses
+func (h *DomainHandler) respondDomainError(ctx *gin.Context, err error, message string) {
+	status, errorCode := http.StatusInternalServerError, "INTERNAL_ERROR"
+	switch {
+	case errors.Is(err, service.ErrInvalidHostname):
+		status, errorCode, message = http.StatusBadRequest, "INVALID_HOSTNAME", err.Error()
+	case errors.Is(err, service.ErrDomainNotFound):
+		status, errorCode, message = http.StatusNotFound, "NOT_FOUND", err.Error()
+	case errors.Is(err, service.ErrDomainAlreadyExists):
+		status, errorCode, message = http.StatusConflict, "DOMAIN_CONFLICT", err.Error()
+	case errors.Is(err, service.ErrDomainInUse):
+		status, errorCode, message = http.StatusConflict, "DOMAIN_IN_USE", err.Error()
+	case errors.Is(err, service.ErrDomainVerificationFailed):
+		status, errorCode, message = http.StatusUnprocessableEntity, "DOMAIN_VERIFICATION_FAILED", err.Error()
+	}
+	utils.NewResponse().
+		SetStatus(status).
+		SetMessage(message).
+		SetErrorCode(errorCode).
+		SetData(nil).
+		Build(ctx)
+}
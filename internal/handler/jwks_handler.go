@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/pkg/token"
+)
+
+type JWKSHandler struct {
+	tokenIssuer *token.KeySetIssuer
+}
+
+func NewJWKSHandler(tokenIssuer *token.KeySetIssuer) *JWKSHandler {
+	return &JWKSHandler{
+		tokenIssuer: tokenIssuer,
+	}
+}
+
+// GetJWKS serves the public signing keys as a plain JWK Set, the format JWT libraries expect,
+// so other services can verify the tokens of this backend
+func (h *JWKSHandler) GetJWKS(ctx *gin.Context) {
+	ctx.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(common_constants.JWKSCacheMaxAge.Seconds())))
+	ctx.JSON(http.StatusOK, h.tokenIssuer.JWKS())
+}
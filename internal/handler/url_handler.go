@@ -1,13 +1,24 @@
 package handler
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/http"
+	neturl "net/url"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
 	"github.com/nikhil/url-shortner-backend/internal/dto"
 	"github.com/nikhil/url-shortner-backend/internal/service"
 	"github.com/nikhil/url-shortner-backend/internal/utils"
+	"gorm.io/gorm"
 )
 
 type URLHandler struct {
@@ -33,23 +44,16 @@ func (h *URLHandler) CreateShortURL(ctx *gin.Context) {
 		return
 	}
 
-	if createShortURLRequest.ExpiresDays == 0 {
-		createShortURLRequest.ExpiresDays = 30
-	}
-
 	userID := ctx.GetUint("user_id")
+	workspaceID := ctx.GetUint("workspace_id")
 	url, err := h.urlService.CreateShortURL(
 		ctx,
 		userID,
+		workspaceID,
 		&createShortURLRequest,
 	)
 	if err != nil {
-		utils.NewResponse().
-			SetStatus(http.StatusInternalServerError).
-			SetMessage("Failed to create short URL").
-			SetErrorCode("INTERNAL_ERROR").
-			SetData(nil).
-			Build(ctx)
+		h.respondURLError(ctx, err, "Failed to create short URL")
 		return
 	}
 
@@ -73,19 +77,10 @@ func (h *URLHandler) CreateBulkShortURLs(ctx *gin.Context) {
 		return
 	}
 	userID := ctx.GetUint("user_id")
-	for _, request := range createBulkShortURLsRequest {
-		if request.ExpiresDays == 0 {
-			request.ExpiresDays = 30
-		}
-	}
-	urls, err := h.urlService.CreateShortURLs(ctx, userID, createBulkShortURLsRequest)
+	workspaceID := ctx.GetUint("workspace_id")
+	urls, err := h.urlService.CreateShortURLs(ctx, userID, workspaceID, createBulkShortURLsRequest)
 	if err != nil {
-		utils.NewResponse().
-			SetStatus(http.StatusInternalServerError).
-			SetMessage("Failed to create short URLs").
-			SetErrorCode("INTERNAL_ERROR").
-			SetData(nil).
-			Build(ctx)
+		h.respondURLError(ctx, err, "Failed to create short URLs")
 		return
 	}
 	utils.NewResponse().
@@ -98,25 +93,175 @@ func (h *URLHandler) CreateBulkShortURLs(ctx *gin.Context) {
 
 func (h *URLHandler) RedirectToLongURL(ctx *gin.Context) {
 	shortCode := ctx.Param("shortCode")
-	password := ctx.DefaultQuery("password", "")
 
-	longURL, err := h.urlService.GetLongURL(ctx, shortCode)
+	longURL, err := h.urlService.GetLongURL(ctx, ctx.Request.Host, shortCode)
+	if err != nil {
+		h.respondRedirectError(ctx, err)
+		return
+	}
+	if longURL.IsProtected {
+		accessToken, _ := ctx.Cookie(common_constants.LinkAccessCookieName)
+		if !h.urlService.HasLinkAccess(longURL, accessToken) {
+			h.renderPasswordForm(ctx, http.StatusOK, shortCode, "")
+			return
+		}
+	}
+	// Links created before long URLs were restricted to http(s) may point anywhere, never send visitors there
+	target, err := utils.ParseHTTPURL(longURL.LongURL)
 	if err != nil {
 		utils.NewResponse().
 			SetStatus(http.StatusNotFound).
-			SetMessage("URL not found or expired").
+			SetMessage("URL not found").
 			SetErrorCode("NOT_FOUND").
 			SetData(nil).
 			Build(ctx)
 		return
 	}
-	err1 := bcrypt.CompareHashAndPassword([]byte(longURL.Password), []byte(""))
-	err2 := bcrypt.CompareHashAndPassword([]byte(longURL.Password), []byte(password))
-	if err1 != nil && err2 != nil {
-		ctx.HTML(http.StatusOK, "password_form.html", gin.H{"shortCode": shortCode})
+	h.urlService.RecordClick(ctx, longURL)
+	h.redirect(ctx, longURL, target)
+}
+
+// UnlockURL checks the password posted from the password form of a protected link. On success
+// it sets a short-lived access cookie and sends the visitor back to the link, which then
+// redirects (and counts the click) as usual.
+func (h *URLHandler) UnlockURL(ctx *gin.Context) {
+	shortCode := ctx.Param("shortCode")
+	csrfToken, err := ctx.Cookie(common_constants.CSRFCookieName)
+	if err != nil || csrfToken == "" ||
+		subtle.ConstantTimeCompare([]byte(csrfToken), []byte(ctx.PostForm("csrf_token"))) != 1 {
+		h.renderPasswordForm(ctx, http.StatusForbidden, shortCode, "Your session has expired, please try again")
 		return
 	}
-	ctx.Redirect(http.StatusMovedPermanently, longURL.LongURL)
+
+	_, accessToken, err := h.urlService.UnlockURL(ctx, ctx.Request.Host, shortCode, ctx.PostForm("password"))
+	switch {
+	case errors.Is(err, service.ErrIncorrectURLPassword):
+		h.renderPasswordForm(ctx, http.StatusUnauthorized, shortCode, "Incorrect password")
+		return
+	case errors.Is(err, service.ErrTooManyUnlockAttempts):
+		ctx.Header("Retry-After", strconv.Itoa(int(common_constants.UnlockAttemptWindow.Seconds())))
+		h.renderPasswordForm(ctx, http.StatusTooManyRequests, shortCode, "Too many attempts, please try again later")
+		return
+	case err != nil:
+		h.respondRedirectError(ctx, err)
+		return
+	}
+
+	if accessToken != "" {
+		setLinkCookie(ctx, common_constants.LinkAccessCookieName, accessToken, shortCode, common_constants.LinkAccessTTL)
+	}
+	ctx.Redirect(http.StatusSeeOther, "/"+shortCode)
+}
+
+// renderPasswordForm renders the password form of a protected link with a fresh CSRF token
+func (h *URLHandler) renderPasswordForm(ctx *gin.Context, status int, shortCode string, message string) {
+	csrfToken := make([]byte, 32)
+	if _, err := rand.Read(csrfToken); err != nil {
+		h.respondRedirectError(ctx, err)
+		return
+	}
+	encodedCSRFToken := base64.RawURLEncoding.EncodeToString(csrfToken)
+	setLinkCookie(ctx, common_constants.CSRFCookieName, encodedCSRFToken, shortCode, common_constants.CSRFTokenTTL)
+	ctx.Header("Cache-Control", "no-store")
+	ctx.HTML(status, "password_form.html", gin.H{
+		"shortCode": shortCode,
+		"csrfToken": encodedCSRFToken,
+		"error":     message,
+	})
+}
+
+// setLinkCookie sets an HTTP-only cookie scoped to the path of a single short link
+func setLinkCookie(ctx *gin.Context, name string, value string, shortCode string, ttl time.Duration) {
+	secure := ctx.Request.TLS != nil || ctx.GetHeader("X-Forwarded-Proto") == "https"
+	ctx.SetSameSite(http.SameSiteStrictMode)
+	ctx.SetCookie(name, value, int(ttl.Seconds()), "/"+shortCode, "", secure, true)
+}
+
+func (h *URLHandler) respondRedirectError(ctx *gin.Context, err error) {
+	if errors.Is(err, service.ErrURLDisabled) {
+		utils.NewResponse().
+			SetStatus(http.StatusGone).
+			SetMessage("URL has been disabled").
+			SetErrorCode("DISABLED").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+	if errors.Is(err, service.ErrURLExpired) {
+		utils.NewResponse().
+			SetStatus(http.StatusGone).
+			SetMessage("URL has expired").
+			SetErrorCode("EXPIRED").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.NewResponse().
+			SetStatus(http.StatusNotFound).
+			SetMessage("URL not found").
+			SetErrorCode("NOT_FOUND").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+	utils.NewResponse().
+		SetStatus(http.StatusInternalServerError).
+		SetMessage("Failed to resolve URL").
+		SetErrorCode("INTERNAL_ERROR").
+		SetData(nil).
+		Build(ctx)
+}
+
+// redirect sends the visitor on with the redirect type of the link. Only permanent redirects may
+// be cached by browsers, anything else has to come back to us so that every click is counted
+// and destination edits apply immediately. target is the parsed long URL.
+func (h *URLHandler) redirect(ctx *gin.Context, url *dto.RedirectURL, target *neturl.URL) {
+	switch url.RedirectType {
+	case common_constants.RedirectTypeMovedPermanently:
+		ctx.Redirect(http.StatusMovedPermanently, url.LongURL)
+	case common_constants.RedirectTypePermanentRedirect:
+		ctx.Redirect(http.StatusPermanentRedirect, url.LongURL)
+	case common_constants.RedirectTypeTemporaryRedirect:
+		ctx.Header("Cache-Control", "no-store")
+		ctx.Redirect(http.StatusTemporaryRedirect, url.LongURL)
+	case common_constants.RedirectTypeInterstitial:
+		ctx.Header("Cache-Control", "no-store")
+		ctx.HTML(http.StatusOK, "interstitial.html", gin.H{
+			"longURL": target.String(),
+			"delay":   common_constants.InterstitialRedirectDelay,
+		})
+	default:
+		ctx.Header("Cache-Control", "no-store")
+		ctx.Redirect(http.StatusFound, url.LongURL)
+	}
+}
+
+func (h *URLHandler) GetURLStats(ctx *gin.Context) {
+	var urlStatsRequest dto.URLStatsRequest
+	if err := ctx.ShouldBindQuery(&urlStatsRequest); err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid query parameters").
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+
+	workspaceID := ctx.GetUint("workspace_id")
+	stats, err := h.urlService.GetURLStats(ctx, workspaceID, ctx.Query("domain"), ctx.Param("shortCode"), &urlStatsRequest)
+	if err != nil {
+		h.respondURLError(ctx, err, "Failed to fetch URL stats")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("URL stats fetched successfully").
+		SetErrorCode("").
+		SetData(stats).
+		Build(ctx)
 }
 
 func (h *URLHandler) GenerateQRCode(ctx *gin.Context) {
@@ -130,18 +275,31 @@ func (h *URLHandler) GenerateQRCode(ctx *gin.Context) {
 			Build(ctx)
 		return
 	}
-	qrCodeBase64, err := h.urlService.GenerateQRCodeBase64(ctx, shortCode)
-	if err != nil {
+	var qrCodeRequest dto.QRCodeRequest
+	if err := ctx.ShouldBindQuery(&qrCodeRequest); err != nil {
 		utils.NewResponse().
-			SetStatus(http.StatusInternalServerError).
-			SetMessage("Failed to generate QRCode").
-			SetErrorCode("INTERNAL_ERROR").
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid query parameters").
+			SetErrorCode("BAD_REQUEST").
 			SetData(nil).
 			Build(ctx)
 		return
 	}
+	workspaceID := ctx.GetUint("workspace_id")
+	qrCode, imageURL, err := h.urlService.GenerateQRCode(ctx, workspaceID, ctx.Query("domain"), shortCode, &qrCodeRequest)
+	if err != nil {
+		h.respondURLError(ctx, err, "Failed to generate QRCode")
+		return
+	}
+
+	if qrCodeRequest.Raw {
+		serveQRCodeImage(ctx, qrCode)
+		return
+	}
+
 	data := map[string]interface{}{
-		"qrCodeBase64": qrCodeBase64,
+		"qrCodeBase64": fmt.Sprintf("data:%s;base64,%s", qrCode.ContentType, base64.StdEncoding.EncodeToString(qrCode.Data)),
+		"imageUrl":     imageURL,
 	}
 	utils.NewResponse().
 		SetStatus(http.StatusOK).
@@ -151,23 +309,195 @@ func (h *URLHandler) GenerateQRCode(ctx *gin.Context) {
 		Build(ctx)
 }
 
-func (h *URLHandler) GetUserURLs(c *gin.Context) {
-	userID := c.GetUint("user_id")
-	urls, err := h.urlService.GetUserURLs(userID)
+// GetSignedQRCode serves the image of a signed QR code URL, without credentials
+func (h *URLHandler) GetSignedQRCode(ctx *gin.Context) {
+	urlID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	var qrCodeRequest dto.QRCodeRequest
+	if err == nil {
+		err = ctx.ShouldBindQuery(&qrCodeRequest)
+	}
 	if err != nil {
 		utils.NewResponse().
-			SetStatus(http.StatusInternalServerError).
-			SetMessage("Failed to fetch user URLs").
-			SetErrorCode("INTERNAL_ERROR").
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid QR code URL").
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+	qrCode, err := h.urlService.GetSignedQRCode(ctx, uint(urlID), ctx.Request.URL.Query(), &qrCodeRequest)
+	if err != nil {
+		h.respondURLError(ctx, err, "Failed to generate QRCode")
+		return
+	}
+	serveQRCodeImage(ctx, qrCode)
+}
+
+// serveQRCodeImage streams the image itself so it can be used as an <img> source
+func serveQRCodeImage(ctx *gin.Context, qrCode *utils.QRCodeImage) {
+	digest := sha256.Sum256(qrCode.Data)
+	etag := `"` + hex.EncodeToString(digest[:16]) + `"`
+	ctx.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(common_constants.QRCodeCacheMaxAge.Seconds())))
+	ctx.Header("ETag", etag)
+	if ctx.GetHeader("If-None-Match") == etag {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+	ctx.Data(http.StatusOK, qrCode.ContentType, qrCode.Data)
+}
+
+func (h *URLHandler) GetWorkspaceURLs(c *gin.Context) {
+	var listURLsRequest dto.ListURLsRequest
+	if err := c.ShouldBindQuery(&listURLsRequest); err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid query parameters").
+			SetErrorCode("BAD_REQUEST").
 			SetData(nil).
 			Build(c)
 		return
 	}
 
+	workspaceID := c.GetUint("workspace_id")
+	urls, pagination, err := h.urlService.GetWorkspaceURLs(c, workspaceID, &listURLsRequest)
+	if err != nil {
+		h.respondURLError(c, err, "Failed to fetch user URLs")
+		return
+	}
+
 	utils.NewResponse().
 		SetStatus(http.StatusOK).
 		SetMessage("User URLs fetched successfully").
 		SetErrorCode("").
 		SetData(urls).
+		SetMeta(pagination).
 		Build(c)
 }
+
+func (h *URLHandler) GetShortURL(ctx *gin.Context) {
+	workspaceID := ctx.GetUint("workspace_id")
+	url, err := h.urlService.GetWorkspaceURL(ctx, workspaceID, ctx.Query("domain"), ctx.Param("shortCode"))
+	if err != nil {
+		h.respondURLError(ctx, err, "Failed to fetch URL")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("URL fetched successfully").
+		SetErrorCode("").
+		SetData(url).
+		Build(ctx)
+}
+
+func (h *URLHandler) UpdateShortURL(ctx *gin.Context) {
+	var updateShortURLRequest dto.UpdateShortURLRequest
+	if err := ctx.ShouldBindJSON(&updateShortURLRequest); err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid request payload").
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+
+	workspaceID := ctx.GetUint("workspace_id")
+	url, err := h.urlService.UpdateShortURL(ctx, workspaceID, ctx.Query("domain"), ctx.Param("shortCode"), &updateShortURLRequest)
+	if err != nil {
+		h.respondURLError(ctx, err, "Failed to update URL")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("URL updated successfully").
+		SetErrorCode("").
+		SetData(url).
+		Build(ctx)
+}
+
+func (h *URLHandler) DeleteShortURL(ctx *gin.Context) {
+	workspaceID := ctx.GetUint("workspace_id")
+	if err := h.urlService.DeleteShortURL(ctx, workspaceID, ctx.Query("domain"), ctx.Param("shortCode")); err != nil {
+		h.respondURLError(ctx, err, "Failed to delete URL")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("URL deleted successfully").
+		SetErrorCode("").
+		SetData(nil).
+		Build(ctx)
+}
+
+func (h *URLHandler) CheckAliasAvailability(ctx *gin.Context) {
+	var aliasAvailabilityRequest dto.AliasAvailabilityRequest
+	if err := ctx.ShouldBindQuery(&aliasAvailabilityRequest); err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid query parameters").
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	response := dto.AliasAvailabilityResponse{Alias: aliasAvailabilityRequest.Alias, Available: true}
+	err := h.urlService.CheckAliasAvailability(ctx, userID, aliasAvailabilityRequest.Domain, aliasAvailabilityRequest.Alias)
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrAliasAlreadyExists):
+		response.Available, response.Reason = false, "taken"
+	case errors.Is(err, service.ErrReservedAlias):
+		response.Available, response.Reason = false, "reserved"
+	case errors.Is(err, service.ErrInvalidAlias):
+		response.Available, response.Reason = false, "invalid"
+	default:
+		h.respondURLError(ctx, err, "Failed to check alias availability")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Alias availability checked successfully").
+		SetErrorCode("").
+		SetData(response).
+		Build(ctx)
+}
+
+// respondURLError maps URL service errors to API responses
+func (h *URLHandler) respondURLError(ctx *gin.Context, err error, message string) {
+	status, errorCode := http.StatusInternalServerError, "INTERNAL_ERROR"
+	switch {
+	case errors.Is(err, service.ErrURLNotFound):
+		status, errorCode, message = http.StatusNotFound, "NOT_FOUND", "URL not found"
+	case errors.Is(err, service.ErrAliasAlreadyExists):
+		status, errorCode, message = http.StatusConflict, "ALIAS_CONFLICT", err.Error()
+	case errors.Is(err, service.ErrReservedAlias):
+		status, errorCode, message = http.StatusConflict, "ALIAS_RESERVED", err.Error()
+	case errors.Is(err, service.ErrInvalidAlias):
+		status, errorCode, message = http.StatusBadRequest, "INVALID_ALIAS", err.Error()
+	case errors.Is(err, service.ErrDomainNotFound):
+		status, errorCode, message = http.StatusNotFound, "DOMAIN_NOT_FOUND", err.Error()
+	case errors.Is(err, service.ErrDomainNotVerified):
+		status, errorCode, message = http.StatusConflict, "DOMAIN_NOT_VERIFIED", err.Error()
+	case errors.Is(err, service.ErrInvalidDateRange), errors.Is(err, service.ErrInvalidCursor),
+		errors.Is(err, service.ErrInvalidQRCodeOptions):
+		status, errorCode, message = http.StatusBadRequest, "BAD_REQUEST", err.Error()
+	case errors.Is(err, service.ErrInvalidQRCodeURL):
+		status, errorCode, message = http.StatusForbidden, "INVALID_SIGNATURE", err.Error()
+	case errors.Is(err, service.ErrInvalidExpiry):
+		status, errorCode, message = http.StatusBadRequest, "INVALID_EXPIRY", err.Error()
+	case errors.Is(err, service.ErrInvalidLongURL):
+		status, errorCode, message = http.StatusBadRequest, "INVALID_URL", err.Error()
+	}
+	utils.NewResponse().
+		SetStatus(status).
+		SetMessage(message).
+		SetErrorCode(errorCode).
+		SetData(nil).
+		Build(ctx)
+}
@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/internal/dto"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/service"
+	"github.com/nikhil/url-shortner-backend/internal/utils"
+)
+
+type WorkspaceHandler struct {
+	workspaceService *service.WorkspaceService
+}
+
+func NewWorkspaceHandler(workspaceService *service.WorkspaceService) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		workspaceService: workspaceService,
+	}
+}
+
+// member returns the membership of the caller in the workspace resolved by the workspace middleware
+func (h *WorkspaceHandler) member(ctx *gin.Context) *model.WorkspaceMember {
+	return ctx.MustGet("workspace_member").(*model.WorkspaceMember)
+}
+
+func (h *WorkspaceHandler) CreateWorkspace(ctx *gin.Context) {
+	var createWorkspaceRequest dto.CreateWorkspaceRequest
+	if !h.bindJSON(ctx, &createWorkspaceRequest) {
+		return
+	}
+
+	workspace, err := h.workspaceService.CreateWorkspace(ctx, ctx.GetUint("user_id"), &createWorkspaceRequest)
+	if err != nil {
+		h.respondWorkspaceError(ctx, err, "Failed to create workspace")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusCreated).
+		SetMessage("Workspace created successfully").
+		SetErrorCode("").
+		SetData(workspace).
+		Build(ctx)
+}
+
+func (h *WorkspaceHandler) ListWorkspaces(ctx *gin.Context) {
+	workspaces, err := h.workspaceService.ListWorkspaces(ctx, ctx.GetUint("user_id"))
+	if err != nil {
+		h.respondWorkspaceError(ctx, err, "Failed to fetch workspaces")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Workspaces fetched successfully").
+		SetErrorCode("").
+		SetData(workspaces).
+		Build(ctx)
+}
+
+func (h *WorkspaceHandler) UpdateWorkspace(ctx *gin.Context) {
+	var updateWorkspaceRequest dto.UpdateWorkspaceRequest
+	if !h.bindJSON(ctx, &updateWorkspaceRequest) {
+		return
+	}
+
+	workspace, err := h.workspaceService.UpdateWorkspace(ctx, h.member(ctx), &updateWorkspaceRequest)
+	if err != nil {
+		h.respondWorkspaceError(ctx, err, "Failed to update workspace")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Workspace updated successfully").
+		SetErrorCode("").
+		SetData(workspace).
+		Build(ctx)
+}
+
+func (h *WorkspaceHandler) DeleteWorkspace(ctx *gin.Context) {
+	if err := h.workspaceService.DeleteWorkspace(ctx, h.member(ctx)); err != nil {
+		h.respondWorkspaceError(ctx, err, "Failed to delete workspace")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Workspace deleted successfully").
+		SetErrorCode("").
+		SetData(nil).
+		Build(ctx)
+}
+
+func (h *WorkspaceHandler) ListMembers(ctx *gin.Context) {
+	members, err := h.workspaceService.ListMembers(ctx, ctx.GetUint("workspace_id"))
+	if err != nil {
+		h.respondWorkspaceError(ctx, err, "Failed to fetch members")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Members fetched successfully").
+		SetErrorCode("").
+		SetData(members).
+		Build(ctx)
+}
+
+func (h *WorkspaceHandler) UpdateMember(ctx *gin.Context) {
+	userID, ok := h.uintParam(ctx, "userId", "Invalid user id")
+	if !ok {
+		return
+	}
+	var updateMemberRequest dto.UpdateWorkspaceMemberRequest
+	if !h.bindJSON(ctx, &updateMemberRequest) {
+		return
+	}
+
+	member, err := h.workspaceService.UpdateMemberRole(ctx, ctx.GetUint("workspace_id"), userID, &updateMemberRequest)
+	if err != nil {
+		h.respondWorkspaceError(ctx, err, "Failed to update member")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Member updated successfully").
+		SetErrorCode("").
+		SetData(member).
+		Build(ctx)
+}
+
+func (h *WorkspaceHandler) RemoveMember(ctx *gin.Context) {
+	userID, ok := h.uintParam(ctx, "userId", "Invalid user id")
+	if !ok {
+		return
+	}
+
+	if err := h.workspaceService.RemoveMember(ctx, h.member(ctx), userID); err != nil {
+		h.respondWorkspaceError(ctx, err, "Failed to remove member")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Member removed successfully").
+		SetErrorCode("").
+		SetData(nil).
+		Build(ctx)
+}
+
+func (h *WorkspaceHandler) InviteMember(ctx *gin.Context) {
+	var inviteMemberRequest dto.InviteWorkspaceMemberRequest
+	if !h.bindJSON(ctx, &inviteMemberRequest) {
+		return
+	}
+
+	invitation, err := h.workspaceService.InviteMember(ctx, h.member(ctx), &inviteMemberRequest)
+	if err != nil {
+		h.respondWorkspaceError(ctx, err, "Failed to invite member")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusCreated).
+		SetMessage("Invitation sent successfully").
+		SetErrorCode("").
+		SetData(invitation).
+		Build(ctx)
+}
+
+func (h *WorkspaceHandler) ListInvitations(ctx *gin.Context) {
+	invitations, err := h.workspaceService.ListInvitations(ctx, ctx.GetUint("workspace_id"))
+	if err != nil {
+		h.respondWorkspaceError(ctx, err, "Failed to fetch invitations")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Invitations fetched successfully").
+		SetErrorCode("").
+		SetData(invitations).
+		Build(ctx)
+}
+
+func (h *WorkspaceHandler) RevokeInvitation(ctx *gin.Context) {
+	invitationID, ok := h.uintParam(ctx, "invitationId", "Invalid invitation id")
+	if !ok {
+		return
+	}
+
+	if err := h.workspaceService.RevokeInvitation(ctx, ctx.GetUint("workspace_id"), invitationID); err != nil {
+		h.respondWorkspaceError(ctx, err, "Failed to revoke invitation")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Invitation revoked successfully").
+		SetErrorCode("").
+		SetData(nil).
+		Build(ctx)
+}
+
+func (h *WorkspaceHandler) AcceptInvitation(ctx *gin.Context) {
+	var acceptInvitationRequest dto.AcceptWorkspaceInvitationRequest
+	if !h.bindJSON(ctx, &acceptInvitationRequest) {
+		return
+	}
+
+	workspace, err := h.workspaceService.AcceptInvitation(ctx, ctx.GetUint("user_id"), acceptInvitationRequest.Token)
+	if err != nil {
+		h.respondWorkspaceError(ctx, err, "Failed to accept invitation")
+		return
+	}
+
+	utils.NewResponse().
+		SetStatus(http.StatusOK).
+		SetMessage("Invitation accepted successfully").
+		SetErrorCode("").
+		SetData(workspace).
+		Build(ctx)
+}
+
+func (h *WorkspaceHandler) bindJSON(ctx *gin.Context, request interface{}) bool {
+	if err := ctx.ShouldBindJSON(request); err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage("Invalid request payload").
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return false
+	}
+	return true
+}
+
+func (h *WorkspaceHandler) uintParam(ctx *gin.Context, name string, message string) (uint, bool) {
+	value, err := strconv.ParseUint(ctx.Param(name), 10, 64)
+	if err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusBadRequest).
+			SetMessage(message).
+			SetErrorCode("BAD_REQUEST").
+			SetData(nil).
+			Build(ctx)
+		return 0, false
+	}
+	return uint(value), true
+}
+
+// respondWorkspaceError maps workspace service errors to API responses
+func (h *WorkspaceHandler) respondWorkspaceError(ctx *gin.Context, err error, message string) {
+	status, errorCode := http.StatusInternalServerError, "INTERNAL_ERROR"
+	switch {
+	case errors.Is(err, service.ErrWorkspaceNotFound):
+		status, errorCode, message = http.StatusNotFound, "WORKSPACE_NOT_FOUND", err.Error()
+	case errors.Is(err, service.ErrMemberNotFound), errors.Is(err, service.ErrInvitationNotFound):
+		status, errorCode, message = http.StatusNotFound, "NOT_FOUND", err.Error()
+	case errors.Is(err, service.ErrAlreadyMember):
+		status, errorCode, message = http.StatusConflict, "ALREADY_MEMBER", err.Error()
+	case errors.Is(err, service.ErrWorkspaceNotEmpty):
+		status, errorCode, message = http.StatusConflict, "WORKSPACE_NOT_EMPTY", err.Error()
+	case errors.Is(err, service.ErrLastWorkspaceOwner):
+		status, errorCode, message = http.StatusConflict, "LAST_OWNER", err.Error()
+	case errors.Is(err, service.ErrPersonalWorkspace):
+		status, errorCode, message = http.StatusBadRequest, "PERSONAL_WORKSPACE", err.Error()
+	case errors.Is(err, service.ErrInsufficientWorkspaceRole):
+		status, errorCode, message = http.StatusForbidden, "INSUFFICIENT_ROLE", err.Error()
+	}
+	utils.NewResponse().
+		SetStatus(status).
+		SetMessage(message).
+		SetErrorCode(errorCode).
+		SetData(nil).
+		Build(ctx)
+}
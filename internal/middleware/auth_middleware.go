@@ -1,17 +1,29 @@
 package middleware
 
 import (
-	"github.com/dgrijalva/jwt-go"
+	"errors"
 	"github.com/gin-gonic/gin"
+	common_constants "github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
 	"github.com/nikhil/url-shortner-backend/internal/repository"
+	"github.com/nikhil/url-shortner-backend/internal/service"
 	"github.com/nikhil/url-shortner-backend/internal/utils"
+	"github.com/nikhil/url-shortner-backend/pkg/token"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 )
 
-func AuthMiddleware(sessionRepo *repository.SessionRepository, jwtSecret string) gin.HandlerFunc {
+// AuthMiddleware authenticates a request with either the access token of a session or an API key
+// sent in the X-API-Key header or as "Authorization: ApiKey <key>".
+func AuthMiddleware(sessionRepo *repository.SessionRepository, tokenIssuer token.Issuer, apiKeyService *service.APIKeyService) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authHeader := ctx.GetHeader("Authorization")
+		if apiKey := getAPIKey(ctx); apiKey != "" {
+			authenticateAPIKey(ctx, apiKeyService, apiKey)
+			return
+		}
 		if authHeader == "" {
 			utils.NewResponse().
 				SetStatus(http.StatusUnauthorized).
@@ -24,11 +36,10 @@ func AuthMiddleware(sessionRepo *repository.SessionRepository, jwtSecret string)
 		}
 
 		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtSecret), nil
-		})
+		claims, err := tokenIssuer.Verify(tokenString)
 
-		if err != nil || !token.Valid {
+		// Refresh tokens are signed with the same keys but only grant a new token pair
+		if err != nil || claims.TokenUse != token.TokenUseAccess {
 			utils.NewResponse().
 				SetStatus(http.StatusUnauthorized).
 				SetMessage("Invalid token").
@@ -39,9 +50,10 @@ func AuthMiddleware(sessionRepo *repository.SessionRepository, jwtSecret string)
 			return
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
-		userID := uint(claims["user_id"].(float64))
-		session, err := sessionRepo.GetUserSession(ctx, userID)
+		userID := claims.UserID
+		sessionID := claims.SessionID
+		tokenID := claims.ID
+		session, err := sessionRepo.GetSession(ctx, userID, sessionID)
 
 		if err != nil {
 			utils.NewResponse().
@@ -53,7 +65,7 @@ func AuthMiddleware(sessionRepo *repository.SessionRepository, jwtSecret string)
 			ctx.Abort()
 			return
 		}
-		if session == nil || session.AccessToken != tokenString {
+		if session == nil || tokenID == "" || session.AccessTokenID != tokenID {
 			utils.NewResponse().
 				SetStatus(http.StatusUnauthorized).
 				SetMessage("Invalid token").
@@ -63,7 +75,110 @@ func AuthMiddleware(sessionRepo *repository.SessionRepository, jwtSecret string)
 			ctx.Abort()
 			return
 		}
+		// Last seen is only written once in a while so that authenticated requests don't all write to redis.
+		// It is skipped when a refresh rotated the session meanwhile, which mustn't be undone.
+		if time.Since(session.LastSeenAt) > common_constants.SessionLastSeenInterval {
+			session.LastSeenAt = time.Now()
+			session.IPAddress = ctx.ClientIP()
+			if _, err = sessionRepo.ReplaceSession(ctx, session, session.RefreshTokenID); err != nil {
+				logger.GetLogger(ctx).Errorf("Failed to update last seen of session: %s, err: %v", sessionID, err)
+			}
+		}
 		ctx.Set("user_id", userID)
+		ctx.Set("session_id", sessionID)
+		ctx.Next()
+	}
+}
+
+func getAPIKey(ctx *gin.Context) string {
+	if apiKey := ctx.GetHeader(common_constants.APIKeyHeader); apiKey != "" {
+		return apiKey
+	}
+	authType, credentials, found := strings.Cut(ctx.GetHeader("Authorization"), " ")
+	if found && strings.EqualFold(authType, common_constants.APIKeyAuthType) {
+		return strings.TrimSpace(credentials)
+	}
+	return ""
+}
+
+func authenticateAPIKey(ctx *gin.Context, apiKeyService *service.APIKeyService, key string) {
+	apiKey, err := apiKeyService.Authenticate(ctx, key)
+	if err != nil {
+		status, message, errorCode := http.StatusUnauthorized, "Invalid api key", "UNAUTHORIZED"
+		if !errors.Is(err, service.ErrInvalidAPIKey) {
+			status, message, errorCode = http.StatusInternalServerError, "Failed to authenticate", "INTERNAL_ERROR"
+		}
+		utils.NewResponse().
+			SetStatus(status).
+			SetMessage(message).
+			SetErrorCode(errorCode).
+			SetData(nil).
+			Build(ctx)
+		ctx.Abort()
+		return
+	}
+	ctx.Set("user_id", apiKey.UserID)
+	ctx.Set("api_key_id", apiKey.ID)
+	ctx.Set("api_key_scope", apiKey.Scope)
+	ctx.Next()
+}
+
+// RequireScope refuses requests made with an API key whose scope doesn't include the given one.
+// Sessions are not limited by scopes.
+func RequireScope(scope common_constants.APIKeyScope) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		value, ok := ctx.Get("api_key_scope")
+		if !ok {
+			ctx.Next()
+			return
+		}
+		if apiKeyScope, _ := value.(common_constants.APIKeyScope); !apiKeyScope.Includes(scope) {
+			utils.NewResponse().
+				SetStatus(http.StatusForbidden).
+				SetMessage("API key scope doesn't allow this request, " + string(scope) + " scope required").
+				SetErrorCode("INSUFFICIENT_SCOPE").
+				SetData(nil).
+				Build(ctx)
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// RequireRole only lets through users with one of the given roles. The role is read from the
+// database on every request so that demotions apply immediately.
+func RequireRole(userRepo *repository.UserRepository, roles ...common_constants.UserRole) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := userRepo.FindByID(ctx.GetUint("user_id"))
+		if err != nil || user.DisabledAt != nil || !slices.Contains(roles, user.UserRole) {
+			utils.NewResponse().
+				SetStatus(http.StatusForbidden).
+				SetMessage("You don't have access to this resource").
+				SetErrorCode("FORBIDDEN").
+				SetData(nil).
+				Build(ctx)
+			ctx.Abort()
+			return
+		}
+		ctx.Set("user_role", user.UserRole)
+		ctx.Next()
+	}
+}
+
+// RequireSession refuses requests made with an API key, for account routes such as managing sessions and keys
+func RequireSession() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if _, ok := ctx.Get("api_key_scope"); ok {
+			utils.NewResponse().
+				SetStatus(http.StatusForbidden).
+				SetMessage("This request requires logging in, api keys are not accepted").
+				SetErrorCode("SESSION_REQUIRED").
+				SetData(nil).
+				Build(ctx)
+			ctx.Abort()
+			return
+		}
 		ctx.Next()
 	}
 }
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	common_constants "github.com/nikhil/url-shortner-backend/constants"
+	"net/http"
+)
+
+// LegacyRedirectMiddleware keeps short links shared before redirects moved to the host root working.
+// Unauthenticated GETs of route, the old redirect path, are sent to /:shortCode, every other request
+// goes on to authentication.
+func LegacyRedirectMiddleware(route string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method != http.MethodGet || ctx.FullPath() != route ||
+			ctx.GetHeader("Authorization") != "" || ctx.GetHeader(common_constants.APIKeyHeader) != "" {
+			ctx.Next()
+			return
+		}
+
+		location := "/" + ctx.Param("shortCode")
+		if ctx.Request.URL.RawQuery != "" {
+			location += "?" + ctx.Request.URL.RawQuery
+		}
+		ctx.Redirect(http.StatusMovedPermanently, location)
+		ctx.Abort()
+	}
+}
@@ -164,12 +164,12 @@ func LoggerMiddleware(env, component string) gin.HandlerFunc {
 
 		// Log the incoming request
 		log := GetLogger(c)
-		log.Infof("Request started", "path: %s", c.Request.URL.Path)
+		log.Infof("Request started, path: %s", c.Request.URL.Path)
 
 		// Continue processing the request
 		c.Next()
 
 		// Log the outgoing response after handling the request
-		log.Infof("Request completed", "path: %s, status: %d", c.Request.URL.Path, c.Writer.Status())
+		log.Infof("Request completed, path: %s, status: %d", c.Request.URL.Path, c.Writer.Status())
 	}
 }
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	common_constants "github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/service"
+	"github.com/nikhil/url-shortner-backend/internal/utils"
+)
+
+// WorkspaceMiddleware resolves the workspace named by the X-Workspace-ID header, the personal
+// workspace of the user when it's missing, and sets "workspace_id" and "workspace_role"
+func WorkspaceMiddleware(workspaceService *service.WorkspaceService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		setWorkspace(ctx, workspaceService, ctx.GetHeader(common_constants.WorkspaceHeader))
+	}
+}
+
+// WorkspaceParamMiddleware resolves the workspace named by the :id path parameter
+func WorkspaceParamMiddleware(workspaceService *service.WorkspaceService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Param("id") == "" {
+			respondWorkspaceNotFound(ctx)
+			return
+		}
+		setWorkspace(ctx, workspaceService, ctx.Param("id"))
+	}
+}
+
+func setWorkspace(ctx *gin.Context, workspaceService *service.WorkspaceService, rawWorkspaceID string) {
+	member, err := workspaceService.ResolveMembership(ctx, ctx.GetUint("user_id"), rawWorkspaceID)
+	if errors.Is(err, service.ErrWorkspaceNotFound) {
+		respondWorkspaceNotFound(ctx)
+		return
+	}
+	if err != nil {
+		utils.NewResponse().
+			SetStatus(http.StatusInternalServerError).
+			SetMessage("Failed to resolve workspace").
+			SetErrorCode("INTERNAL_ERROR").
+			SetData(nil).
+			Build(ctx)
+		ctx.Abort()
+		return
+	}
+	ctx.Set("workspace_id", member.WorkspaceID)
+	ctx.Set("workspace_role", member.Role)
+	ctx.Set("workspace_member", member)
+	ctx.Next()
+}
+
+func respondWorkspaceNotFound(ctx *gin.Context) {
+	utils.NewResponse().
+		SetStatus(http.StatusNotFound).
+		SetMessage("Workspace not found").
+		SetErrorCode("WORKSPACE_NOT_FOUND").
+		SetData(nil).
+		Build(ctx)
+	ctx.Abort()
+}
+
+// RequireWorkspaceRole refuses requests of members whose role in the workspace doesn't include the given one
+func RequireWorkspaceRole(role common_constants.WorkspaceRole) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		memberRole, _ := ctx.MustGet("workspace_role").(common_constants.WorkspaceRole)
+		if !memberRole.Includes(role) {
+			utils.NewResponse().
+				SetStatus(http.StatusForbidden).
+				SetMessage("Your role in the workspace doesn't allow this, " + string(role) + " role required").
+				SetErrorCode("INSUFFICIENT_ROLE").
+				SetData(nil).
+				Build(ctx)
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"github.com/nikhil/url-shortner-backend/constants"
+	"gorm.io/gorm"
+	"time"
+)
+
+// APIKey is a long-lived key for scripts. Only the SHA-256 hash of the key is stored, the key
+// itself is shown once when it is created.
+type APIKey struct {
+	ID         uint                         `json:"id" gorm:"primaryKey"`
+	UserID     uint                         `json:"user_id" gorm:"not null;index"`
+	Name       string                       `json:"name" gorm:"not null;type:varchar(100)"`
+	Prefix     string                       `json:"prefix" gorm:"not null;type:varchar(16)"` // first characters of the key, to recognise it
+	KeyHash    string                       `json:"-" gorm:"not null;type:char(64);uniqueIndex"`
+	Scope      common_constants.APIKeyScope `json:"scope" gorm:"not null;type:varchar(16)"`
+	LastUsedAt *time.Time                   `json:"last_used_at"`
+	LastUsedIP string                       `json:"last_used_ip"`
+	CreatedAt  time.Time                    `json:"created_at" gorm:"autoCreateTime"`
+	DeletedAt  gorm.DeletedAt               `json:"-" gorm:"index"` // revoked keys are kept for auditing
+	User       User                         `json:"-" gorm:"foreignKey:UserID"`
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+)
+
+type ClickEvent struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	URLID        uint      `json:"url_id" gorm:"not null;index:idx_click_events_url_clicked_at,priority:1"`
+	ShortCode    string    `json:"short_code" gorm:"not null;type:varchar(20)"`
+	Referrer     string    `json:"referrer" gorm:"type:text"`
+	ReferrerHost string    `json:"referrer_host" gorm:"type:varchar(255)"`
+	UserAgent    string    `json:"user_agent" gorm:"type:text"`
+	IPAddress    string    `json:"ip_address" gorm:"type:varchar(45)"`
+	IPVersion    int       `json:"ip_version"`
+	Country      string    `json:"country" gorm:"type:varchar(2)"`
+	ClickedAt    time.Time `json:"clicked_at" gorm:"not null;index:idx_click_events_url_clicked_at,priority:2"`
+}
+
+// ClickBucketCount is the number of clicks that fell into one time bucket
+type ClickBucketCount struct {
+	Bucket time.Time `json:"bucket"`
+	Count  int64     `json:"count"`
+}
+
+// ClickDimensionCount is the number of clicks sharing the same value of a dimension (referrer, user agent...)
+type ClickDimensionCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
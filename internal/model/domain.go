@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+type Domain struct {
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	UserID            uint       `json:"user_id" gorm:"not null;index"`
+	Hostname          string     `json:"hostname" gorm:"not null;type:varchar(253);index;uniqueIndex:idx_domains_verified_hostname,where:verified_at IS NOT NULL"`
+	VerificationToken string     `json:"verification_token" gorm:"not null"`
+	VerifiedAt        *time.Time `json:"verified_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	User              User       `json:"-" gorm:"foreignKey:UserID"`
+}
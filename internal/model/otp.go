@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+// OTP is a pending one-time code. Only a keyed hash of the code is kept, in redis.
+type OTP struct {
+	CodeHash string    `json:"code_hash"`
+	SentAt   time.Time `json:"sent_at"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+)
+
+// OutboxEmail is an email waiting to be sent, or the record of one. Requests only enqueue emails,
+// the outbox sender delivers them and retries failures.
+type OutboxEmail struct {
+	ID            uint                         `json:"id" gorm:"primaryKey"`
+	To            string                       `json:"to" gorm:"not null"`
+	Subject       string                       `json:"subject" gorm:"not null"`
+	Message       []byte                       `json:"-" gorm:"not null"` // the whole MIME message, as sent
+	Status        common_constants.EmailStatus `json:"status" gorm:"not null;type:varchar(16);index:idx_outbox_emails_due,priority:1"`
+	Attempts      int                          `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt time.Time                    `json:"next_attempt_at" gorm:"not null;index:idx_outbox_emails_due,priority:2"`
+	LastError     string                       `json:"last_error"`
+	SentAt        *time.Time                   `json:"sent_at"`
+	CreatedAt     time.Time                    `json:"created_at"`
+	UpdatedAt     time.Time                    `json:"updated_at"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import (
+	"github.com/nikhil/url-shortner-backend/constants"
+	"time"
+)
+
+// RolePolicy holds the security requirements admins set for every user of a role
+type RolePolicy struct {
+	Role             common_constants.UserRole `json:"role" gorm:"primaryKey;type:varchar(16)"`
+	RequireTwoFactor bool                      `json:"require_two_factor" gorm:"not null;default:false"`
+	UpdatedAt        time.Time                 `json:"updated_at"`
+}
@@ -1,6 +1,17 @@
 package model
 
+import "time"
+
+// Session is one logged in device of a user. Sessions live in redis.
 type Session struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	ID             string    `json:"id"`
+	UserID         uint      `json:"user_id"`
+	AccessTokenID  string    `json:"access_token_id"`  // jti of the only access token accepted for the session
+	RefreshTokenID string    `json:"refresh_token_id"` // jti of the only refresh token accepted, rotated on every refresh
+	DeviceName     string    `json:"device_name"`
+	UserAgent      string    `json:"user_agent"`
+	IPAddress      string    `json:"ip_address"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastSeenAt     time.Time `json:"last_seen_at"`
+	RotatedAt      time.Time `json:"rotated_at"`
 }
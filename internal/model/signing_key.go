@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// SigningKey is a JWT signing key. Keys are published in the JWKS before they start signing and
+// stay there until RetireAt, so tokens signed with them can still be verified after a rotation.
+type SigningKey struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	KID         string     `json:"kid" gorm:"not null;type:varchar(64);uniqueIndex"`
+	Algorithm   string     `json:"algorithm" gorm:"not null;type:varchar(16)"`
+	PrivateKey  string     `json:"-" gorm:"not null;type:text"` // encrypted with the data encryption key
+	SigningFrom time.Time  `json:"signing_from" gorm:"not null"`
+	RetireAt    *time.Time `json:"retire_at" gorm:"index"` // nil until a newer key replaces it
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
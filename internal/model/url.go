@@ -1,18 +1,40 @@
 package model
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+	"gorm.io/gorm"
 	"time"
 )
 
 type URL struct {
-	ID        uint       `json:"id" gorm:"primaryKey"`
-	UserID    uint       `json:"user_id" gorm:"not null"`
-	LongURL   string     `json:"long_url" gorm:"not null;type:text"`
-	Password  string     `json:"password" gorm:"not null"`
-	ShortCode string     `json:"short_code" gorm:"not null;type:varchar(20)"`
-	Clicks    int64      `json:"clicks" gorm:"default:0"`
-	ExpiresAt *time.Time `json:"expires_at"`
-	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"` // Automatically set when created
-	UpdatedAt time.Time  `json:"updated_at" gorm:"autoUpdateTime"` // Automatically updated on save
-	User      User       `json:"-" gorm:"foreignKey:UserID"`
+	ID             uint                          `json:"id" gorm:"primaryKey"`
+	UserID         uint                          `json:"user_id" gorm:"not null"` // creator of the link
+	WorkspaceID    uint                          `json:"workspace_id" gorm:"not null;default:0;index"`
+	LongURL        string                        `json:"long_url" gorm:"not null;type:text"`
+	Password       string                        `json:"-" gorm:"not null"` // bcrypt hash, empty for unprotected links
+	IsProtected    bool                          `json:"is_protected" gorm:"not null;default:false"`
+	DomainID       uint                          `json:"domain_id" gorm:"not null;default:0;uniqueIndex:idx_urls_domain_short_code,priority:1"` // 0 is the main host
+	ShortCode      string                        `json:"short_code" gorm:"not null;type:varchar(20);uniqueIndex:idx_urls_domain_short_code,priority:2"`
+	ShortURL       string                        `json:"short_url" gorm:"-"` // Public link, computed from the domain and the short code
+	Clicks         int64                         `json:"clicks" gorm:"default:0"`
+	ExpiresAt      *time.Time                    `json:"expires_at"`                                     // nil never expires
+	MaxClicks      *int64                        `json:"max_clicks"`                                     // expire after this many clicks, nil for no limit
+	ExpiredAt      *time.Time                    `json:"expired_at" gorm:"index:idx_urls_expired_at"`    // set by the expiry sweeper
+	NotifyOnExpiry bool                          `json:"notify_on_expiry" gorm:"not null;default:false"` // email the owner once the link expires
+	RedirectType   common_constants.RedirectType `json:"redirect_type" gorm:"type:varchar(16);not null;default:'302'"`
+	DisabledAt     *time.Time                    `json:"disabled_at"`                      // set when an admin takes the link down
+	CreatedAt      time.Time                     `json:"created_at" gorm:"autoCreateTime"` // Automatically set when created
+	UpdatedAt      time.Time                     `json:"updated_at" gorm:"autoUpdateTime"` // Automatically updated on save
+	DeletedAt      gorm.DeletedAt                `json:"-" gorm:"index"`                   // Soft delete keeps click history around
+	User           User                          `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// PasswordFingerprint identifies the current password of the link without revealing its hash, so
+// that access tokens can be bound to it wherever the hash isn't at hand
+func (u *URL) PasswordFingerprint() string {
+	sum := sha256.Sum256([]byte(u.Password))
+	return hex.EncodeToString(sum[:])
 }
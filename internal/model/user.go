@@ -6,11 +6,33 @@ import (
 )
 
 type User struct {
-	ID        uint                      `json:"id" gorm:"primaryKey"`
-	Email     string                    `json:"email" gorm:"unique;not null"`
-	Password  string                    `json:"password" gorm:"not null"`
-	Name      string                    `json:"name" gorm:"not null"`
-	UserRole  common_constants.UserRole `json:"user_role" gorm:"not null"`
-	CreatedAt time.Time                 `json:"created_at"`
-	UpdatedAt time.Time                 `json:"updated_at"`
+	ID       uint                      `json:"id" gorm:"primaryKey"`
+	Email    string                    `json:"email" gorm:"unique;not null"`
+	Password string                    `json:"password" gorm:"not null"`
+	Name     string                    `json:"name" gorm:"not null"`
+	UserRole common_constants.UserRole `json:"user_role" gorm:"not null"`
+	// Locale picks the language of emails to the user, the default locale when empty
+	Locale string `json:"locale" gorm:"type:varchar(16)"`
+	// DisabledAt is set when an admin disables the account, disabled users can't log in or use API keys
+	DisabledAt *time.Time `json:"disabled_at"`
+	// TOTPSecret is encrypted with the data encryption key. It is pending until TOTPEnabledAt is set.
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at"`
+	TOTPLastStep  int64      `json:"-"` // time step of the last accepted code, codes can't be used twice
+	// Phone is verified with a code before it is set, PendingPhone holds it until then
+	Phone           string     `json:"phone"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at"`
+	PendingPhone    string     `json:"-"`
+	// OTPChannel is where one-time codes of the user are delivered, email unless the user picks another
+	OTPChannel    common_constants.OTPChannel `json:"otp_channel" gorm:"not null;default:email;type:varchar(16)"`
+	OTPWebhookURL string                      `json:"-"`
+	// OTPWebhookSecret signs webhook deliveries, it is encrypted with the data encryption key
+	OTPWebhookSecret string    `json:"-"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// TwoFactorEnabled reports whether logins of the user need a TOTP code
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
 }
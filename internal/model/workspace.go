@@ -0,0 +1,44 @@
+package model
+
+import (
+	"github.com/nikhil/url-shortner-backend/constants"
+	"time"
+)
+
+// Workspace owns links. Every user has a personal workspace that only they are a member of,
+// and can create team workspaces shared with other users.
+type Workspace struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	Name           string    `json:"name" gorm:"not null;type:varchar(100)"`
+	PersonalUserID *uint     `json:"-" gorm:"uniqueIndex"` // set on personal workspaces only
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (w *Workspace) IsPersonal() bool {
+	return w.PersonalUserID != nil
+}
+
+type WorkspaceMember struct {
+	ID          uint                           `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint                           `json:"workspace_id" gorm:"not null;uniqueIndex:idx_workspace_members_workspace_user,priority:1"`
+	UserID      uint                           `json:"user_id" gorm:"not null;index;uniqueIndex:idx_workspace_members_workspace_user,priority:2"`
+	Role        common_constants.WorkspaceRole `json:"role" gorm:"not null;type:varchar(16)"`
+	CreatedAt   time.Time                      `json:"created_at"`
+	UpdatedAt   time.Time                      `json:"updated_at"`
+	Workspace   Workspace                      `json:"-" gorm:"foreignKey:WorkspaceID"`
+	User        User                           `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// WorkspaceInvitation is a pending invitation sent by email. Only the hash of its token is stored.
+type WorkspaceInvitation struct {
+	ID          uint                           `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint                           `json:"workspace_id" gorm:"not null;index"`
+	Email       string                         `json:"email" gorm:"not null"`
+	Role        common_constants.WorkspaceRole `json:"role" gorm:"not null;type:varchar(16)"`
+	TokenHash   string                         `json:"-" gorm:"not null;type:char(64);uniqueIndex"`
+	InvitedBy   uint                           `json:"invited_by" gorm:"not null"`
+	ExpiresAt   time.Time                      `json:"expires_at" gorm:"not null"`
+	CreatedAt   time.Time                      `json:"created_at"`
+	Workspace   Workspace                      `json:"-" gorm:"foreignKey:WorkspaceID"`
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type APIKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyRepository {
+	return &APIKeyRepository{
+		db: db,
+	}
+}
+
+func (r *APIKeyRepository) Create(apiKey *model.APIKey) error {
+	return r.db.Create(apiKey).Error
+}
+
+// FindByHash returns the key with the given hash along with its owner
+func (r *APIKeyRepository) FindByHash(keyHash string) (*model.APIKey, error) {
+	var apiKey model.APIKey
+	err := r.db.Preload("User").Where("key_hash = ?", keyHash).First(&apiKey).Error
+	return &apiKey, err
+}
+
+func (r *APIKeyRepository) FindByUserID(userID uint) ([]model.APIKey, error) {
+	var apiKeys []model.APIKey
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&apiKeys).Error
+	return apiKeys, err
+}
+
+func (r *APIKeyRepository) FindByUserIDAndID(userID uint, id uint) (*model.APIKey, error) {
+	var apiKey model.APIKey
+	err := r.db.Where("user_id = ? AND id = ?", userID, id).First(&apiKey).Error
+	return &apiKey, err
+}
+
+func (r *APIKeyRepository) CountByUserID(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.APIKey{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *APIKeyRepository) UpdateLastUsed(id uint, usedAt time.Time, ip string) error {
+	return r.db.Model(&model.APIKey{}).
+		Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"last_used_at": usedAt, "last_used_ip": ip}).Error
+}
+
+func (r *APIKeyRepository) Delete(apiKey *model.APIKey) error {
+	return r.db.Delete(apiKey).Error
+}
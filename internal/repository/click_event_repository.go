@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+const clickEventInsertBatchSize = 500
+
+type ClickEventRepository struct {
+	db *gorm.DB
+}
+
+func NewClickEventRepository(db *gorm.DB) *ClickEventRepository {
+	return &ClickEventRepository{db: db}
+}
+
+func (r *ClickEventRepository) Create(event *model.ClickEvent) error {
+	return r.db.Create(event).Error
+}
+
+func (r *ClickEventRepository) CreateBatch(events []*model.ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return r.db.CreateInBatches(events, clickEventInsertBatchSize).Error
+}
+
+// CountByBucket returns the clicks of a URL grouped by the given postgres date_trunc unit (hour, day, week)
+func (r *ClickEventRepository) CountByBucket(urlID uint, unit string, from, to time.Time) ([]model.ClickBucketCount, error) {
+	var buckets []model.ClickBucketCount
+	err := r.db.Model(&model.ClickEvent{}).
+		Select("date_trunc(?, clicked_at) AS bucket, COUNT(*) AS count", unit).
+		Where("url_id = ? AND clicked_at >= ? AND clicked_at < ?", urlID, from, to).
+		Group("bucket").
+		Order("bucket").
+		Scan(&buckets).Error
+	return buckets, err
+}
+
+func (r *ClickEventRepository) CountTotal(urlID uint, from, to time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.ClickEvent{}).
+		Where("url_id = ? AND clicked_at >= ? AND clicked_at < ?", urlID, from, to).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *ClickEventRepository) TopReferrers(urlID uint, from, to time.Time, limit int) ([]model.ClickDimensionCount, error) {
+	return r.topByColumn("referrer_host", urlID, from, to, limit)
+}
+
+func (r *ClickEventRepository) TopUserAgents(urlID uint, from, to time.Time, limit int) ([]model.ClickDimensionCount, error) {
+	return r.topByColumn("user_agent", urlID, from, to, limit)
+}
+
+func (r *ClickEventRepository) topByColumn(column string, urlID uint, from, to time.Time, limit int) ([]model.ClickDimensionCount, error) {
+	var counts []model.ClickDimensionCount
+	err := r.db.Model(&model.ClickEvent{}).
+		Select(column+" AS value, COUNT(*) AS count").
+		Where("url_id = ? AND clicked_at >= ? AND clicked_at < ?", urlID, from, to).
+		Group(column).
+		Order("count DESC").
+		Limit(limit).
+		Scan(&counts).Error
+	return counts, err
+}
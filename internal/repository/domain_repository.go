@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+
+	common_constants "github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/pkg/redis"
+	"gorm.io/gorm"
+)
+
+type DomainRepository struct {
+	db    *gorm.DB
+	cache redis.CacheClient
+}
+
+func NewDomainRepository(db *gorm.DB, cache redis.CacheClient) *DomainRepository {
+	return &DomainRepository{
+		db:    db,
+		cache: cache,
+	}
+}
+
+func getDomainHostCacheKey(hostname string) string {
+	return "domain_host:" + hostname
+}
+
+// GetDomainIDFromCache returns the cached domain id serving a host, DefaultDomainID meaning no custom domain
+func (r *DomainRepository) GetDomainIDFromCache(ctx context.Context, hostname string) (uint, error) {
+	value, err := r.cache.Get(ctx, getDomainHostCacheKey(hostname))
+	if err != nil {
+		return 0, err
+	}
+	domainID, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return uint(domainID), nil
+}
+
+func (r *DomainRepository) SaveDomainIDToCache(ctx context.Context, hostname string, domainID uint) error {
+	ttl := common_constants.DomainCacheTTL
+	if domainID == common_constants.DefaultDomainID {
+		ttl = common_constants.DomainNegativeCacheTTL
+	}
+	return r.cache.Set(ctx, getDomainHostCacheKey(hostname), strconv.FormatUint(uint64(domainID), 10), ttl)
+}
+
+func (r *DomainRepository) DeleteDomainFromCache(ctx context.Context, hostname string) error {
+	return r.cache.Delete(ctx, getDomainHostCacheKey(hostname))
+}
+
+func (r *DomainRepository) Create(domain *model.Domain) error {
+	return r.db.Create(domain).Error
+}
+
+func (r *DomainRepository) Update(domain *model.Domain) error {
+	return r.db.Save(domain).Error
+}
+
+func (r *DomainRepository) Delete(domain *model.Domain) error {
+	return r.db.Delete(domain).Error
+}
+
+func (r *DomainRepository) FindByID(id uint) (*model.Domain, error) {
+	var domain model.Domain
+	err := r.db.First(&domain, id).Error
+	return &domain, err
+}
+
+func (r *DomainRepository) FindByIDs(ids []uint) ([]model.Domain, error) {
+	var domains []model.Domain
+	err := r.db.Where("id IN ?", ids).Find(&domains).Error
+	return domains, err
+}
+
+func (r *DomainRepository) FindByUserID(userID uint) ([]model.Domain, error) {
+	var domains []model.Domain
+	err := r.db.Where("user_id = ?", userID).Order("id").Find(&domains).Error
+	return domains, err
+}
+
+func (r *DomainRepository) FindByUserIDAndHostname(userID uint, hostname string) (*model.Domain, error) {
+	var domain model.Domain
+	err := r.db.Where("user_id = ? AND hostname = ?", userID, hostname).First(&domain).Error
+	return &domain, err
+}
+
+func (r *DomainRepository) FindVerifiedByHostname(hostname string) (*model.Domain, error) {
+	var domain model.Domain
+	err := r.db.Where("hostname = ? AND verified_at IS NOT NULL", hostname).First(&domain).Error
+	return &domain, err
+}
@@ -1,16 +1,26 @@
 package repository
 
 import (
+	"errors"
+	"strconv"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	common_constants "github.com/nikhil/url-shortner-backend/constants"
 	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
 	"github.com/nikhil/url-shortner-backend/pkg/redis"
 )
 
+var ErrOTPNotFound = errors.New("otp not found")
+
 type IOTPRepository interface {
-	SaveOTP(ctx *gin.Context, email string, otp string) error
-	GetOTP(ctx *gin.Context, email string) (string, error)
-	DeleteOTP(ctx *gin.Context, email string) error
+	SaveOTP(ctx *gin.Context, purpose common_constants.OTPPurpose, email string, otp *model.OTP) error
+	GetOTP(ctx *gin.Context, purpose common_constants.OTPPurpose, email string) (*model.OTP, error)
+	IncrementAttempts(ctx *gin.Context, purpose common_constants.OTPPurpose, email string) (int64, error)
+	DeleteOTP(ctx *gin.Context, purpose common_constants.OTPPurpose, email string) error
+	StartCooldown(ctx *gin.Context, purpose common_constants.OTPPurpose, email string, until time.Time) (bool, error)
+	CooldownUntil(ctx *gin.Context, purpose common_constants.OTPPurpose, email string) (time.Time, error)
 }
 type OTPRepository struct {
 	cache redis.CacheClient
@@ -22,13 +32,26 @@ func NewOTPRepository(cache redis.CacheClient) IOTPRepository {
 	}
 }
 
-func getOTPCacheKey(email string) string {
-	return "otp:" + email
+func getOTPCacheKey(purpose common_constants.OTPPurpose, email string) string {
+	return "otp:" + string(purpose) + ":" + email
+}
+
+func getOTPAttemptsKey(purpose common_constants.OTPPurpose, email string) string {
+	return "otp_attempts:" + string(purpose) + ":" + email
 }
 
-func (o *OTPRepository) SaveOTP(ctx *gin.Context, email string, otp string) error {
+func getOTPCooldownKey(purpose common_constants.OTPPurpose, email string) string {
+	return "otp_cooldown:" + string(purpose) + ":" + email
+}
+
+// SaveOTP stores a new code, replacing the previous one of the purpose along with its failed attempts
+func (o *OTPRepository) SaveOTP(ctx *gin.Context, purpose common_constants.OTPPurpose, email string, otp *model.OTP) error {
 	log := logger.GetLogger(ctx)
-	cacheKey := getOTPCacheKey(email)
+	if err := o.cache.Delete(ctx, getOTPAttemptsKey(purpose, email)); err != nil {
+		log.Errorf("Failed to reset otp attempts of: %s, err: %v", email, err)
+		return err
+	}
+	cacheKey := getOTPCacheKey(purpose, email)
 	err := o.cache.Set(ctx, cacheKey, otp, common_constants.OTPCacheTimeOut)
 	if err != nil {
 		log.Errorf("Failed to set cache key: %s, err: %v", cacheKey, err)
@@ -37,23 +60,62 @@ func (o *OTPRepository) SaveOTP(ctx *gin.Context, email string, otp string) erro
 	return nil
 }
 
-func (o *OTPRepository) GetOTP(ctx *gin.Context, email string) (string, error) {
+// GetOTP returns the pending code of the purpose, ErrOTPNotFound when there is none
+func (o *OTPRepository) GetOTP(ctx *gin.Context, purpose common_constants.OTPPurpose, email string) (*model.OTP, error) {
 	log := logger.GetLogger(ctx)
-	cacheKey := getOTPCacheKey(email)
-	value, err := o.cache.Get(ctx, cacheKey)
+	cacheKey := getOTPCacheKey(purpose, email)
+	exists, err := o.cache.Exists(ctx, cacheKey)
 	if err != nil {
+		log.Errorf("Failed to check cache key: %s, err: %v", cacheKey, err)
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrOTPNotFound
+	}
+	var otp model.OTP
+	if err = o.cache.GetWithUnmarshal(ctx, cacheKey, &otp); err != nil {
 		log.Errorf("Failed to get cache key: %s, err: %v", cacheKey, err)
+		return nil, err
 	}
-	return value, nil
+	return &otp, nil
+}
+
+// IncrementAttempts counts a verification attempt of the pending code and returns the attempts so far
+func (o *OTPRepository) IncrementAttempts(ctx *gin.Context, purpose common_constants.OTPPurpose, email string) (int64, error) {
+	return o.cache.Increment(ctx, getOTPAttemptsKey(purpose, email), common_constants.OTPCacheTimeOut)
 }
 
-func (o *OTPRepository) DeleteOTP(ctx *gin.Context, email string) error {
+func (o *OTPRepository) DeleteOTP(ctx *gin.Context, purpose common_constants.OTPPurpose, email string) error {
 	log := logger.GetLogger(ctx)
-	cacheKey := getOTPCacheKey(email)
-	err := o.cache.Delete(ctx, cacheKey)
-	if err != nil {
-		log.Errorf("Failed to delete cache key: %s, err: %v", cacheKey, err)
-		return err
+	for _, cacheKey := range []string{getOTPCacheKey(purpose, email), getOTPAttemptsKey(purpose, email)} {
+		if err := o.cache.Delete(ctx, cacheKey); err != nil {
+			log.Errorf("Failed to delete cache key: %s, err: %v", cacheKey, err)
+			return err
+		}
 	}
 	return nil
 }
+
+// StartCooldown blocks sending another code of the purpose until the given time. It reports false,
+// without changing anything, while a previous cooldown is running.
+func (o *OTPRepository) StartCooldown(ctx *gin.Context, purpose common_constants.OTPPurpose, email string, until time.Time) (bool, error) {
+	return o.cache.SetNX(ctx, getOTPCooldownKey(purpose, email), strconv.FormatInt(until.Unix(), 10), time.Until(until))
+}
+
+// CooldownUntil returns the end of the running cooldown, the zero time when there is none
+func (o *OTPRepository) CooldownUntil(ctx *gin.Context, purpose common_constants.OTPPurpose, email string) (time.Time, error) {
+	cacheKey := getOTPCooldownKey(purpose, email)
+	exists, err := o.cache.Exists(ctx, cacheKey)
+	if err != nil || !exists {
+		return time.Time{}, err
+	}
+	value, err := o.cache.Get(ctx, cacheKey)
+	if err != nil {
+		return time.Time{}, err
+	}
+	until, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(until, 0), nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IOutboxRepository is what the outbox sender needs of the email queue
+type IOutboxRepository interface {
+	Create(email *model.OutboxEmail) error
+	ClaimNext(now time.Time, lease time.Duration) (*model.OutboxEmail, error)
+	MarkSent(id uint, sentAt time.Time) error
+	MarkFailed(id uint, status common_constants.EmailStatus, nextAttemptAt time.Time, lastError string) error
+	DeleteSentBefore(before time.Time) (int64, error)
+}
+
+type OutboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) *OutboxRepository {
+	return &OutboxRepository{
+		db: db,
+	}
+}
+
+func (r *OutboxRepository) Create(email *model.OutboxEmail) error {
+	return r.db.Create(email).Error
+}
+
+func (r *OutboxRepository) FindByID(id uint) (*model.OutboxEmail, error) {
+	var email model.OutboxEmail
+	err := r.db.First(&email, id).Error
+	return &email, err
+}
+
+// ClaimNext returns the pending email that is due the longest, gorm.ErrRecordNotFound when none is,
+// and hides it from other senders for the lease. Only one email is claimed at a time, so that a
+// slow SMTP server can't keep claimed emails waiting past their lease, when another sender would
+// claim and send them again. Rows claimed by a concurrent sender are skipped rather than waited for.
+func (r *OutboxRepository) ClaimNext(now time.Time, lease time.Duration) (*model.OutboxEmail, error) {
+	var email model.OutboxEmail
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", common_constants.EmailStatusPending, now).
+			Order("next_attempt_at").
+			First(&email).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&email).UpdateColumn("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &email, nil
+}
+
+// MarkSent records a delivered email. The message is dropped, it may hold one-time codes.
+func (r *OutboxRepository) MarkSent(id uint, sentAt time.Time) error {
+	return r.db.Model(&model.OutboxEmail{}).
+		Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{
+			"status":     common_constants.EmailStatusSent,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"message":    []byte{},
+			"last_error": "",
+			"sent_at":    sentAt,
+			"updated_at": sentAt,
+		}).Error
+}
+
+// MarkFailed records a failed attempt, the email is retried at nextAttemptAt unless status is dead
+func (r *OutboxRepository) MarkFailed(id uint, status common_constants.EmailStatus, nextAttemptAt time.Time, lastError string) error {
+	return r.db.Model(&model.OutboxEmail{}).
+		Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{
+			"status":          status,
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": nextAttemptAt,
+			"last_error":      lastError,
+			"updated_at":      time.Now(),
+		}).Error
+}
+
+// Resend queues a dead email again with a fresh set of attempts. It reports false when the
+// email isn't dead.
+func (r *OutboxRepository) Resend(id uint, now time.Time) (bool, error) {
+	result := r.db.Model(&model.OutboxEmail{}).
+		Where("id = ? AND status = ?", id, common_constants.EmailStatusDead).
+		UpdateColumns(map[string]interface{}{
+			"status":          common_constants.EmailStatusPending,
+			"attempts":        0,
+			"next_attempt_at": now,
+			"updated_at":      now,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// DeleteSentBefore deletes the records of emails sent before the given time
+func (r *OutboxRepository) DeleteSentBefore(before time.Time) (int64, error) {
+	result := r.db.Where("status = ? AND sent_at < ?", common_constants.EmailStatusSent, before).
+		Delete(&model.OutboxEmail{})
+	return result.RowsAffected, result.Error
+}
+
+// OutboxListFilter describes which page of emails to fetch for admins, newest first
+type OutboxListFilter struct {
+	Status   string
+	BeforeID uint
+	Limit    int
+}
+
+// FindByFilter returns one page of emails matching the filter and whether there are more
+func (r *OutboxRepository) FindByFilter(filter *OutboxListFilter) ([]model.OutboxEmail, bool, error) {
+	query := r.applyFilter(r.db.Model(&model.OutboxEmail{}), filter)
+	if filter.BeforeID != 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+	var emails []model.OutboxEmail
+	if err := query.Omit("message").Order("id DESC").Limit(filter.Limit + 1).Find(&emails).Error; err != nil {
+		return nil, false, err
+	}
+	if len(emails) <= filter.Limit {
+		return emails, false, nil
+	}
+	return emails[:filter.Limit], true, nil
+}
+
+// CountByFilter counts all emails matching the filter, ignoring the cursor
+func (r *OutboxRepository) CountByFilter(filter *OutboxListFilter) (int64, error) {
+	var count int64
+	err := r.applyFilter(r.db.Model(&model.OutboxEmail{}), filter).Count(&count).Error
+	return count, err
+}
+
+func (r *OutboxRepository) applyFilter(query *gorm.DB, filter *OutboxListFilter) *gorm.DB {
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	return query
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/pkg/redis"
+)
+
+// RateLimitRepository keeps fixed-window attempt counters in redis
+type RateLimitRepository struct {
+	cache redis.CacheClient
+}
+
+func NewRateLimitRepository(cache redis.CacheClient) *RateLimitRepository {
+	return &RateLimitRepository{
+		cache: cache,
+	}
+}
+
+// GetCount returns the current count of a counter, 0 when it doesn't exist (or has expired)
+func (r *RateLimitRepository) GetCount(ctx context.Context, key string) (int64, error) {
+	exists, err := r.cache.Exists(ctx, key)
+	if err != nil || !exists {
+		return 0, err
+	}
+	value, err := r.cache.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// Increment bumps a counter, starting a new window of the given length when the counter doesn't exist
+func (r *RateLimitRepository) Increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return r.cache.Increment(ctx, key, window)
+}
+
+func (r *RateLimitRepository) Reset(ctx context.Context, key string) error {
+	return r.cache.Delete(ctx, key)
+}
+
+// Lock marks key as locked until the given time
+func (r *RateLimitRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	return r.cache.Set(ctx, key, strconv.FormatInt(until.Unix(), 10), time.Until(until))
+}
+
+// TryLock locks key until the given time unless it is locked already. It reports false, without
+// changing anything, when it was locked.
+func (r *RateLimitRepository) TryLock(ctx context.Context, key string, until time.Time) (bool, error) {
+	return r.cache.SetNX(ctx, key, strconv.FormatInt(until.Unix(), 10), time.Until(until))
+}
+
+// LockedUntil returns the time until which key is locked, the zero time when it isn't
+func (r *RateLimitRepository) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	exists, err := r.cache.Exists(ctx, key)
+	if err != nil || !exists {
+		return time.Time{}, err
+	}
+	value, err := r.cache.Get(ctx, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	until, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(until, 0), nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type RecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewRecoveryCodeRepository(db *gorm.DB) *RecoveryCodeRepository {
+	return &RecoveryCodeRepository{
+		db: db,
+	}
+}
+
+// Replace swaps every recovery code of a user for new ones, used or not
+func (r *RecoveryCodeRepository) Replace(userID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]model.RecoveryCode, 0, len(codeHashes))
+		for _, codeHash := range codeHashes {
+			codes = append(codes, model.RecoveryCode{UserID: userID, CodeHash: codeHash})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// Use marks an unused code of the user as used. It reports false when there is no such code.
+func (r *RecoveryCodeRepository) Use(userID uint, codeHash string, usedAt time.Time) (bool, error) {
+	result := r.db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		UpdateColumn("used_at", usedAt)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *RecoveryCodeRepository) CountUnused(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *RecoveryCodeRepository) DeleteByUserID(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type RolePolicyRepository struct {
+	db *gorm.DB
+}
+
+func NewRolePolicyRepository(db *gorm.DB) *RolePolicyRepository {
+	return &RolePolicyRepository{
+		db: db,
+	}
+}
+
+// FindByRole returns the policy of a role, the default policy when none was saved
+func (r *RolePolicyRepository) FindByRole(role common_constants.UserRole) (*model.RolePolicy, error) {
+	policy := model.RolePolicy{Role: role}
+	err := r.db.Where("role = ?", role).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &policy, nil
+	}
+	return &policy, err
+}
+
+func (r *RolePolicyRepository) FindAll() ([]model.RolePolicy, error) {
+	var policies []model.RolePolicy
+	err := r.db.Order("role").Find(&policies).Error
+	return policies, err
+}
+
+// Save creates or updates the policy of its role
+func (r *RolePolicyRepository) Save(policy *model.RolePolicy) error {
+	return r.db.Save(policy).Error
+}
@@ -6,9 +6,11 @@ import (
 	common_constants "github.com/nikhil/url-shortner-backend/constants"
 	"github.com/nikhil/url-shortner-backend/internal/model"
 	"github.com/nikhil/url-shortner-backend/pkg/redis"
+	"sort"
 )
 
-// SessionRepository handles all database operations related to sessions
+// SessionRepository handles all database operations related to sessions.
+// Each session is stored under its own key, and the ids of a user's sessions are kept in a set.
 type SessionRepository struct {
 	cache redis.CacheClient
 }
@@ -20,28 +22,92 @@ func NewSessionRepository(cache redis.CacheClient) *SessionRepository {
 	}
 }
 
-func (s *SessionRepository) getCacheKey(userID uint) string {
-	return fmt.Sprintf("session:%d", userID)
+func (s *SessionRepository) getCacheKey(userID uint, sessionID string) string {
+	return fmt.Sprintf("session:%d:%s", userID, sessionID)
 }
 
-func (s *SessionRepository) IsUserSessionIsValid(ctx *gin.Context, userID uint) error {
-	var session model.Session
-	return s.cache.GetWithUnmarshal(ctx, s.getCacheKey(userID), &session)
+func (s *SessionRepository) getUserSessionsCacheKey(userID uint) string {
+	return fmt.Sprintf("sessions:%d", userID)
 }
 
-func (s *SessionRepository) GetUserSession(ctx *gin.Context, userID uint) (*model.Session, error) {
+func (s *SessionRepository) GetSession(ctx *gin.Context, userID uint, sessionID string) (*model.Session, error) {
 	var session model.Session
-	err := s.cache.GetWithUnmarshal(ctx, s.getCacheKey(userID), &session)
+	err := s.cache.GetWithUnmarshal(ctx, s.getCacheKey(userID, sessionID), &session)
 	if err != nil {
 		return nil, err
 	}
 	return &session, nil
 }
 
-func (s *SessionRepository) UpdateUserSession(ctx *gin.Context, userID uint, session *model.Session) error {
-	return s.cache.Set(ctx, s.getCacheKey(userID), session, common_constants.UserSessionTimeout)
+// SaveSession creates or updates a session, extending its lifetime
+func (s *SessionRepository) SaveSession(ctx *gin.Context, session *model.Session) error {
+	if err := s.cache.Set(ctx, s.getCacheKey(session.UserID, session.ID), session, common_constants.UserSessionTimeout); err != nil {
+		return err
+	}
+	return s.cache.SetAdd(ctx, s.getUserSessionsCacheKey(session.UserID), session.ID, common_constants.UserSessionTimeout)
+}
+
+// ReplaceSession updates a session, extending its lifetime, unless its refresh token has been
+// rotated since it was read with refreshTokenID. It reports false, without changing anything, when
+// it was rotated or the session is gone.
+func (s *SessionRepository) ReplaceSession(ctx *gin.Context, session *model.Session, refreshTokenID string) (bool, error) {
+	replaced, err := s.cache.CompareAndSet(
+		ctx, s.getCacheKey(session.UserID, session.ID), "refresh_token_id", refreshTokenID, session, common_constants.UserSessionTimeout,
+	)
+	if err != nil || !replaced {
+		return false, err
+	}
+	return true, s.cache.SetAdd(ctx, s.getUserSessionsCacheKey(session.UserID), session.ID, common_constants.UserSessionTimeout)
 }
 
-func (s *SessionRepository) DeleteUserSession(ctx *gin.Context, userID uint) error {
-	return s.cache.Delete(ctx, s.getCacheKey(userID))
+// ListSessions returns the live sessions of a user, most recently seen first. Ids of sessions
+// that have expired are dropped from the set on the way.
+func (s *SessionRepository) ListSessions(ctx *gin.Context, userID uint) ([]*model.Session, error) {
+	sessionIDs, err := s.cache.SetMembers(ctx, s.getUserSessionsCacheKey(userID))
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*model.Session, 0, len(sessionIDs))
+	var expiredIDs []string
+	for _, sessionID := range sessionIDs {
+		exists, err := s.cache.Exists(ctx, s.getCacheKey(userID, sessionID))
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			expiredIDs = append(expiredIDs, sessionID)
+			continue
+		}
+		session, err := s.GetSession(ctx, userID, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err = s.cache.SetRemove(ctx, s.getUserSessionsCacheKey(userID), expiredIDs...); err != nil {
+		return nil, err
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (s *SessionRepository) DeleteSession(ctx *gin.Context, userID uint, sessionID string) error {
+	if err := s.cache.Delete(ctx, s.getCacheKey(userID, sessionID)); err != nil {
+		return err
+	}
+	return s.cache.SetRemove(ctx, s.getUserSessionsCacheKey(userID), sessionID)
+}
+
+// DeleteAllSessions logs a user out of every device
+func (s *SessionRepository) DeleteAllSessions(ctx *gin.Context, userID uint) error {
+	sessionIDs, err := s.cache.SetMembers(ctx, s.getUserSessionsCacheKey(userID))
+	if err != nil {
+		return err
+	}
+	for _, sessionID := range sessionIDs {
+		if err = s.cache.Delete(ctx, s.getCacheKey(userID, sessionID)); err != nil {
+			return err
+		}
+	}
+	return s.cache.Delete(ctx, s.getUserSessionsCacheKey(userID))
 }
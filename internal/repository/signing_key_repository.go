@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/pkg/redis"
+	"gorm.io/gorm"
+)
+
+// signingKeyRotationLockKey makes sure only one instance rotates the keys at a time
+const signingKeyRotationLockKey = "signing_key_rotation_lock"
+
+type SigningKeyRepository struct {
+	db    *gorm.DB
+	cache redis.CacheClient
+}
+
+func NewSigningKeyRepository(db *gorm.DB, cache redis.CacheClient) *SigningKeyRepository {
+	return &SigningKeyRepository{
+		db:    db,
+		cache: cache,
+	}
+}
+
+func (r *SigningKeyRepository) Create(key *model.SigningKey) error {
+	return r.db.Create(key).Error
+}
+
+// FindLive returns the keys that aren't retired yet, oldest first
+func (r *SigningKeyRepository) FindLive(now time.Time) ([]model.SigningKey, error) {
+	var keys []model.SigningKey
+	err := r.db.Where("retire_at IS NULL OR retire_at > ?", now).
+		Order("signing_from, id").
+		Find(&keys).Error
+	return keys, err
+}
+
+// RetireActive schedules the retirement of every key that doesn't have a retirement date yet,
+// except the key with the given kid
+func (r *SigningKeyRepository) RetireActive(exceptKID string, retireAt time.Time) error {
+	return r.db.Model(&model.SigningKey{}).
+		Where("retire_at IS NULL AND kid <> ?", exceptKID).
+		UpdateColumn("retire_at", retireAt).Error
+}
+
+func (r *SigningKeyRepository) DeleteRetired(now time.Time) error {
+	return r.db.Where("retire_at <= ?", now).Delete(&model.SigningKey{}).Error
+}
+
+func (r *SigningKeyRepository) AcquireRotationLock(ctx context.Context, ttl time.Duration) (bool, error) {
+	return r.cache.SetNX(ctx, signingKeyRotationLockKey, "1", ttl)
+}
+
+func (r *SigningKeyRepository) ReleaseRotationLock(ctx context.Context) error {
+	return r.cache.Delete(ctx, signingKeyRotationLockKey)
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	URLSortByCreatedAt = "created_at"
+	URLSortByClicks    = "clicks"
+	URLSortByExpiresAt = "expires_at"
+
+	URLStatusActive   = "active"
+	URLStatusExpired  = "expired"
+	URLStatusDisabled = "disabled"
+)
+
+// likeEscaper escapes the wildcards of a user provided ILIKE search term
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// URLListFilter describes which page of a workspace's URLs, or of the URLs created by a user, to fetch
+type URLListFilter struct {
+	WorkspaceID uint
+	UserID      uint
+	Status      string
+	IsProtected *bool
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Search      string
+	SortBy      string
+	Descending  bool
+	Limit       int
+	Cursor      *URLCursor
+}
+
+// URLCursor points right after the last URL of a page: its sort value and its id as tie breaker
+type URLCursor struct {
+	SortBy string `json:"s"`
+	Value  string `json:"v"`
+	ID     uint   `json:"id"`
+}
+
+func (c *URLCursor) Encode() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func DecodeURLCursor(encoded string) (*URLCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	cursor := &URLCursor{}
+	if err = json.Unmarshal(data, cursor); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// Valid reports whether the sort value of the cursor parses as its column's type, clients can tamper
+// with cursors and postgres would fail the cast
+func (c *URLCursor) Valid() bool {
+	sortExpr, ok := urlSortExpressions[c.SortBy]
+	return ok && sortExpr.valid(c.Value)
+}
+
+type urlSortExpression struct {
+	column string
+	cast   string
+	value  func(url *model.URL) string
+	valid  func(value string) bool
+}
+
+func isCursorInt(value string) bool {
+	_, err := strconv.ParseInt(value, 10, 64)
+	return err == nil
+}
+
+func isCursorTime(value string) bool {
+	_, err := time.Parse(time.RFC3339Nano, value)
+	return err == nil
+}
+
+// urlSortExpressions whitelists the sortable columns. Links without expiry sort as if they expired at infinity.
+var urlSortExpressions = map[string]urlSortExpression{
+	URLSortByCreatedAt: {
+		column: "created_at",
+		cast:   "timestamptz",
+		value:  func(url *model.URL) string { return url.CreatedAt.Format(time.RFC3339Nano) },
+		valid:  isCursorTime,
+	},
+	URLSortByClicks: {
+		column: "clicks",
+		cast:   "bigint",
+		value:  func(url *model.URL) string { return strconv.FormatInt(url.Clicks, 10) },
+		valid:  isCursorInt,
+	},
+	URLSortByExpiresAt: {
+		column: "COALESCE(expires_at, 'infinity'::timestamptz)",
+		cast:   "timestamptz",
+		value: func(url *model.URL) string {
+			if url.ExpiresAt == nil {
+				return "infinity"
+			}
+			return url.ExpiresAt.Format(time.RFC3339Nano)
+		},
+		valid: func(value string) bool { return value == "infinity" || isCursorTime(value) },
+	},
+}
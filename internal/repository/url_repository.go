@@ -1,19 +1,86 @@
 package repository
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	common_constants "github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/dto"
 	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/pkg/redis"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
+	"sort"
+	"strings"
 	"time"
 )
 
+// ErrURLCachedAsNotFound is returned when the cache remembers that a short code does not exist
+var ErrURLCachedAsNotFound = errors.New("short code cached as not found")
+
+// urlNotFoundCacheValue is stored for unknown short codes so that repeated misses don't reach postgres
+const urlNotFoundCacheValue = "__not_found__"
+
+// urlExpiredCondition matches links past their expiry date or click limit
+const urlExpiredCondition = "(expires_at <= ? OR (max_clicks IS NOT NULL AND clicks >= max_clicks))"
+
 type URLRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	cache redis.CacheClient
+}
+
+func NewURLRepository(db *gorm.DB, cache redis.CacheClient) *URLRepository {
+	return &URLRepository{
+		db:    db,
+		cache: cache,
+	}
+}
+
+func getURLCacheKey(domainID uint, shortCode string) string {
+	return fmt.Sprintf("redirect_url:%d:%s", domainID, shortCode)
+}
+
+// GetURLFromCache returns the cached link of a short code, or ErrURLCachedAsNotFound for a negative entry
+func (r *URLRepository) GetURLFromCache(ctx context.Context, domainID uint, shortCode string) (*dto.RedirectURL, error) {
+	value, err := r.cache.Get(ctx, getURLCacheKey(domainID, shortCode))
+	if err != nil {
+		return nil, err
+	}
+	if value == urlNotFoundCacheValue {
+		return nil, ErrURLCachedAsNotFound
+	}
+	url := &dto.RedirectURL{}
+	if err = json.Unmarshal([]byte(value), url); err != nil {
+		return nil, err
+	}
+	return url, nil
+}
+
+// SaveURLToCache caches a link without ever outliving its expiry. Links with a click limit are
+// not cached at all since their click count has to be read fresh.
+func (r *URLRepository) SaveURLToCache(ctx context.Context, url *dto.RedirectURL) error {
+	if url.MaxClicks != nil {
+		return nil
+	}
+	ttl := common_constants.URLCacheTTL
+	if url.ExpiresAt != nil {
+		untilExpiry := time.Until(*url.ExpiresAt)
+		if untilExpiry <= 0 {
+			// Already expired, keep it briefly so expired links don't hammer postgres either
+			ttl = common_constants.URLNegativeCacheTTL
+		} else if untilExpiry < ttl {
+			ttl = untilExpiry
+		}
+	}
+	return r.cache.Set(ctx, getURLCacheKey(url.DomainID, url.ShortCode), url, ttl)
 }
 
-func NewURLRepository(db *gorm.DB) *URLRepository {
-	return &URLRepository{db: db}
+func (r *URLRepository) SaveURLNotFoundToCache(ctx context.Context, domainID uint, shortCode string) error {
+	return r.cache.Set(ctx, getURLCacheKey(domainID, shortCode), urlNotFoundCacheValue, common_constants.URLNegativeCacheTTL)
+}
+
+func (r *URLRepository) DeleteURLFromCache(ctx context.Context, domainID uint, shortCode string) error {
+	return r.cache.Delete(ctx, getURLCacheKey(domainID, shortCode))
 }
 
 func (r *URLRepository) Create(url *model.URL) error {
@@ -24,46 +91,185 @@ func (r *URLRepository) CreateBulk(urls []*model.URL) error {
 	return r.db.Create(urls).Error
 }
 
-func (r *URLRepository) FindByShortCode(shortCode string) (*model.URL, error) {
+// urlEditableColumns are the columns that edits of a link may change. The click count is left out
+// since the click tracker increments it concurrently.
+var urlEditableColumns = []string{
+	"long_url", "password", "is_protected", "short_code", "expires_at", "max_clicks", "expired_at",
+	"notify_on_expiry", "redirect_type", "disabled_at",
+}
+
+// Update writes the edits of a link without overwriting its click count
+func (r *URLRepository) Update(url *model.URL) error {
+	return r.db.Model(url).Select(urlEditableColumns).Updates(url).Error
+}
+
+func (r *URLRepository) Delete(url *model.URL) error {
+	return r.db.Delete(url).Error
+}
+
+// ExistsShortCode also looks at soft deleted URLs: their short codes stay claimed so old links can't be hijacked
+func (r *URLRepository) ExistsShortCode(domainID uint, shortCode string) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&model.URL{}).
+		Where("domain_id = ? AND short_code = ?", domainID, shortCode).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *URLRepository) FindByShortCode(domainID uint, shortCode string) (*model.URL, error) {
 	var url model.URL
-	err := r.db.Where("short_code = ?", shortCode).First(&url).Error
+	err := r.db.Where("domain_id = ? AND short_code = ?", domainID, shortCode).First(&url).Error
 	return &url, err
 }
 
-func (r *URLRepository) FindByUserID(userID uint) ([]model.URL, error) {
+func (r *URLRepository) FindByID(id uint) (*model.URL, error) {
+	var url model.URL
+	err := r.db.First(&url, id).Error
+	return &url, err
+}
+
+func (r *URLRepository) CountByWorkspaceID(workspaceID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.URL{}).Where("workspace_id = ?", workspaceID).Count(&count).Error
+	return count, err
+}
+
+func (r *URLRepository) CountByDomainID(domainID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.URL{}).Where("domain_id = ?", domainID).Count(&count).Error
+	return count, err
+}
+
+// FindByFilter returns one page of URLs matching the filter, ordered with keyset pagination.
+// The returned cursor is empty on the last page.
+func (r *URLRepository) FindByFilter(filter *URLListFilter) ([]model.URL, string, error) {
+	sortExpr := urlSortExpressions[filter.SortBy]
+	direction, comparator := "ASC", ">"
+	if filter.Descending {
+		direction, comparator = "DESC", "<"
+	}
+
+	query := r.applyFilter(r.db.Model(&model.URL{}), filter)
+	if filter.Cursor != nil {
+		query = query.Where(
+			fmt.Sprintf("(%s, id) %s (?::%s, ?)", sortExpr.column, comparator, sortExpr.cast),
+			filter.Cursor.Value, filter.Cursor.ID,
+		)
+	}
+
 	var urls []model.URL
-	err := r.db.Where("user_id = ?", userID).Find(&urls).Error
-	return urls, err
+	err := query.
+		Order(fmt.Sprintf("%s %s, id %s", sortExpr.column, direction, direction)).
+		Limit(filter.Limit + 1).
+		Find(&urls).Error
+	if err != nil {
+		return nil, "", err
+	}
+	if len(urls) <= filter.Limit {
+		return urls, "", nil
+	}
+
+	urls = urls[:filter.Limit]
+	last := urls[len(urls)-1]
+	nextCursor, err := (&URLCursor{SortBy: filter.SortBy, Value: sortExpr.value(&last), ID: last.ID}).Encode()
+	if err != nil {
+		return nil, "", err
+	}
+	return urls, nextCursor, nil
 }
 
-func (r *URLRepository) IncrementClicks(shortCode string) error {
-	// Start a transaction
-	return r.db.Transaction(func(tx *gorm.DB) error {
-		var url model.URL
+// CountByFilter counts all URLs matching the filter, ignoring the cursor
+func (r *URLRepository) CountByFilter(filter *URLListFilter) (int64, error) {
+	var count int64
+	err := r.applyFilter(r.db.Model(&model.URL{}), filter).Count(&count).Error
+	return count, err
+}
 
-		// Lock the row for update
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-			Where("short_code = ?", shortCode).
-			First(&url).Error; err != nil {
-			return err
-		}
+func (r *URLRepository) applyFilter(query *gorm.DB, filter *URLListFilter) *gorm.DB {
+	if filter.WorkspaceID != 0 {
+		query = query.Where("workspace_id = ?", filter.WorkspaceID)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	switch filter.Status {
+	case URLStatusActive:
+		query = query.Where(
+			"disabled_at IS NULL AND expired_at IS NULL AND (expires_at IS NULL OR expires_at > ?) AND (max_clicks IS NULL OR clicks < max_clicks)",
+			time.Now(),
+		)
+	case URLStatusExpired:
+		query = query.Where("(expired_at IS NOT NULL OR "+urlExpiredCondition+")", time.Now())
+	case URLStatusDisabled:
+		query = query.Where("disabled_at IS NOT NULL")
+	}
+	if filter.IsProtected != nil {
+		query = query.Where("is_protected = ?", *filter.IsProtected)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		query = query.Where("created_at >= ?", filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		query = query.Where("created_at < ?", filter.CreatedTo)
+	}
+	if filter.Search != "" {
+		pattern := "%" + likeEscaper.Replace(filter.Search) + "%"
+		query = query.Where("(long_url ILIKE ? OR short_code ILIKE ?)", pattern, pattern)
+	}
+	return query
+}
 
-		// Perform the increment
-		result := tx.Model(&url).
-			Where("short_code = ?", shortCode).
-			Updates(map[string]interface{}{
-				"clicks":     gorm.Expr("clicks + ?", 1),
-				"updated_at": time.Now(),
-			})
+// FindUnmarkedExpired returns, with their owner, up to limit links that have expired but haven't been marked yet
+func (r *URLRepository) FindUnmarkedExpired(now time.Time, limit int) ([]model.URL, error) {
+	var urls []model.URL
+	err := r.db.Preload("User").
+		Where("expired_at IS NULL AND "+urlExpiredCondition, now).
+		Order("id").
+		Limit(limit).
+		Find(&urls).Error
+	return urls, err
+}
 
-		if result.Error != nil {
-			return result.Error
-		}
+func (r *URLRepository) MarkExpired(ids []uint, expiredAt time.Time) error {
+	return r.db.Model(&model.URL{}).
+		Where("id IN ? AND expired_at IS NULL", ids).
+		UpdateColumn("expired_at", expiredAt).Error
+}
 
-		if result.RowsAffected == 0 {
-			return errors.New("failed to increment clicks: no rows affected")
-		}
+// clickIncrementBatchSize bounds the URLs of one UPDATE, two bind parameters each, well below
+// the 65535 parameters Postgres accepts in a statement
+const clickIncrementBatchSize = 1000
+
+// IncrementClicksBatch adds the buffered click deltas to their URLs, one UPDATE per batch of URLs.
+// The batches share a transaction, so a failed flush applies nothing and can be retried whole.
+// IDs are applied in ascending order so concurrent flushes lock rows in the same order.
+func (r *URLRepository) IncrementClicksBatch(deltas map[uint]int64) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(deltas))
+	for id := range deltas {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
 
+	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(ids); start += clickIncrementBatchSize {
+			batch := ids[start:min(start+clickIncrementBatchSize, len(ids))]
+			values := make([]string, 0, len(batch))
+			args := []interface{}{now}
+			for _, id := range batch {
+				values = append(values, "(?::bigint, ?::bigint)")
+				args = append(args, id, deltas[id])
+			}
+			query := "UPDATE urls SET clicks = urls.clicks + v.delta, updated_at = ? " +
+				"FROM (VALUES " + strings.Join(values, ", ") + ") AS v(id, delta) " +
+				"WHERE urls.id = v.id"
+			if err := tx.Exec(query, args...).Error; err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 }
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
 	"github.com/nikhil/url-shortner-backend/internal/model"
 	"github.com/nikhil/url-shortner-backend/pkg/redis"
 	"gorm.io/gorm"
@@ -50,9 +51,56 @@ func (r *UserRepository) Create(user *model.User) error {
 	return r.db.Create(user).Error
 }
 
-func (r *UserRepository) Update(user *model.User) error {
-	return r.db.Save(user).Error
+// UpdatePassword sets the password hash of a user
+func (r *UserRepository) UpdatePassword(userID uint, hashedPassword string) error {
+	return r.db.Model(&model.User{}).Where("id = ?", userID).UpdateColumn("password", hashedPassword).Error
 }
+
+// SetDisabledAt disables a user, or enables them again with nil
+func (r *UserRepository) SetDisabledAt(userID uint, disabledAt *time.Time) error {
+	return r.db.Model(&model.User{}).Where("id = ?", userID).UpdateColumn("disabled_at", disabledAt).Error
+}
+
+// SetRole changes the role of a user
+func (r *UserRepository) SetRole(userID uint, role common_constants.UserRole) error {
+	return r.db.Model(&model.User{}).Where("id = ?", userID).UpdateColumn("user_role", role).Error
+}
+
+// UpdateTOTP sets the TOTP secret of a user and whether it is enabled
+func (r *UserRepository) UpdateTOTP(userID uint, secret string, enabledAt *time.Time) error {
+	return r.db.Model(&model.User{}).
+		Where("id = ?", userID).
+		UpdateColumns(map[string]interface{}{"totp_secret": secret, "totp_enabled_at": enabledAt}).Error
+}
+
+// AdvanceTOTPStep records the step of an accepted code. It reports false when a code of that step or
+// a later one was already accepted, so that a code can't be replayed even by concurrent requests.
+func (r *UserRepository) AdvanceTOTPStep(userID uint, step int64) (bool, error) {
+	result := r.db.Model(&model.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		UpdateColumn("totp_last_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+// UpdateOTPChannel sets where one-time codes of a user are delivered
+func (r *UserRepository) UpdateOTPChannel(userID uint, channel common_constants.OTPChannel, webhookURL string, webhookSecret string) error {
+	return r.db.Model(&model.User{}).
+		Where("id = ?", userID).
+		UpdateColumns(map[string]interface{}{"otp_channel": channel, "otp_webhook_url": webhookURL, "otp_webhook_secret": webhookSecret}).Error
+}
+
+// UpdateLocale sets the language of emails to a user
+func (r *UserRepository) UpdateLocale(userID uint, locale string) error {
+	return r.db.Model(&model.User{}).Where("id = ?", userID).UpdateColumn("locale", locale).Error
+}
+
+// UpdatePhone sets the phone number of a user, along with the number waiting for verification
+func (r *UserRepository) UpdatePhone(userID uint, phone string, verifiedAt *time.Time, pendingPhone string) error {
+	return r.db.Model(&model.User{}).
+		Where("id = ?", userID).
+		UpdateColumns(map[string]interface{}{"phone": phone, "phone_verified_at": verifiedAt, "pending_phone": pendingPhone}).Error
+}
+
 func (r *UserRepository) FindByEmail(email string) (*model.User, error) {
 	var user model.User
 	err := r.db.Where("email = ?", email).First(&user).Error
@@ -70,3 +118,57 @@ func (r *UserRepository) FindAll() ([]model.User, error) {
 	err := r.db.Find(&users).Error
 	return users, err
 }
+
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+)
+
+// UserListFilter describes which page of users to fetch for admins, ordered by id
+type UserListFilter struct {
+	Search  string
+	Role    string
+	Status  string
+	AfterID uint
+	Limit   int
+}
+
+// FindByFilter returns one page of users matching the filter and whether there are more
+func (r *UserRepository) FindByFilter(filter *UserListFilter) ([]model.User, bool, error) {
+	query := r.applyFilter(r.db.Model(&model.User{}), filter)
+	if filter.AfterID != 0 {
+		query = query.Where("id > ?", filter.AfterID)
+	}
+	var users []model.User
+	if err := query.Order("id").Limit(filter.Limit + 1).Find(&users).Error; err != nil {
+		return nil, false, err
+	}
+	if len(users) <= filter.Limit {
+		return users, false, nil
+	}
+	return users[:filter.Limit], true, nil
+}
+
+// CountByFilter counts all users matching the filter, ignoring the cursor
+func (r *UserRepository) CountByFilter(filter *UserListFilter) (int64, error) {
+	var count int64
+	err := r.applyFilter(r.db.Model(&model.User{}), filter).Count(&count).Error
+	return count, err
+}
+
+func (r *UserRepository) applyFilter(query *gorm.DB, filter *UserListFilter) *gorm.DB {
+	if filter.Search != "" {
+		pattern := "%" + likeEscaper.Replace(filter.Search) + "%"
+		query = query.Where("(email ILIKE ? OR name ILIKE ?)", pattern, pattern)
+	}
+	if filter.Role != "" {
+		query = query.Where("user_role = ?", filter.Role)
+	}
+	switch filter.Status {
+	case UserStatusActive:
+		query = query.Where("disabled_at IS NULL")
+	case UserStatusDisabled:
+		query = query.Where("disabled_at IS NOT NULL")
+	}
+	return query
+}
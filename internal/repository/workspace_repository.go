@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type WorkspaceRepository struct {
+	db *gorm.DB
+}
+
+func NewWorkspaceRepository(db *gorm.DB) *WorkspaceRepository {
+	return &WorkspaceRepository{
+		db: db,
+	}
+}
+
+// CreateWithOwner creates a workspace along with its first owner
+func (r *WorkspaceRepository) CreateWithOwner(workspace *model.Workspace, ownerID uint) (*model.WorkspaceMember, error) {
+	member := &model.WorkspaceMember{UserID: ownerID, Role: common_constants.WorkspaceRoleOwner}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(workspace).Error; err != nil {
+			return err
+		}
+		member.WorkspaceID = workspace.ID
+		return tx.Create(member).Error
+	})
+	member.Workspace = *workspace
+	return member, err
+}
+
+func (r *WorkspaceRepository) Update(workspace *model.Workspace) error {
+	return r.db.Save(workspace).Error
+}
+
+// Delete removes a workspace with its members and pending invitations
+func (r *WorkspaceRepository) Delete(workspace *model.Workspace) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace_id = ?", workspace.ID).Delete(&model.WorkspaceInvitation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("workspace_id = ?", workspace.ID).Delete(&model.WorkspaceMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(workspace).Error
+	})
+}
+
+func (r *WorkspaceRepository) FindPersonal(userID uint) (*model.Workspace, error) {
+	var workspace model.Workspace
+	err := r.db.Where("personal_user_id = ?", userID).First(&workspace).Error
+	return &workspace, err
+}
+
+// FindMember returns the membership of a user in a workspace, along with the workspace
+func (r *WorkspaceRepository) FindMember(workspaceID uint, userID uint) (*model.WorkspaceMember, error) {
+	var member model.WorkspaceMember
+	err := r.db.Preload("Workspace").
+		Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
+		First(&member).Error
+	return &member, err
+}
+
+// FindMembershipsByUserID returns the memberships of a user along with their workspace, personal workspace first
+func (r *WorkspaceRepository) FindMembershipsByUserID(userID uint) ([]model.WorkspaceMember, error) {
+	var members []model.WorkspaceMember
+	err := r.db.Preload("Workspace").
+		Joins("JOIN workspaces ON workspaces.id = workspace_members.workspace_id").
+		Where("workspace_members.user_id = ?", userID).
+		Order("workspaces.personal_user_id IS NULL, workspaces.name, workspaces.id").
+		Find(&members).Error
+	return members, err
+}
+
+// FindMembers returns the members of a workspace along with their user
+func (r *WorkspaceRepository) FindMembers(workspaceID uint) ([]model.WorkspaceMember, error) {
+	var members []model.WorkspaceMember
+	err := r.db.Preload("User").
+		Where("workspace_id = ?", workspaceID).
+		Order("id").
+		Find(&members).Error
+	return members, err
+}
+
+func (r *WorkspaceRepository) CountOwners(workspaceID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.WorkspaceMember{}).
+		Where("workspace_id = ? AND role = ?", workspaceID, common_constants.WorkspaceRoleOwner).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *WorkspaceRepository) CreateMember(member *model.WorkspaceMember) error {
+	return r.db.Create(member).Error
+}
+
+func (r *WorkspaceRepository) UpdateMember(member *model.WorkspaceMember) error {
+	return r.db.Save(member).Error
+}
+
+func (r *WorkspaceRepository) DeleteMember(member *model.WorkspaceMember) error {
+	return r.db.Delete(member).Error
+}
+
+func (r *WorkspaceRepository) CreateInvitation(invitation *model.WorkspaceInvitation) error {
+	return r.db.Create(invitation).Error
+}
+
+// FindInvitationByTokenHash returns an invitation that hasn't expired yet, along with its workspace
+func (r *WorkspaceRepository) FindInvitationByTokenHash(tokenHash string, now time.Time) (*model.WorkspaceInvitation, error) {
+	var invitation model.WorkspaceInvitation
+	err := r.db.Preload("Workspace").
+		Where("token_hash = ? AND expires_at > ?", tokenHash, now).
+		First(&invitation).Error
+	return &invitation, err
+}
+
+func (r *WorkspaceRepository) FindInvitation(workspaceID uint, id uint) (*model.WorkspaceInvitation, error) {
+	var invitation model.WorkspaceInvitation
+	err := r.db.Where("workspace_id = ? AND id = ?", workspaceID, id).First(&invitation).Error
+	return &invitation, err
+}
+
+// FindPendingInvitations returns the invitations of a workspace that haven't expired yet
+func (r *WorkspaceRepository) FindPendingInvitations(workspaceID uint, now time.Time) ([]model.WorkspaceInvitation, error) {
+	var invitations []model.WorkspaceInvitation
+	err := r.db.Where("workspace_id = ? AND expires_at > ?", workspaceID, now).
+		Order("created_at DESC").
+		Find(&invitations).Error
+	return invitations, err
+}
+
+func (r *WorkspaceRepository) DeleteInvitation(invitation *model.WorkspaceInvitation) error {
+	return r.db.Delete(invitation).Error
+}
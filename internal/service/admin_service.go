@@ -0,0 +1,354 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/dto"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/repository"
+	"github.com/nikhil/url-shortner-backend/internal/service/email_service"
+	"github.com/nikhil/url-shortner-backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+const defaultUserPageSize = 20
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrCannotDisableSelf  = errors.New("admins can't disable their own account")
+	ErrCannotDisableAdmin = errors.New("admin accounts can't be disabled, demote them first")
+	ErrUnknownRole        = errors.New("unknown role")
+	ErrEmailNotFound      = errors.New("email not found")
+	ErrEmailNotDead       = errors.New("only dead emails can be resent")
+)
+
+// AdminService backs the admin API: user moderation and link takedowns
+type AdminService struct {
+	userRepo       *repository.UserRepository
+	sessionRepo    *repository.SessionRepository
+	rolePolicyRepo *repository.RolePolicyRepository
+	outboxRepo     *repository.OutboxRepository
+	urlService     *URLService
+	emailTemplates *email_service.TemplateRegistry
+}
+
+func NewAdminService(
+	userRepo *repository.UserRepository,
+	sessionRepo *repository.SessionRepository,
+	rolePolicyRepo *repository.RolePolicyRepository,
+	outboxRepo *repository.OutboxRepository,
+	urlService *URLService,
+	emailTemplates *email_service.TemplateRegistry,
+) *AdminService {
+	return &AdminService{
+		userRepo:       userRepo,
+		sessionRepo:    sessionRepo,
+		rolePolicyRepo: rolePolicyRepo,
+		outboxRepo:     outboxRepo,
+		urlService:     urlService,
+		emailTemplates: emailTemplates,
+	}
+}
+
+func newAdminUserResponse(user *model.User) *dto.AdminUserResponse {
+	return &dto.AdminUserResponse{
+		ID:               user.ID,
+		Email:            user.Email,
+		Name:             user.Name,
+		UserRole:         user.UserRole,
+		DisabledAt:       user.DisabledAt,
+		TwoFactorEnabled: user.TwoFactorEnabled(),
+		CreatedAt:        user.CreatedAt,
+		UpdatedAt:        user.UpdatedAt,
+	}
+}
+
+// ListUsers returns one page of users, searched by email or name, along with the cursor of the next page
+func (s *AdminService) ListUsers(ctx *gin.Context, req *dto.AdminListUsersRequest) ([]*dto.AdminUserResponse, *utils.PaginationMeta, error) {
+	log := logger.GetLogger(ctx)
+	filter := &repository.UserListFilter{
+		Search: strings.TrimSpace(req.Search),
+		Role:   req.Role,
+		Status: req.Status,
+		Limit:  req.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultUserPageSize
+	}
+	if req.Cursor != "" {
+		afterID, err := strconv.ParseUint(req.Cursor, 10, 64)
+		if err != nil {
+			return nil, nil, ErrInvalidCursor
+		}
+		filter.AfterID = uint(afterID)
+	}
+
+	users, hasMore, err := s.userRepo.FindByFilter(filter)
+	if err != nil {
+		log.Errorf("ListUsers err: %v", err)
+		return nil, nil, err
+	}
+	total, err := s.userRepo.CountByFilter(filter)
+	if err != nil {
+		log.Errorf("ListUsers count err: %v", err)
+		return nil, nil, err
+	}
+	responses := make([]*dto.AdminUserResponse, 0, len(users))
+	for i := range users {
+		responses = append(responses, newAdminUserResponse(&users[i]))
+	}
+	meta := &utils.PaginationMeta{TotalCount: total, Limit: filter.Limit}
+	if hasMore {
+		meta.NextCursor = strconv.FormatUint(uint64(users[len(users)-1].ID), 10)
+	}
+	return responses, meta, nil
+}
+
+func (s *AdminService) GetUser(ctx *gin.Context, userID uint) (*dto.AdminUserResponse, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return newAdminUserResponse(user), nil
+}
+
+func (s *AdminService) findUser(ctx *gin.Context, userID uint) (*model.User, error) {
+	log := logger.GetLogger(ctx)
+	user, err := s.userRepo.FindByID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		log.Errorf("Failed to find user: %d, err: %v", userID, err)
+		return nil, err
+	}
+	return user, nil
+}
+
+// DisableUser blocks an account and logs it out everywhere. Its links keep working.
+func (s *AdminService) DisableUser(ctx *gin.Context, adminID uint, userID uint) (*dto.AdminUserResponse, error) {
+	log := logger.GetLogger(ctx)
+	if adminID == userID {
+		return nil, ErrCannotDisableSelf
+	}
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.UserRole == common_constants.UserRoleAdmin {
+		return nil, ErrCannotDisableAdmin
+	}
+	if user.DisabledAt == nil {
+		now := time.Now()
+		if err = s.userRepo.SetDisabledAt(userID, &now); err != nil {
+			log.Errorf("DisableUser err: %v", err)
+			return nil, err
+		}
+		user.DisabledAt = &now
+	}
+	if err = s.sessionRepo.DeleteAllSessions(ctx, userID); err != nil {
+		log.Errorf("Failed to delete sessions of disabled user: %d, err: %v", userID, err)
+		return nil, err
+	}
+	log.Infof("Admin: %d disabled user: %d", adminID, userID)
+	return newAdminUserResponse(user), nil
+}
+
+func (s *AdminService) EnableUser(ctx *gin.Context, adminID uint, userID uint) (*dto.AdminUserResponse, error) {
+	log := logger.GetLogger(ctx)
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		if err = s.userRepo.SetDisabledAt(userID, nil); err != nil {
+			log.Errorf("EnableUser err: %v", err)
+			return nil, err
+		}
+		user.DisabledAt = nil
+	}
+	log.Infof("Admin: %d enabled user: %d", adminID, userID)
+	return newAdminUserResponse(user), nil
+}
+
+// LogoutUser revokes every session of a user, their API keys keep working
+func (s *AdminService) LogoutUser(ctx *gin.Context, adminID uint, userID uint) error {
+	log := logger.GetLogger(ctx)
+	if _, err := s.findUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.sessionRepo.DeleteAllSessions(ctx, userID); err != nil {
+		log.Errorf("Failed to delete sessions of user: %d, err: %v", userID, err)
+		return err
+	}
+	log.Infof("Admin: %d logged out user: %d", adminID, userID)
+	return nil
+}
+
+func (s *AdminService) ListUserURLs(ctx *gin.Context, userID uint, req *dto.ListURLsRequest) ([]model.URL, *utils.PaginationMeta, error) {
+	if _, err := s.findUser(ctx, userID); err != nil {
+		return nil, nil, err
+	}
+	return s.urlService.GetUserURLs(ctx, userID, req)
+}
+
+func (s *AdminService) SetURLDisabled(ctx *gin.Context, adminID uint, urlID uint, disabled bool) (*model.URL, error) {
+	url, err := s.urlService.SetURLDisabled(ctx, urlID, disabled)
+	if err != nil {
+		return nil, err
+	}
+	logger.GetLogger(ctx).Infof("Admin: %d set disabled: %t on url: %d", adminID, disabled, urlID)
+	return url, nil
+}
+
+// ListRolePolicies returns the policy of every role, defaults included
+func (s *AdminService) ListRolePolicies(ctx *gin.Context) ([]*model.RolePolicy, error) {
+	log := logger.GetLogger(ctx)
+	roles := []common_constants.UserRole{common_constants.UserRoleAdmin, common_constants.UserRoleUser}
+	policies := make([]*model.RolePolicy, 0, len(roles))
+	for _, role := range roles {
+		policy, err := s.rolePolicyRepo.FindByRole(role)
+		if err != nil {
+			log.Errorf("Failed to get policy of role: %s, err: %v", role, err)
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// UpdateRolePolicy changes the requirements of a role. Requiring two-factor authentication applies
+// from the next login of its users: those without it have to enroll before they get a session.
+func (s *AdminService) UpdateRolePolicy(
+	ctx *gin.Context, adminID uint, role common_constants.UserRole, req *dto.UpdateRolePolicyRequest,
+) (*model.RolePolicy, error) {
+	log := logger.GetLogger(ctx)
+	if role != common_constants.UserRoleAdmin && role != common_constants.UserRoleUser {
+		return nil, ErrUnknownRole
+	}
+	policy, err := s.rolePolicyRepo.FindByRole(role)
+	if err != nil {
+		log.Errorf("Failed to get policy of role: %s, err: %v", role, err)
+		return nil, err
+	}
+	policy.RequireTwoFactor = *req.RequireTwoFactor
+	if err = s.rolePolicyRepo.Save(policy); err != nil {
+		log.Errorf("UpdateRolePolicy err: %v", err)
+		return nil, err
+	}
+	log.Infof("Admin: %d set require_two_factor: %t on role: %s", adminID, policy.RequireTwoFactor, role)
+	return policy, nil
+}
+
+// BootstrapAdmins promotes the registered users among the given emails to admins. Unknown
+// emails are skipped, their owners are promoted on the first start after they sign up.
+func (s *AdminService) BootstrapAdmins(log *logger.Logger, emails []string) error {
+	for _, email := range emails {
+		email = strings.TrimSpace(email)
+		if email == "" {
+			continue
+		}
+		user, err := s.userRepo.FindByEmail(email)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warnf("Admin bootstrap: no user registered with email: %s", email)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if user.UserRole == common_constants.UserRoleAdmin {
+			continue
+		}
+		if err = s.userRepo.SetRole(user.ID, common_constants.UserRoleAdmin); err != nil {
+			return err
+		}
+		log.Infof("Admin bootstrap: promoted user: %d to admin", user.ID)
+	}
+	return nil
+}
+
+// ListEmailTemplates lists the transactional email templates and their locales
+func (s *AdminService) ListEmailTemplates(ctx *gin.Context) []email_service.TemplateInfo {
+	return s.emailTemplates.Templates()
+}
+
+// PreviewEmailTemplate renders a template with sample data, from the templates directory when it
+// overrides the template, so that copy changes can be checked before they reach users
+func (s *AdminService) PreviewEmailTemplate(ctx *gin.Context, name string, locale string) (*email_service.RenderedEmail, error) {
+	log := logger.GetLogger(ctx)
+	email, err := s.emailTemplates.Preview(common_constants.EmailTemplate(name), locale)
+	if err != nil && !errors.Is(err, email_service.ErrUnknownTemplate) {
+		log.Warnf("Failed to preview email template: %s, locale: %s, err: %v", name, locale, err)
+	}
+	return email, err
+}
+
+// ListEmails returns one page of outbox emails, newest first
+func (s *AdminService) ListEmails(ctx *gin.Context, req *dto.AdminListEmailsRequest) ([]model.OutboxEmail, *utils.PaginationMeta, error) {
+	log := logger.GetLogger(ctx)
+	filter := &repository.OutboxListFilter{Status: req.Status, Limit: req.Limit}
+	if filter.Limit == 0 {
+		filter.Limit = defaultUserPageSize
+	}
+	if req.Cursor != "" {
+		beforeID, err := strconv.ParseUint(req.Cursor, 10, 64)
+		if err != nil {
+			return nil, nil, ErrInvalidCursor
+		}
+		filter.BeforeID = uint(beforeID)
+	}
+
+	emails, hasMore, err := s.outboxRepo.FindByFilter(filter)
+	if err != nil {
+		log.Errorf("ListEmails err: %v", err)
+		return nil, nil, err
+	}
+	total, err := s.outboxRepo.CountByFilter(filter)
+	if err != nil {
+		log.Errorf("ListEmails count err: %v", err)
+		return nil, nil, err
+	}
+	meta := &utils.PaginationMeta{TotalCount: total, Limit: filter.Limit}
+	if hasMore {
+		meta.NextCursor = strconv.FormatUint(uint64(emails[len(emails)-1].ID), 10)
+	}
+	return emails, meta, nil
+}
+
+func (s *AdminService) GetEmail(ctx *gin.Context, emailID uint) (*model.OutboxEmail, error) {
+	log := logger.GetLogger(ctx)
+	email, err := s.outboxRepo.FindByID(emailID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEmailNotFound
+	}
+	if err != nil {
+		log.Errorf("Failed to get email: %d, err: %v", emailID, err)
+		return nil, err
+	}
+	return email, nil
+}
+
+// ResendEmail queues a dead email again, with a fresh set of attempts
+func (s *AdminService) ResendEmail(ctx *gin.Context, adminID uint, emailID uint) (*model.OutboxEmail, error) {
+	log := logger.GetLogger(ctx)
+	resent, err := s.outboxRepo.Resend(emailID, time.Now())
+	if err != nil {
+		log.Errorf("Failed to resend email: %d, err: %v", emailID, err)
+		return nil, err
+	}
+	email, err := s.GetEmail(ctx, emailID)
+	if err != nil {
+		return nil, err
+	}
+	if !resent {
+		return nil, ErrEmailNotDead
+	}
+	log.Infof("Admin: %d resent email: %d", adminID, emailID)
+	return email, nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+)
+
+var (
+	ErrInvalidAlias  = errors.New("alias may only contain letters, digits, '-' and '_'")
+	ErrReservedAlias = errors.New("alias is reserved")
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// AliasPolicy decides which custom aliases users may claim
+type AliasPolicy struct {
+	reserved map[string]struct{}
+}
+
+// NewAliasPolicy builds a policy from the built-in reserved words plus the configured ones
+func NewAliasPolicy(extraReservedAliases []string) *AliasPolicy {
+	reserved := make(map[string]struct{})
+	for _, lists := range [][]string{
+		common_constants.ReservedAliases,
+		common_constants.ProfaneAliases,
+		extraReservedAliases,
+	} {
+		for _, alias := range lists {
+			if alias = normalizeAlias(alias); alias != "" {
+				reserved[alias] = struct{}{}
+			}
+		}
+	}
+	return &AliasPolicy{reserved: reserved}
+}
+
+// Validate checks the alias charset and rejects reserved words
+func (p *AliasPolicy) Validate(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return ErrInvalidAlias
+	}
+	if _, ok := p.reserved[normalizeAlias(alias)]; ok {
+		return ErrReservedAlias
+	}
+	return nil
+}
+
+// normalizeAlias makes "Log-In" and "login" compare equal
+func normalizeAlias(alias string) string {
+	alias = strings.ToLower(strings.TrimSpace(alias))
+	return strings.NewReplacer("-", "", "_", "").Replace(alias)
+}
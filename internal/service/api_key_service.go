@@ -0,0 +1,137 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/dto"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/repository"
+	"github.com/nikhil/url-shortner-backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAPIKeyNotFound     = errors.New("api key not found")
+	ErrInvalidAPIKey      = errors.New("invalid api key")
+	ErrTooManyAPIKeys     = errors.New("api key limit reached, revoke an unused key first")
+	ErrInvalidAPIKeyScope = errors.New("invalid api key scope")
+)
+
+type APIKeyService struct {
+	apiKeyRepo *repository.APIKeyRepository
+}
+
+func NewAPIKeyService(apiKeyRepo *repository.APIKeyRepository) *APIKeyService {
+	return &APIKeyService{
+		apiKeyRepo: apiKeyRepo,
+	}
+}
+
+// hashAPIKey hashes a key for storage. Keys are 32 random bytes, a fast hash is enough.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey generates a new key for the user. The returned key is never retrievable again.
+func (s *APIKeyService) CreateAPIKey(ctx *gin.Context, userID uint, req *dto.CreateAPIKeyRequest) (*dto.CreateAPIKeyResponse, error) {
+	log := logger.GetLogger(ctx)
+	scope := common_constants.APIKeyScope(req.Scope)
+	if !scope.Includes(common_constants.APIKeyScopeRead) {
+		return nil, ErrInvalidAPIKeyScope
+	}
+	count, err := s.apiKeyRepo.CountByUserID(userID)
+	if err != nil {
+		log.Errorf("CreateAPIKey count err: %v", err)
+		return nil, err
+	}
+	if count >= common_constants.MaxAPIKeysPerUser {
+		return nil, ErrTooManyAPIKeys
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		log.Errorf("Failed to generate api key: %v", err)
+		return nil, err
+	}
+	key := common_constants.APIKeyPrefix + secret
+	apiKey := &model.APIKey{
+		UserID:  userID,
+		Name:    strings.TrimSpace(req.Name),
+		Prefix:  key[:common_constants.APIKeyDisplayLength],
+		KeyHash: hashAPIKey(key),
+		Scope:   scope,
+	}
+	if err = s.apiKeyRepo.Create(apiKey); err != nil {
+		log.Errorf("CreateAPIKey err: %v", err)
+		return nil, err
+	}
+	log.Infof("Created api key: %d (%s) of user: %d", apiKey.ID, apiKey.Scope, userID)
+	return &dto.CreateAPIKeyResponse{APIKey: apiKey, Key: key}, nil
+}
+
+func (s *APIKeyService) ListAPIKeys(ctx *gin.Context, userID uint) ([]model.APIKey, error) {
+	log := logger.GetLogger(ctx)
+	apiKeys, err := s.apiKeyRepo.FindByUserID(userID)
+	if err != nil {
+		log.Errorf("ListAPIKeys err: %v", err)
+		return nil, err
+	}
+	return apiKeys, nil
+}
+
+// RevokeAPIKey deletes a key of the user, requests made with it are refused right away
+func (s *APIKeyService) RevokeAPIKey(ctx *gin.Context, userID uint, id uint) error {
+	log := logger.GetLogger(ctx)
+	apiKey, err := s.apiKeyRepo.FindByUserIDAndID(userID, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		log.Errorf("RevokeAPIKey find err: %v", err)
+		return err
+	}
+	if err = s.apiKeyRepo.Delete(apiKey); err != nil {
+		log.Errorf("RevokeAPIKey err: %v", err)
+		return err
+	}
+	log.Infof("Revoked api key: %d of user: %d", apiKey.ID, userID)
+	return nil
+}
+
+// Authenticate returns the key matching a raw API key and records its use
+func (s *APIKeyService) Authenticate(ctx *gin.Context, key string) (*model.APIKey, error) {
+	log := logger.GetLogger(ctx)
+	if !strings.HasPrefix(key, common_constants.APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	apiKey, err := s.apiKeyRepo.FindByHash(hashAPIKey(key))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		log.Errorf("Failed to look up api key: %v", err)
+		return nil, err
+	}
+	// Keys of disabled accounts stay around so they work again once the account is enabled
+	if apiKey.User.DisabledAt != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Last use is only written once in a while so that busy scripts don't write on every request
+	if apiKey.LastUsedAt == nil || time.Since(*apiKey.LastUsedAt) > common_constants.APIKeyLastUsedInterval {
+		now := time.Now()
+		if err = s.apiKeyRepo.UpdateLastUsed(apiKey.ID, now, ctx.ClientIP()); err != nil {
+			log.Errorf("Failed to update last use of api key: %d, err: %v", apiKey.ID, err)
+		}
+		apiKey.LastUsedAt, apiKey.LastUsedIP = &now, ctx.ClientIP()
+	}
+	return apiKey, nil
+}
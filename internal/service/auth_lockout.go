@@ -0,0 +1,182 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/service/email_service"
+	"github.com/nikhil/url-shortner-backend/internal/service/otp_service"
+)
+
+var (
+	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrAccountLocked        = errors.New("account is temporarily locked")
+	ErrTooManyLoginAttempts = errors.New("too many failed login attempts")
+)
+
+// LoginThrottledError is returned while an account is locked or an IP is throttled.
+// It unwraps to ErrAccountLocked or ErrTooManyLoginAttempts.
+type LoginThrottledError struct {
+	Err   error
+	Until time.Time
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("%v until %s", e.Err, e.Until.Format(time.RFC3339))
+}
+
+func (e *LoginThrottledError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter returns how long the caller has to wait before trying again
+func (e *LoginThrottledError) RetryAfter() time.Duration {
+	if retryAfter := time.Until(e.Until); retryAfter > 0 {
+		return retryAfter
+	}
+	return 0
+}
+
+func getLoginFailuresByUserKey(userID uint) string {
+	return fmt.Sprintf("login_failures:user:%d", userID)
+}
+
+func getLoginFailuresByIPKey(ip string) string {
+	return "login_failures:ip:" + ip
+}
+
+func getAccountLockKey(userID uint) string {
+	return fmt.Sprintf("account_lock:%d", userID)
+}
+
+// checkLoginThrottle rejects logins from IPs with too many recent failures and logins to locked accounts.
+// Throttling fails open when redis is unavailable.
+func (s *AuthService) checkLoginThrottle(ctx *gin.Context, user *model.User) error {
+	log := logger.GetLogger(ctx)
+	ipFailures, err := s.rateLimitRepo.GetCount(ctx, getLoginFailuresByIPKey(ctx.ClientIP()))
+	if err != nil {
+		log.Errorf("Failed to get login failures of ip: %s, err: %v", ctx.ClientIP(), err)
+	}
+	if ipFailures >= common_constants.MaxFailedLoginAttemptsPerIP {
+		return &LoginThrottledError{Err: ErrTooManyLoginAttempts, Until: time.Now().Add(common_constants.LoginFailureWindow)}
+	}
+	if user == nil {
+		return nil
+	}
+
+	lockedUntil, err := s.rateLimitRepo.LockedUntil(ctx, getAccountLockKey(user.ID))
+	if err != nil {
+		log.Errorf("Failed to get lock of user: %d, err: %v", user.ID, err)
+	}
+	if lockedUntil.After(time.Now()) {
+		return &LoginThrottledError{Err: ErrAccountLocked, Until: lockedUntil}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed login against the IP and, for known emails, the account.
+// Reaching maxFailedAttempts locks the account and emails its owner.
+func (s *AuthService) recordLoginFailure(ctx *gin.Context, user *model.User) error {
+	log := logger.GetLogger(ctx)
+	if _, err := s.rateLimitRepo.Increment(ctx, getLoginFailuresByIPKey(ctx.ClientIP()), common_constants.LoginFailureWindow); err != nil {
+		log.Errorf("Failed to count login failure of ip: %s, err: %v", ctx.ClientIP(), err)
+	}
+	if user == nil {
+		return ErrInvalidCredentials
+	}
+
+	failures, err := s.rateLimitRepo.Increment(ctx, getLoginFailuresByUserKey(user.ID), common_constants.LoginFailureWindow)
+	if err != nil {
+		log.Errorf("Failed to count login failure of user: %d, err: %v", user.ID, err)
+		return ErrInvalidCredentials
+	}
+	if failures < int64(s.maxFailedAttempts) {
+		return ErrInvalidCredentials
+	}
+
+	until := time.Now().Add(s.lockoutDuration)
+	if err = s.rateLimitRepo.Lock(ctx, getAccountLockKey(user.ID), until); err != nil {
+		log.Errorf("Failed to lock user: %d, err: %v", user.ID, err)
+		return ErrInvalidCredentials
+	}
+	if err = s.rateLimitRepo.Reset(ctx, getLoginFailuresByUserKey(user.ID)); err != nil {
+		log.Errorf("Failed to reset login failures of user: %d, err: %v", user.ID, err)
+	}
+	log.Warnf("Locked user: %d after %d failed logins", user.ID, failures)
+
+	// Sending mail can be slow, don't hold the response (nor reveal the lockout by timing)
+	go func() {
+		if err := s.sendLockoutNotice(user, until); err != nil {
+			log.Errorf("Failed to send lockout notice to user: %d, err: %v", user.ID, err)
+		}
+	}()
+	return &LoginThrottledError{Err: ErrAccountLocked, Until: until}
+}
+
+// clearLoginFailures forgets the failures and lock of an account after a successful login or unlock
+func (s *AuthService) clearLoginFailures(ctx *gin.Context, userID uint) {
+	log := logger.GetLogger(ctx)
+	if err := s.rateLimitRepo.Reset(ctx, getLoginFailuresByUserKey(userID)); err != nil {
+		log.Errorf("Failed to reset login failures of user: %d, err: %v", userID, err)
+	}
+	if err := s.rateLimitRepo.Reset(ctx, getAccountLockKey(userID)); err != nil {
+		log.Errorf("Failed to unlock user: %d, err: %v", userID, err)
+	}
+}
+
+func (s *AuthService) sendLockoutNotice(user *model.User, until time.Time) error {
+	m, err := s.emailTemplates.Message(common_constants.EmailTemplateLockoutNotice, user.Locale, user.Email, email_service.TemplateData{
+		"Name":           user.Name,
+		"FailedAttempts": s.maxFailedAttempts,
+		"Until":          until,
+	})
+	if err != nil {
+		return err
+	}
+	return s.emailService.SendEmail(m)
+}
+
+// RequestAccountUnlock emails an OTP that unlocks a locked account. Nothing is sent for accounts
+// that aren't locked, without telling the caller.
+func (s *AuthService) RequestAccountUnlock(ctx *gin.Context, email string) error {
+	log := logger.GetLogger(ctx)
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return nil
+	}
+	lockedUntil, err := s.rateLimitRepo.LockedUntil(ctx, getAccountLockKey(user.ID))
+	if err != nil {
+		log.Errorf("Failed to get lock of user: %d, err: %v", user.ID, err)
+		return err
+	}
+	if !lockedUntil.After(time.Now()) {
+		return nil
+	}
+
+	// Like reset codes, unlock codes always go to the verified email
+	if err = s.otpService.SendOTP(ctx, common_constants.OTPPurposeUnlockAccount, otp_service.EmailRecipient(user.Email, user.Locale)); err != nil {
+		log.Errorf("failed to send OTP: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UnlockAccount lifts the lock of an account with the OTP sent by RequestAccountUnlock
+func (s *AuthService) UnlockAccount(ctx *gin.Context, email string, otp string) error {
+	log := logger.GetLogger(ctx)
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return ErrInvalidCredentials
+	}
+	if err = s.otpService.VerifyOTP(ctx, common_constants.OTPPurposeUnlockAccount, email, otp); err != nil {
+		log.Errorf("failed to verify OTP: %v", err)
+		return err
+	}
+	s.clearLoginFailures(ctx, user.ID)
+	return nil
+}
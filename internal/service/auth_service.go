@@ -3,30 +3,43 @@ package service
 import (
 	"errors"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"github.com/nikhil/url-shortner-backend/constants"
 	"github.com/nikhil/url-shortner-backend/internal/dto"
 	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
 	"github.com/nikhil/url-shortner-backend/internal/model"
 	"github.com/nikhil/url-shortner-backend/internal/repository"
+	"github.com/nikhil/url-shortner-backend/internal/service/email_service"
 	"github.com/nikhil/url-shortner-backend/internal/service/otp_service"
+	"github.com/nikhil/url-shortner-backend/internal/utils"
+	"github.com/nikhil/url-shortner-backend/pkg/token"
 	"golang.org/x/crypto/bcrypt"
-	"strconv"
+	"strings"
 	"time"
 )
 
 var (
-	ErrInvalidToken = errors.New("invalid token format")
-	ErrNoUserID     = errors.New("user ID not found in token claims")
+	ErrInvalidToken       = errors.New("invalid token format")
+	ErrNoUserID           = errors.New("user ID not found in token claims")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+	ErrRefreshConflict    = errors.New("session was refreshed by a concurrent request")
+	ErrAccountDisabled    = errors.New("account has been disabled")
 )
 
 type AuthService struct {
 	userRepo          *repository.UserRepository
 	tokenRepo         *repository.SessionRepository
+	rateLimitRepo     *repository.RateLimitRepository
 	otpService        otp_service.IOTPService
-	accessSecret      string
-	refreshSecret     string
+	emailService      email_service.IEmailService
+	emailTemplates    *email_service.TemplateRegistry
+	tokenIssuer       token.Issuer
+	recoveryCodeRepo  *repository.RecoveryCodeRepository
+	rolePolicyRepo    *repository.RolePolicyRepository
+	encryptionKey     []byte
+	totpIssuer        string // name authenticator apps show next to codes
+	magicLinkURL      string // page magic links open, with the token in the query
 	maxFailedAttempts int
 	lockoutDuration   time.Duration
 }
@@ -34,57 +47,87 @@ type AuthService struct {
 func NewAuthService(
 	userRepo *repository.UserRepository,
 	sessionRepo *repository.SessionRepository,
+	rateLimitRepo *repository.RateLimitRepository,
 	otpService otp_service.IOTPService,
-	accessSecret string,
-	refreshSecret string,
+	emailService email_service.IEmailService,
+	emailTemplates *email_service.TemplateRegistry,
+	tokenIssuer token.Issuer,
+	recoveryCodeRepo *repository.RecoveryCodeRepository,
+	rolePolicyRepo *repository.RolePolicyRepository,
+	encryptionKey []byte,
+	totpIssuer string,
+	magicLinkURL string,
 ) *AuthService {
 	return &AuthService{
 		userRepo:          userRepo,
 		tokenRepo:         sessionRepo,
+		rateLimitRepo:     rateLimitRepo,
 		otpService:        otpService,
-		accessSecret:      accessSecret,
-		refreshSecret:     refreshSecret,
+		emailService:      emailService,
+		emailTemplates:    emailTemplates,
+		tokenIssuer:       tokenIssuer,
+		recoveryCodeRepo:  recoveryCodeRepo,
+		rolePolicyRepo:    rolePolicyRepo,
+		encryptionKey:     encryptionKey,
+		totpIssuer:        totpIssuer,
+		magicLinkURL:      magicLinkURL,
 		maxFailedAttempts: 5,
 		lockoutDuration:   15 * time.Minute,
 	}
 }
 
-func (s *AuthService) createAccessToken(userId uint) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userId,
-		"exp":     time.Now().Add(15 * time.Minute).Unix(),
-		"iat":     time.Now().Unix(),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.accessSecret))
+// tokenPair is a freshly signed access and refresh token along with their jti claims
+type tokenPair struct {
+	AccessToken    string
+	AccessTokenID  string
+	RefreshToken   string
+	RefreshTokenID string
 }
 
-func (s *AuthService) createRefreshToken(userId uint) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userId,
-		"exp":     time.Now().Add(7 * 24 * time.Hour).Unix(),
-		"iat":     time.Now().Unix(),
+// createToken signs a token of a session. Every token carries a unique jti so that sessions can
+// tell the current token apart from older ones.
+func (s *AuthService) createToken(userId uint, sessionID string, tokenUse string, ttl time.Duration) (string, string, error) {
+	tokenID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return "", "", err
 	}
+	now := time.Now()
+	signedToken, err := s.tokenIssuer.Issue(&token.Claims{
+		ID:        tokenID,
+		UserID:    userId,
+		SessionID: sessionID,
+		TokenUse:  tokenUse,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+	return signedToken, tokenID, err
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.refreshSecret))
+func (s *AuthService) createAccessToken(userId uint, sessionID string) (string, string, error) {
+	return s.createToken(userId, sessionID, token.TokenUseAccess, common_constants.AccessTokenTTL)
 }
 
-func (s *AuthService) generateTokenPair(userID uint) (string, string, error) {
+func (s *AuthService) createRefreshToken(userId uint, sessionID string) (string, string, error) {
+	return s.createToken(userId, sessionID, token.TokenUseRefresh, common_constants.RefreshTokenTTL)
+}
+
+func (s *AuthService) generateTokenPair(userID uint, sessionID string) (*tokenPair, error) {
+	var pair tokenPair
+	var err error
+
 	// Generate access token
-	accessToken, err := s.createAccessToken(userID)
+	pair.AccessToken, pair.AccessTokenID, err = s.createAccessToken(userID, sessionID)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
 	// Generate refresh token
-	refreshToken, err := s.createRefreshToken(userID)
+	pair.RefreshToken, pair.RefreshTokenID, err = s.createRefreshToken(userID, sessionID)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	return accessToken, refreshToken, nil
+	return &pair, nil
 }
 
 func (s *AuthService) SignUp(ctx *gin.Context, req *dto.SignupRequest) (*model.User, error) {
@@ -104,21 +147,16 @@ func (s *AuthService) SignUp(ctx *gin.Context, req *dto.SignupRequest) (*model.U
 		Password: string(hashedPassword),
 		Name:     req.Name,
 		UserRole: common_constants.UserRoleUser,
+		Locale:   requestLocale(ctx, req.Locale),
 	}
 
-	otp := s.otpService.GenerateOTP(req.Email)
-	err = s.otpService.SaveOTP(ctx, user.Email, otp)
-	if err != nil {
-		log.Errorf("Failed to save OTP: %v", err)
-		return nil, err
-	}
 	err = s.userRepo.SaveUserToCache(ctx, user, common_constants.UserSignupCacheTimeout)
 	if err != nil {
 		log.Errorf("Failed to save user to cache: %v", err)
 		return nil, err
 
 	}
-	err = s.otpService.SendOTP(user.Email, otp)
+	err = s.otpService.SendOTP(ctx, common_constants.OTPPurposeSignup, otp_service.EmailRecipient(user.Email, user.Locale))
 	if err != nil {
 		log.Errorf("Failed to create user: %v", err)
 		return nil, fmt.Errorf("failed to create user: %w", err)
@@ -127,6 +165,26 @@ func (s *AuthService) SignUp(ctx *gin.Context, req *dto.SignupRequest) (*model.U
 	return user, nil
 }
 
+// requestLocale returns the given locale, or the first language of the Accept-Language header
+func requestLocale(ctx *gin.Context, locale string) string {
+	if locale == "" {
+		locale, _, _ = strings.Cut(ctx.GetHeader("Accept-Language"), ",")
+		locale, _, _ = strings.Cut(locale, ";")
+	}
+	return email_service.NormalizeLocale(locale)
+}
+
+// UpdateLocale changes the language of emails to the user
+func (s *AuthService) UpdateLocale(ctx *gin.Context, userID uint, locale string) (*dto.LocaleResponse, error) {
+	log := logger.GetLogger(ctx)
+	locale = email_service.NormalizeLocale(locale)
+	if err := s.userRepo.UpdateLocale(userID, locale); err != nil {
+		log.Errorf("Failed to update locale of user: %d, err: %v", userID, err)
+		return nil, err
+	}
+	return &dto.LocaleResponse{Locale: locale}, nil
+}
+
 func (s *AuthService) RegisterUser(ctx *gin.Context, email string, otp string) error {
 	log := logger.GetLogger(ctx)
 	if _, err := s.userRepo.FindByEmail(email); err == nil {
@@ -142,10 +200,10 @@ func (s *AuthService) RegisterUser(ctx *gin.Context, email string, otp string) e
 		log.Errorf("Failed to get user from cache: %v", err)
 		return err
 	}
-	err = s.otpService.VerifyOTP(ctx, email, otp)
+	err = s.otpService.VerifyOTP(ctx, common_constants.OTPPurposeSignup, email, otp)
 	if err != nil {
 		log.Errorf("Failed to verify OTP: %v", err)
-		return errors.New("failed to verify OTP")
+		return fmt.Errorf("failed to verify OTP: %w", err)
 	}
 	err = s.userRepo.Create(user)
 	if err != nil {
@@ -156,158 +214,266 @@ func (s *AuthService) RegisterUser(ctx *gin.Context, email string, otp string) e
 	if err != nil {
 		log.Errorf("Failed to delete user from cache: %v", err)
 	}
-
-	err = s.otpService.DeleteOTP(ctx, email)
-	if err != nil {
-		log.Errorf("Failed to delete OTP: %v", err)
-	}
 	return nil
 }
 
-func (s *AuthService) Login(ctx *gin.Context, email, password string) (*dto.LoginResponse, error) {
+func (s *AuthService) Login(ctx *gin.Context, email, password, deviceName string) (*dto.LoginResponse, error) {
 	// Find user
 	user, err := s.userRepo.FindByEmail(email)
 	if err != nil {
-		return nil, errors.New("invalid credentials")
+		user = nil
+	}
+
+	// Locked accounts are rejected before the password is checked so guesses learn nothing
+	if err = s.checkLoginThrottle(ctx, user); err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, s.recordLoginFailure(ctx, nil)
 	}
 
 	// Verify password
 	if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, s.recordLoginFailure(ctx, user)
+	}
+	s.clearLoginFailures(ctx, user.ID)
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+	return s.completeLogin(ctx, user, deviceName)
+}
+
+// completeLogin starts a session of a user who proved who they are, unless a second factor is needed
+func (s *AuthService) completeLogin(ctx *gin.Context, user *model.User, deviceName string) (*dto.LoginResponse, error) {
+	// Users with two-factor authentication, or whose role requires it, get a challenge instead of a session
+	required, err := s.twoFactorRequired(user.UserRole)
+	if err != nil {
+		logger.GetLogger(ctx).Errorf("Failed to get policy of role: %s, err: %v", user.UserRole, err)
+		return nil, err
+	}
+	if user.TwoFactorEnabled() || required {
+		return s.newTwoFactorChallenge(user)
+	}
+	return s.startSession(ctx, user, deviceName)
+}
+
+// startSession creates a new session of the user and signs its first tokens
+func (s *AuthService) startSession(ctx *gin.Context, user *model.User, deviceName string) (*dto.LoginResponse, error) {
+	// Every login gets its own session, so logging in on one device doesn't log out the others
+	sessionID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
 	}
 
 	// Generate tokens
-	accessToken, refreshToken, err := s.generateTokenPair(user.ID)
+	tokens, err := s.generateTokenPair(user.ID, sessionID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Create new session
+	now := time.Now()
 	session := &model.Session{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-	}
-
-	if err = s.tokenRepo.UpdateUserSession(ctx, user.ID, session); err != nil {
+		ID:             sessionID,
+		UserID:         user.ID,
+		AccessTokenID:  tokens.AccessTokenID,
+		RefreshTokenID: tokens.RefreshTokenID,
+		DeviceName:     deviceName,
+		UserAgent:      ctx.Request.UserAgent(),
+		IPAddress:      ctx.ClientIP(),
+		CreatedAt:      now,
+		LastSeenAt:     now,
+		RotatedAt:      now,
+	}
+
+	if err = s.tokenRepo.SaveSession(ctx, session); err != nil {
 		return nil, err
 	}
 
 	return &dto.LoginResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
 	}, nil
 }
 
-// GetUserIDFromRefreshToken extracts the user ID from a JWT refresh token
-// Returns the user ID as uint and error if any occurs
-func (s *AuthService) GetUserIDFromRefreshToken(refreshToken string, secretKey []byte) (uint, error) {
-	// Parse the token
-	token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return secretKey, nil
-	})
+// refreshTokenClaims identifies a refresh token: its user, its session (the token family) and itself
+type refreshTokenClaims struct {
+	UserID    uint
+	SessionID string
+	TokenID   string
+}
 
+// parseRefreshToken extracts the user ID, session ID and token ID from a JWT refresh token
+func (s *AuthService) parseRefreshToken(refreshToken string) (*refreshTokenClaims, error) {
+	claims, err := s.tokenIssuer.Verify(refreshToken)
 	if err != nil {
-		return 0, err
-	}
-
-	// Validate token and extract claims
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		// Extract user ID from claims
-		if userID, exists := claims["user_id"]; exists {
-			// Handle different numeric types that could come from JSON
-			switch v := userID.(type) {
-			case float64:
-				return uint(v), nil
-			case float32:
-				return uint(v), nil
-			case int:
-				return uint(v), nil
-			case int64:
-				return uint(v), nil
-			case uint:
-				return v, nil
-			case string:
-				// If stored as string, try to convert to uint
-				parsed, err := strconv.ParseUint(v, 10, 32)
-				if err != nil {
-					return 0, ErrInvalidToken
-				}
-				return uint(parsed), nil
-			default:
-				return 0, ErrInvalidToken
-			}
-		}
-		return 0, ErrNoUserID
+		return nil, err
 	}
-
-	return 0, ErrInvalidToken
+	// Access tokens are signed with the same keys, they must not be usable as refresh tokens
+	if claims.TokenUse != token.TokenUseRefresh {
+		return nil, ErrInvalidToken
+	}
+	if claims.UserID == 0 {
+		return nil, ErrNoUserID
+	}
+	if claims.SessionID == "" || claims.ID == "" {
+		return nil, ErrInvalidToken
+	}
+	return &refreshTokenClaims{UserID: claims.UserID, SessionID: claims.SessionID, TokenID: claims.ID}, nil
 }
 
+// RefreshToken rotates the refresh token of a session: every refresh token can be used once.
+// Presenting a refresh token that has already been rotated means it leaked, so the whole
+// session (the token family) is revoked.
 func (s *AuthService) RefreshToken(ctx *gin.Context, refreshToken string) (*dto.RefreshTokenResponse, error) {
 	log := logger.GetLogger(ctx)
-	userID, err := s.GetUserIDFromRefreshToken(refreshToken, []byte(s.refreshSecret))
+	claims, err := s.parseRefreshToken(refreshToken)
 	if err != nil {
-		log.Errorf("Failed to get user ID: %v", err)
-		return nil, err
+		log.Errorf("Failed to parse refresh token: %v", err)
+		return nil, ErrInvalidToken
 	}
-	session, err := s.tokenRepo.GetUserSession(ctx, userID)
+	session, err := s.tokenRepo.GetSession(ctx, claims.UserID, claims.SessionID)
 	if err != nil {
-		log.Errorf("Failed to get user session: %v", err)
-		return nil, err
+		log.Warnf("Refresh token jti: %s of revoked session: %s, user: %d", claims.TokenID, claims.SessionID, claims.UserID)
+		return nil, ErrInvalidToken
+	}
+	if session.RefreshTokenID != claims.TokenID {
+		log.Warnf("Refresh token reuse detected, revoking session: %s of user: %d, jti: %s, ip: %s",
+			claims.SessionID, claims.UserID, claims.TokenID, ctx.ClientIP())
+		if err = s.tokenRepo.DeleteSession(ctx, claims.UserID, claims.SessionID); err != nil {
+			log.Errorf("Failed to revoke session: %s, err: %v", claims.SessionID, err)
+		}
+		return nil, ErrRefreshTokenReused
 	}
-	accessToken, err := s.createAccessToken(userID)
+
+	tokens, err := s.generateTokenPair(claims.UserID, claims.SessionID)
 	if err != nil {
 		return nil, err
 	}
-	session.AccessToken = accessToken
-	session.RefreshToken = refreshToken
-	err = s.tokenRepo.UpdateUserSession(ctx, userID, session)
+	session.AccessTokenID = tokens.AccessTokenID
+	session.RefreshTokenID = tokens.RefreshTokenID
+	session.IPAddress = ctx.ClientIP()
+	session.LastSeenAt = time.Now()
+	session.RotatedAt = session.LastSeenAt
+	// The rotation only goes through while the session still expects the presented token, so that
+	// of two concurrent refreshes with it exactly one wins
+	rotated, err := s.tokenRepo.ReplaceSession(ctx, session, claims.TokenID)
 	if err != nil {
 		log.Errorf("Failed to update user session: %v", err)
 		return nil, err
 	}
-	return &dto.RefreshTokenResponse{AccessToken: accessToken}, nil
+	if !rotated {
+		log.Warnf("Concurrent refresh of session: %s, user: %d, jti: %s", claims.SessionID, claims.UserID, claims.TokenID)
+		return nil, ErrRefreshConflict
+	}
+	log.Infof("Rotated refresh token of session: %s, user: %d, jti: %s -> %s",
+		claims.SessionID, claims.UserID, claims.TokenID, tokens.RefreshTokenID)
+	return &dto.RefreshTokenResponse{AccessToken: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
 }
 
-func (s *AuthService) Logout(ctx *gin.Context, refreshToken string) error {
+// Logout ends the session the request is authenticated with
+func (s *AuthService) Logout(ctx *gin.Context, userID uint, sessionID string) error {
 	log := logger.GetLogger(ctx)
-	userID, err := s.GetUserIDFromRefreshToken(refreshToken, []byte(s.refreshSecret))
+	if err := s.tokenRepo.DeleteSession(ctx, userID, sessionID); err != nil {
+		log.Errorf("Failed to delete session: %s of user: %d, err: %v", sessionID, userID, err)
+		return err
+	}
+	return nil
+}
+
+// ListSessions returns the devices the user is logged in on, flagging the one making the request
+func (s *AuthService) ListSessions(ctx *gin.Context, userID uint, currentSessionID string) ([]*dto.SessionResponse, error) {
+	log := logger.GetLogger(ctx)
+	sessions, err := s.tokenRepo.ListSessions(ctx, userID)
 	if err != nil {
-		log.Errorf("Failed to get user ID: %v", err)
+		log.Errorf("Failed to list sessions of user: %d, err: %v", userID, err)
+		return nil, err
+	}
+	responses := make([]*dto.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		responses = append(responses, &dto.SessionResponse{
+			ID:         session.ID,
+			DeviceName: session.DeviceName,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			Current:    session.ID == currentSessionID,
+		})
+	}
+	return responses, nil
+}
+
+// RevokeSession logs one of the user's devices out
+func (s *AuthService) RevokeSession(ctx *gin.Context, userID uint, sessionID string) error {
+	log := logger.GetLogger(ctx)
+	if _, err := s.tokenRepo.GetSession(ctx, userID, sessionID); err != nil {
+		return ErrSessionNotFound
+	}
+	if err := s.tokenRepo.DeleteSession(ctx, userID, sessionID); err != nil {
+		log.Errorf("Failed to delete session: %s of user: %d, err: %v", sessionID, userID, err)
 		return err
 	}
-	return s.tokenRepo.DeleteUserSession(ctx, userID)
+	return nil
+}
+
+// RevokeAllSessions logs the user out everywhere
+func (s *AuthService) RevokeAllSessions(ctx *gin.Context, userID uint) error {
+	log := logger.GetLogger(ctx)
+	if err := s.tokenRepo.DeleteAllSessions(ctx, userID); err != nil {
+		log.Errorf("Failed to delete sessions of user: %d, err: %v", userID, err)
+		return err
+	}
+	return nil
 }
 
 func (s *AuthService) ForgotPassword(ctx *gin.Context, email string) error {
 	log := logger.GetLogger(ctx)
-	_, err := s.userRepo.FindByEmail(email)
+	user, err := s.userRepo.FindByEmail(email)
 	if err != nil {
 		log.Errorf("failed to get email id %s, err:  %v", email, err)
 		return fmt.Errorf("invalid email")
 	}
-	otp := s.otpService.GenerateOTP(email)
-	err = s.otpService.SaveOTP(ctx, email, otp)
-	if err != nil {
-		log.Errorf("failed to save OTP: %v", err)
-		return err
-	}
-	err = s.otpService.SendOTP(email, otp)
+	// Reset codes always go to the verified email, a session can't redirect them by changing the OTP channel
+	err = s.otpService.SendOTP(ctx, common_constants.OTPPurposeResetPassword, otp_service.EmailRecipient(user.Email, user.Locale))
 	if err != nil {
 		log.Errorf("failed to send OTP: %v", err)
-		deleteOTPErr := s.otpService.DeleteOTP(ctx, email)
-		if deleteOTPErr != nil {
-			log.Errorf("failed to delete OTP: %v", deleteOTPErr)
-		}
 		return err
 	}
 	return nil
 }
 
+// ResendOTP sends a new code for a pending signup, password reset, account unlock or sign in. Nothing
+// is sent, without telling the caller, when nothing is pending for the email.
+func (s *AuthService) ResendOTP(ctx *gin.Context, purpose common_constants.OTPPurpose, email string) error {
+	log := logger.GetLogger(ctx)
+	switch purpose {
+	case common_constants.OTPPurposeSignup:
+		user, err := s.userRepo.GetUserFromCache(ctx, email)
+		if err != nil {
+			return nil
+		}
+		// The pending signup has to outlive the new code
+		if err = s.userRepo.SaveUserToCache(ctx, user, common_constants.UserSignupCacheTimeout); err != nil {
+			log.Errorf("Failed to save user to cache: %v", err)
+			return err
+		}
+		return s.otpService.SendOTP(ctx, purpose, otp_service.EmailRecipient(email, user.Locale))
+	case common_constants.OTPPurposeResetPassword:
+		user, err := s.userRepo.FindByEmail(email)
+		if err != nil {
+			return nil
+		}
+		return s.otpService.SendOTP(ctx, purpose, otp_service.EmailRecipient(user.Email, user.Locale))
+	case common_constants.OTPPurposeUnlockAccount:
+		return s.RequestAccountUnlock(ctx, email)
+	case common_constants.OTPPurposeLogin:
+		return s.RequestLoginCode(ctx, email)
+	default:
+		return fmt.Errorf("unknown otp purpose: %s", purpose)
+	}
+}
+
 func (s *AuthService) ResetPassword(ctx *gin.Context, email, otp, newPassword string) error {
 	log := logger.GetLogger(ctx)
 	user, err := s.userRepo.FindByEmail(email)
@@ -315,27 +481,22 @@ func (s *AuthService) ResetPassword(ctx *gin.Context, email, otp, newPassword st
 		log.Errorf("failed to get user id %s, err: %v", email, err)
 		return fmt.Errorf("invalid email")
 	}
-	err = s.otpService.VerifyOTP(ctx, email, otp)
+	err = s.otpService.VerifyOTP(ctx, common_constants.OTPPurposeResetPassword, email, otp)
 	if err != nil {
 		log.Errorf("failed to verify OTP: %v", err)
-		return fmt.Errorf("invalid validation failed")
-	}
-	err = s.otpService.DeleteOTP(ctx, email)
-	if err != nil {
-		log.Errorf("failed to delete OTP: %v", err)
+		return fmt.Errorf("invalid validation failed: %w", err)
 	}
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
 		log.Errorf("failed to hash password: %v", err)
 		return fmt.Errorf("invalid password")
 	}
-	user.Password = string(hashedPassword)
-	err = s.tokenRepo.DeleteUserSession(ctx, user.ID)
+	err = s.tokenRepo.DeleteAllSessions(ctx, user.ID)
 	if err != nil {
 		log.Errorf("failed to delete user session: %v", err)
 		return err
 	}
-	err = s.userRepo.Update(user)
+	err = s.userRepo.UpdatePassword(user.ID, string(hashedPassword))
 	if err != nil {
 		log.Errorf("failed to update user: %v", err)
 		return err
@@ -343,19 +504,11 @@ func (s *AuthService) ResetPassword(ctx *gin.Context, email, otp, newPassword st
 	return nil
 }
 
-func (s *AuthService) ValidateAccessToken(accessToken string) (*jwt.MapClaims, error) {
-	token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
-		return []byte(s.accessSecret), nil
-	})
-
-	if err != nil || !token.Valid {
+// ValidateAccessToken verifies an access token and returns its claims
+func (s *AuthService) ValidateAccessToken(accessToken string) (*token.Claims, error) {
+	claims, err := s.tokenIssuer.Verify(accessToken)
+	if err != nil || claims.TokenUse != token.TokenUseAccess {
 		return nil, errors.New("invalid access token")
 	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, errors.New("invalid token claims")
-	}
-
-	return &claims, nil
+	return claims, nil
 }
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/repository"
+)
+
+// ClickTracker buffers clicks in memory and flushes them to postgres in batches from a
+// background goroutine, so redirects never wait on (or fail because of) click counting.
+type ClickTracker struct {
+	urlRepo        *repository.URLRepository
+	clickEventRepo *repository.ClickEventRepository
+	log            *logger.Logger
+	flushInterval  time.Duration
+
+	mu     sync.Mutex
+	deltas map[uint]int64
+	events []*model.ClickEvent
+
+	flushCh  chan struct{}
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func NewClickTracker(
+	urlRepo *repository.URLRepository,
+	clickEventRepo *repository.ClickEventRepository,
+	log *logger.Logger,
+) *ClickTracker {
+	return &ClickTracker{
+		urlRepo:        urlRepo,
+		clickEventRepo: clickEventRepo,
+		log:            log,
+		flushInterval:  common_constants.ClickFlushInterval,
+		deltas:         make(map[uint]int64),
+		flushCh:        make(chan struct{}, 1),
+		stopCh:         make(chan struct{}),
+		doneCh:         make(chan struct{}),
+	}
+}
+
+// Start launches the background flusher
+func (t *ClickTracker) Start() {
+	go t.run()
+}
+
+// Stop stops the background flusher and drains whatever is still buffered
+func (t *ClickTracker) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stopCh)
+		<-t.doneCh
+	})
+}
+
+// Track buffers a click. It never blocks on the database.
+func (t *ClickTracker) Track(event *model.ClickEvent) {
+	t.mu.Lock()
+	t.deltas[event.URLID]++
+	if len(t.events) < common_constants.ClickBufferMaxEvents {
+		t.events = append(t.events, event)
+	} else {
+		t.log.Warnf("Click event buffer full, dropping event for url id: %d", event.URLID)
+	}
+	shouldFlush := len(t.events) >= common_constants.ClickFlushBatchSize
+	t.mu.Unlock()
+
+	if shouldFlush {
+		select {
+		case t.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Pending returns the clicks of a URL that have been tracked but not flushed yet
+func (t *ClickTracker) Pending(urlID uint) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.deltas[urlID]
+}
+
+func (t *ClickTracker) run() {
+	defer close(t.doneCh)
+	ticker := time.NewTicker(t.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.flush()
+		case <-t.flushCh:
+			t.flush()
+		case <-t.stopCh:
+			t.flush()
+			return
+		}
+	}
+}
+
+func (t *ClickTracker) flush() {
+	t.mu.Lock()
+	deltas, events := t.deltas, t.events
+	t.deltas = make(map[uint]int64)
+	t.events = nil
+	t.mu.Unlock()
+
+	if len(deltas) == 0 && len(events) == 0 {
+		return
+	}
+
+	if err := t.urlRepo.IncrementClicksBatch(deltas); err != nil {
+		t.log.Errorf("Failed to flush click counts for %d urls, err: %v", len(deltas), err)
+		t.requeue(deltas, nil)
+	}
+	if err := t.clickEventRepo.CreateBatch(events); err != nil {
+		t.log.Errorf("Failed to flush %d click events, err: %v", len(events), err)
+		t.requeue(nil, events)
+	}
+}
+
+// requeue puts back a batch that failed to flush so it is retried on the next tick
+func (t *ClickTracker) requeue(deltas map[uint]int64, events []*model.ClickEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for urlID, delta := range deltas {
+		t.deltas[urlID] += delta
+	}
+	room := common_constants.ClickBufferMaxEvents - len(t.events)
+	if room < len(events) {
+		t.log.Warnf("Click event buffer full, dropping %d events", len(events)-room)
+		events = events[:room]
+	}
+	t.events = append(events, t.events...)
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/dto"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/repository"
+	"github.com/nikhil/url-shortner-backend/pkg/dns"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidHostname          = errors.New("invalid hostname")
+	ErrDomainNotFound           = errors.New("domain not found")
+	ErrDomainAlreadyExists      = errors.New("domain already registered")
+	ErrDomainNotVerified        = errors.New("domain is not verified")
+	ErrDomainVerificationFailed = errors.New("verification TXT record not found")
+	ErrDomainInUse              = errors.New("domain still has links")
+)
+
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+type DomainService struct {
+	domainRepo   *repository.DomainRepository
+	urlRepo      *repository.URLRepository
+	resolver     dns.TXTResolver
+	mainHostname string
+}
+
+func NewDomainService(
+	domainRepo *repository.DomainRepository,
+	urlRepo *repository.URLRepository,
+	resolver dns.TXTResolver,
+	mainHostname string,
+) *DomainService {
+	return &DomainService{
+		domainRepo:   domainRepo,
+		urlRepo:      urlRepo,
+		resolver:     resolver,
+		mainHostname: normalizeHostname(mainHostname),
+	}
+}
+
+// normalizeHostname lowercases a hostname and strips the port and trailing dot
+func normalizeHostname(hostname string) string {
+	hostname = strings.ToLower(strings.TrimSpace(hostname))
+	if host, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = host
+	}
+	return strings.TrimSuffix(hostname, ".")
+}
+
+func (s *DomainService) AddDomain(ctx *gin.Context, userID uint, req *dto.AddDomainRequest) (*dto.DomainResponse, error) {
+	log := logger.GetLogger(ctx)
+	hostname := normalizeHostname(req.Hostname)
+	if !hostnamePattern.MatchString(hostname) || hostname == s.mainHostname {
+		return nil, ErrInvalidHostname
+	}
+	if _, err := s.domainRepo.FindByUserIDAndHostname(userID, hostname); err == nil {
+		return nil, ErrDomainAlreadyExists
+	}
+	if _, err := s.domainRepo.FindVerifiedByHostname(hostname); err == nil {
+		return nil, ErrDomainAlreadyExists
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		log.Errorf("Failed to generate domain verification token: %v", err)
+		return nil, err
+	}
+	domain := &model.Domain{
+		UserID:            userID,
+		Hostname:          hostname,
+		VerificationToken: hex.EncodeToString(token),
+	}
+	if err := s.domainRepo.Create(domain); err != nil {
+		log.Errorf("AddDomain err: %v", err)
+		return nil, err
+	}
+	return newDomainResponse(domain), nil
+}
+
+func (s *DomainService) ListDomains(ctx *gin.Context, userID uint) ([]*dto.DomainResponse, error) {
+	log := logger.GetLogger(ctx)
+	domains, err := s.domainRepo.FindByUserID(userID)
+	if err != nil {
+		log.Errorf("ListDomains err: %v", err)
+		return nil, err
+	}
+	responses := make([]*dto.DomainResponse, 0, len(domains))
+	for i := range domains {
+		responses = append(responses, newDomainResponse(&domains[i]))
+	}
+	return responses, nil
+}
+
+// VerifyDomain looks up the verification TXT record of a domain and marks it verified when the token matches
+func (s *DomainService) VerifyDomain(ctx *gin.Context, userID uint, domainID uint) (*dto.DomainResponse, error) {
+	log := logger.GetLogger(ctx)
+	domain, err := s.getUserDomain(userID, domainID)
+	if err != nil {
+		return nil, err
+	}
+	if domain.VerifiedAt != nil {
+		return newDomainResponse(domain), nil
+	}
+
+	if err = checkVerificationRecord(ctx, s.resolver, domain); err != nil {
+		log.Warnf("Domain verification failed for %s: %v", domain.Hostname, err)
+		return nil, ErrDomainVerificationFailed
+	}
+
+	now := time.Now()
+	domain.VerifiedAt = &now
+	err = s.domainRepo.Update(domain)
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, ErrDomainAlreadyExists
+	}
+	if err != nil {
+		log.Errorf("VerifyDomain err: %v", err)
+		return nil, err
+	}
+	if err = s.domainRepo.DeleteDomainFromCache(ctx, domain.Hostname); err != nil {
+		log.Errorf("Failed to invalidate cached domain: %s, err: %v", domain.Hostname, err)
+	}
+	return newDomainResponse(domain), nil
+}
+
+// checkVerificationRecord looks for the TXT record carrying the verification token of the domain
+func checkVerificationRecord(ctx context.Context, resolver dns.TXTResolver, domain *model.Domain) error {
+	recordName := common_constants.DomainVerificationRecord + "." + domain.Hostname
+	records, err := resolver.LookupTXT(ctx, recordName)
+	if err != nil {
+		return err
+	}
+	expected := common_constants.DomainVerificationTXTValue + domain.VerificationToken
+	for _, record := range records {
+		if strings.TrimSpace(record) == expected {
+			return nil
+		}
+	}
+	return fmt.Errorf("none of the %d TXT records of %s match", len(records), recordName)
+}
+
+// DeleteDomain removes a domain that no longer has links
+func (s *DomainService) DeleteDomain(ctx *gin.Context, userID uint, domainID uint) error {
+	log := logger.GetLogger(ctx)
+	domain, err := s.getUserDomain(userID, domainID)
+	if err != nil {
+		return err
+	}
+	count, err := s.urlRepo.CountByDomainID(domain.ID)
+	if err != nil {
+		log.Errorf("DeleteDomain count urls err: %v", err)
+		return err
+	}
+	if count > 0 {
+		return ErrDomainInUse
+	}
+	if err = s.domainRepo.Delete(domain); err != nil {
+		log.Errorf("DeleteDomain err: %v", err)
+		return err
+	}
+	if err = s.domainRepo.DeleteDomainFromCache(ctx, domain.Hostname); err != nil {
+		log.Errorf("Failed to invalidate cached domain: %s, err: %v", domain.Hostname, err)
+	}
+	return nil
+}
+
+// GetUserDomainID returns the id of one of the user's domains, DefaultDomainID for an empty hostname.
+// Links can only be created on verified domains.
+func (s *DomainService) GetUserDomainID(userID uint, hostname string, requireVerified bool) (uint, error) {
+	if hostname == "" {
+		return common_constants.DefaultDomainID, nil
+	}
+	domain, err := s.domainRepo.FindByUserIDAndHostname(userID, normalizeHostname(hostname))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrDomainNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if requireVerified && domain.VerifiedAt == nil {
+		return 0, ErrDomainNotVerified
+	}
+	return domain.ID, nil
+}
+
+// GetVerifiedDomainID returns the id of the verified domain with the given hostname, whoever
+// owns it, DefaultDomainID for an empty hostname. Links of a workspace can live on the
+// domains of any of its members.
+func (s *DomainService) GetVerifiedDomainID(hostname string) (uint, error) {
+	if hostname == "" {
+		return common_constants.DefaultDomainID, nil
+	}
+	domain, err := s.domainRepo.FindVerifiedByHostname(normalizeHostname(hostname))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrDomainNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return domain.ID, nil
+}
+
+// ResolveHostDomainID maps the Host header of a redirect to the verified custom domain serving it.
+// Any other host (the main host, an IP, an unverified domain) resolves to DefaultDomainID.
+func (s *DomainService) ResolveHostDomainID(ctx *gin.Context, host string) uint {
+	log := logger.GetLogger(ctx)
+	hostname := normalizeHostname(host)
+	if hostname == s.mainHostname {
+		return common_constants.DefaultDomainID
+	}
+	if domainID, err := s.domainRepo.GetDomainIDFromCache(ctx, hostname); err == nil {
+		return domainID
+	}
+
+	domainID := common_constants.DefaultDomainID
+	domain, err := s.domainRepo.FindVerifiedByHostname(hostname)
+	if err == nil {
+		domainID = domain.ID
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Errorf("Failed to resolve domain of host: %s, err: %v", hostname, err)
+		return domainID
+	}
+	if err = s.domainRepo.SaveDomainIDToCache(ctx, hostname, domainID); err != nil {
+		log.Errorf("Failed to cache domain of host: %s, err: %v", hostname, err)
+	}
+	return domainID
+}
+
+// GetHostnames returns the hostnames of the given domains keyed by domain id
+func (s *DomainService) GetHostnames(domainIDs []uint) (map[uint]string, error) {
+	hostnames := make(map[uint]string, len(domainIDs))
+	if len(domainIDs) == 0 {
+		return hostnames, nil
+	}
+	domains, err := s.domainRepo.FindByIDs(domainIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, domain := range domains {
+		hostnames[domain.ID] = domain.Hostname
+	}
+	return hostnames, nil
+}
+
+func (s *DomainService) getUserDomain(userID uint, domainID uint) (*model.Domain, error) {
+	domain, err := s.domainRepo.FindByID(domainID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDomainNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if domain.UserID != userID {
+		return nil, ErrDomainNotFound
+	}
+	return domain, nil
+}
+
+func newDomainResponse(domain *model.Domain) *dto.DomainResponse {
+	return &dto.DomainResponse{
+		Domain:                domain,
+		Verified:              domain.VerifiedAt != nil,
+		VerificationRecord:    common_constants.DomainVerificationRecord + "." + domain.Hostname,
+		VerificationTXTRecord: common_constants.DomainVerificationTXTValue + domain.VerificationToken,
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/pkg/dns"
+	"github.com/nikhil/url-shortner-backend/pkg/dnsstandin"
+)
+
+// startDNSStandIn serves a DNS stand-in on a random local port and returns it with a resolver querying it
+func startDNSStandIn(t *testing.T) (*dnsstandin.Server, *dns.Resolver) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := dnsstandin.NewServer()
+	go server.ServeUDP(conn)
+	t.Cleanup(func() { conn.Close() })
+	return server, dns.NewResolver(conn.LocalAddr().String())
+}
+
+func TestCheckVerificationRecord(t *testing.T) {
+	server, resolver := startDNSStandIn(t)
+	domain := &model.Domain{Hostname: "links.example.com", VerificationToken: "abc123"}
+	recordName := common_constants.DomainVerificationRecord + "." + domain.Hostname
+
+	if err := checkVerificationRecord(context.Background(), resolver, domain); err == nil {
+		t.Fatal("domain verified without a TXT record")
+	}
+
+	server.SetTXT(recordName, "v=spf1 -all")
+	if err := checkVerificationRecord(context.Background(), resolver, domain); err == nil {
+		t.Fatal("domain verified by an unrelated TXT record")
+	}
+
+	server.SetTXT(recordName, common_constants.DomainVerificationTXTValue+domain.VerificationToken)
+	if err := checkVerificationRecord(context.Background(), resolver, domain); err != nil {
+		t.Fatalf("domain not verified with its TXT record: %v", err)
+	}
+
+	other := &model.Domain{Hostname: domain.Hostname, VerificationToken: "another-token"}
+	if err := checkVerificationRecord(context.Background(), resolver, other); err == nil {
+		t.Fatal("domain verified by the token of another registration")
+	}
+
+	server.RemoveTXT(recordName)
+	if err := checkVerificationRecord(context.Background(), resolver, domain); err == nil {
+		t.Fatal("domain verified after its TXT record was removed")
+	}
+}
@@ -0,0 +1,175 @@
+package email_service
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/repository"
+	"gopkg.in/gomail.v2"
+	"gorm.io/gorm"
+)
+
+// Outbox is the IEmailService of requests: SendEmail only stores the message, so requests don't
+// wait for the SMTP server nor fail with it. The outbox also runs the background sender, which
+// delivers due emails over a pooled SMTP connection and retries failures with exponential backoff.
+// Emails that fail every attempt, or that the server rejects for good, are dead-lettered until
+// an admin resends them.
+type Outbox struct {
+	outboxRepo repository.IOutboxRepository
+	sender     *SMTPSender
+	fromEmail  string
+	log        *logger.Logger
+
+	wakeCh   chan struct{}
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func NewOutbox(outboxRepo repository.IOutboxRepository, sender *SMTPSender, fromEmail string, log *logger.Logger) *Outbox {
+	return &Outbox{
+		outboxRepo: outboxRepo,
+		sender:     sender,
+		fromEmail:  fromEmail,
+		log:        log,
+		wakeCh:     make(chan struct{}, 1),
+		stopCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+	}
+}
+
+// SendEmail enqueues a message, the background sender delivers it shortly
+func (o *Outbox) SendEmail(message *gomail.Message) error {
+	message.SetHeader("From", o.fromEmail)
+	var raw bytes.Buffer
+	if _, err := message.WriteTo(&raw); err != nil {
+		return err
+	}
+	to, subject := "", ""
+	if values := message.GetHeader("To"); len(values) > 0 {
+		to = values[0]
+	}
+	if values := message.GetHeader("Subject"); len(values) > 0 {
+		subject = values[0]
+	}
+
+	email := &model.OutboxEmail{
+		To:            to,
+		Subject:       subject,
+		Message:       raw.Bytes(),
+		Status:        common_constants.EmailStatusPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := o.outboxRepo.Create(email); err != nil {
+		return err
+	}
+	o.Wake()
+	return nil
+}
+
+// Wake makes the sender look for due emails now rather than at its next poll
+func (o *Outbox) Wake() {
+	select {
+	case o.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// Start launches the background sender
+func (o *Outbox) Start() {
+	go o.run()
+}
+
+// Stop stops the background sender once the email being sent is done
+func (o *Outbox) Stop() {
+	o.stopOnce.Do(func() {
+		close(o.stopCh)
+		<-o.doneCh
+	})
+}
+
+func (o *Outbox) run() {
+	defer close(o.doneCh)
+	defer o.sender.Close()
+	ticker := time.NewTicker(common_constants.EmailOutboxPollInterval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-o.wakeCh:
+		case <-o.stopCh:
+			return
+		}
+		o.deliverDue()
+		o.sender.CloseIdle(common_constants.SMTPIdleTimeout)
+
+		if time.Since(lastPurge) >= common_constants.EmailPurgeInterval {
+			lastPurge = time.Now()
+			if _, err := o.outboxRepo.DeleteSentBefore(time.Now().Add(-common_constants.SentEmailRetention)); err != nil {
+				o.log.Errorf("Failed to purge sent emails, err: %v", err)
+			}
+		}
+	}
+}
+
+// deliverDue sends due emails one by one until none are left. Each email is claimed right before
+// it is sent, so its lease only has to cover a single SMTP transaction.
+func (o *Outbox) deliverDue() {
+	for {
+		select {
+		case <-o.stopCh:
+			return
+		default:
+		}
+		email, err := o.outboxRepo.ClaimNext(time.Now(), common_constants.EmailSendLease)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return
+		}
+		if err != nil {
+			o.log.Errorf("Failed to claim due email, err: %v", err)
+			return
+		}
+		o.deliver(email)
+	}
+}
+
+func (o *Outbox) deliver(email *model.OutboxEmail) {
+	sendErr := o.sender.Send([]string{email.To}, email.Message)
+	now := time.Now()
+	if sendErr == nil {
+		if err := o.outboxRepo.MarkSent(email.ID, now); err != nil {
+			o.log.Errorf("Failed to mark email: %d as sent, err: %v", email.ID, err)
+		}
+		return
+	}
+
+	attempts := email.Attempts + 1
+	status, nextAttemptAt := common_constants.EmailStatusPending, now.Add(retryDelay(attempts))
+	if attempts >= common_constants.MaxEmailAttempts || IsPermanentSMTPError(sendErr) {
+		status = common_constants.EmailStatusDead
+		o.log.Errorf("Email: %d is dead after %d attempts, err: %v", email.ID, attempts, sendErr)
+	} else {
+		o.log.Warnf("Failed to send email: %d, attempt: %d, retrying at %s, err: %v", email.ID, attempts, nextAttemptAt.Format(time.RFC3339), sendErr)
+	}
+	if err := o.outboxRepo.MarkFailed(email.ID, status, nextAttemptAt, sendErr.Error()); err != nil {
+		o.log.Errorf("Failed to record failed attempt of email: %d, err: %v", email.ID, err)
+	}
+}
+
+// retryDelay doubles the delay after every failed attempt, up to the maximum. Up to 10% of jitter
+// keeps emails that failed together from being retried together.
+func retryDelay(attempts int) time.Duration {
+	delay := common_constants.EmailRetryMaxDelay
+	if shift := attempts - 1; shift < 16 {
+		delay = min(common_constants.EmailRetryBaseDelay<<shift, common_constants.EmailRetryMaxDelay)
+	}
+	return delay + rand.N(delay/10+1)
+}
@@ -0,0 +1,228 @@
+package email_service
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/config"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/pkg/smtpstandin"
+	"gopkg.in/gomail.v2"
+	"gorm.io/gorm"
+)
+
+// memoryOutboxRepository keeps the email queue in memory, in place of postgres
+type memoryOutboxRepository struct {
+	mu     sync.Mutex
+	emails []*model.OutboxEmail
+}
+
+func (r *memoryOutboxRepository) Create(email *model.OutboxEmail) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	email.ID = uint(len(r.emails) + 1)
+	r.emails = append(r.emails, email)
+	return nil
+}
+
+func (r *memoryOutboxRepository) ClaimNext(now time.Time, lease time.Duration) (*model.OutboxEmail, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var due *model.OutboxEmail
+	for _, email := range r.emails {
+		if email.Status == common_constants.EmailStatusPending && !email.NextAttemptAt.After(now) &&
+			(due == nil || email.NextAttemptAt.Before(due.NextAttemptAt)) {
+			due = email
+		}
+	}
+	if due == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	due.NextAttemptAt = now.Add(lease)
+	claimed := *due
+	return &claimed, nil
+}
+
+func (r *memoryOutboxRepository) MarkSent(id uint, sentAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	email := r.emails[id-1]
+	email.Status, email.Attempts, email.Message, email.LastError, email.SentAt = common_constants.EmailStatusSent, email.Attempts+1, nil, "", &sentAt
+	return nil
+}
+
+func (r *memoryOutboxRepository) MarkFailed(id uint, status common_constants.EmailStatus, nextAttemptAt time.Time, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	email := r.emails[id-1]
+	email.Status, email.Attempts, email.NextAttemptAt, email.LastError = status, email.Attempts+1, nextAttemptAt, lastError
+	return nil
+}
+
+func (r *memoryOutboxRepository) DeleteSentBefore(time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *memoryOutboxRepository) get(id uint) model.OutboxEmail {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.emails[id-1]
+}
+
+// makeDue brings the next attempt of an email forward, in place of waiting for its backoff
+func (r *memoryOutboxRepository) makeDue(id uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.emails[id-1].NextAttemptAt = time.Now()
+}
+
+// newTestOutbox returns an outbox sending through an SMTP stand-in on a random local port. The
+// background sender isn't started, tests run deliverDue themselves.
+func newTestOutbox(t *testing.T) (*Outbox, *memoryOutboxRepository, *smtpstandin.Server) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	standIn := smtpstandin.NewServer()
+	go standIn.Serve(listener)
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	sender := NewSMTPSender(config.EmailConfig{SMTPHost: host, SMTPPort: portNumber, FromEmail: "noreply@sho.rt"})
+	repo := &memoryOutboxRepository{}
+	outbox := NewOutbox(repo, sender, "noreply@sho.rt", logger.NewLogger("local", "test"))
+	t.Cleanup(func() {
+		sender.Close()
+		listener.Close()
+	})
+	return outbox, repo, standIn
+}
+
+func enqueue(t *testing.T, outbox *Outbox, to string, subject string) {
+	t.Helper()
+	m := gomail.NewMessage()
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/plain", "Hello")
+	if err := outbox.SendEmail(m); err != nil {
+		t.Fatalf("SendEmail: %v", err)
+	}
+}
+
+func TestOutboxDelivers(t *testing.T) {
+	outbox, repo, standIn := newTestOutbox(t)
+	enqueue(t, outbox, "jane@example.com", "First")
+	enqueue(t, outbox, "john@example.com", "Second")
+
+	outbox.deliverDue()
+
+	for id, to := range map[uint]string{1: "jane@example.com", 2: "john@example.com"} {
+		email := repo.get(id)
+		if email.Status != common_constants.EmailStatusSent || email.Attempts != 1 || email.SentAt == nil {
+			t.Errorf("email %d: status %s after %d attempts, want sent after 1", id, email.Status, email.Attempts)
+		}
+		if len(email.Message) != 0 {
+			t.Errorf("email %d: message kept after sending", id)
+		}
+		if messages := standIn.Messages(to); len(messages) != 1 {
+			t.Errorf("stand-in received %d messages for %s, want 1", len(messages), to)
+		}
+	}
+	if messages := standIn.Messages("jane@example.com"); len(messages) == 1 && !strings.Contains(messages[0].Data, "Subject: First") {
+		t.Errorf("delivered message lost its subject: %q", messages[0].Data)
+	}
+
+	// Sent emails aren't claimed again
+	outbox.deliverDue()
+	if messages := standIn.Messages(""); len(messages) != 2 {
+		t.Errorf("stand-in received %d messages after a second pass, want 2", len(messages))
+	}
+}
+
+func TestOutboxRetriesWithBackoff(t *testing.T) {
+	outbox, repo, standIn := newTestOutbox(t)
+	standIn.FailNext(2, 451)
+	enqueue(t, outbox, "jane@example.com", "Retried")
+
+	before := time.Now()
+	outbox.deliverDue()
+	email := repo.get(1)
+	if email.Status != common_constants.EmailStatusPending || email.Attempts != 1 || email.LastError == "" {
+		t.Fatalf("after a temporary failure: status %s, attempts %d, error %q", email.Status, email.Attempts, email.LastError)
+	}
+	firstDelay := email.NextAttemptAt.Sub(before)
+	if firstDelay < common_constants.EmailRetryBaseDelay || firstDelay > common_constants.EmailRetryBaseDelay*11/10+time.Second {
+		t.Fatalf("first retry in %s, want about %s", firstDelay, common_constants.EmailRetryBaseDelay)
+	}
+
+	// Not due yet, nothing is sent
+	outbox.deliverDue()
+	if email = repo.get(1); email.Attempts != 1 {
+		t.Fatalf("email retried before its backoff, attempts %d", email.Attempts)
+	}
+
+	repo.makeDue(1)
+	before = time.Now()
+	outbox.deliverDue()
+	email = repo.get(1)
+	secondDelay := email.NextAttemptAt.Sub(before)
+	if email.Attempts != 2 || secondDelay < 2*common_constants.EmailRetryBaseDelay {
+		t.Fatalf("second retry after %d attempts in %s, want the delay doubled to %s", email.Attempts, secondDelay, 2*common_constants.EmailRetryBaseDelay)
+	}
+
+	repo.makeDue(1)
+	outbox.deliverDue()
+	if email = repo.get(1); email.Status != common_constants.EmailStatusSent || email.Attempts != 3 {
+		t.Fatalf("after the failures cleared: status %s, attempts %d, want sent after 3", email.Status, email.Attempts)
+	}
+	if messages := standIn.Messages("jane@example.com"); len(messages) != 1 {
+		t.Fatalf("stand-in received %d messages, want 1", len(messages))
+	}
+}
+
+func TestOutboxDeadLettersPermanentFailures(t *testing.T) {
+	outbox, repo, standIn := newTestOutbox(t)
+	standIn.FailNext(1, 550)
+	enqueue(t, outbox, "nobody@example.com", "Rejected")
+
+	outbox.deliverDue()
+	if email := repo.get(1); email.Status != common_constants.EmailStatusDead || email.Attempts != 1 {
+		t.Fatalf("after a permanent failure: status %s, attempts %d, want dead after 1", email.Status, email.Attempts)
+	}
+
+	// Dead emails stay put until an admin resends them
+	repo.makeDue(1)
+	outbox.deliverDue()
+	if messages := standIn.Messages(""); len(messages) != 0 {
+		t.Fatalf("dead email was sent, stand-in received %d messages", len(messages))
+	}
+}
+
+func TestOutboxDeadLettersAfterMaxAttempts(t *testing.T) {
+	outbox, repo, standIn := newTestOutbox(t)
+	standIn.FailNext(common_constants.MaxEmailAttempts, 451)
+	enqueue(t, outbox, "jane@example.com", "Unlucky")
+
+	for attempt := 1; attempt <= common_constants.MaxEmailAttempts; attempt++ {
+		repo.makeDue(1)
+		outbox.deliverDue()
+		email := repo.get(1)
+		if email.Attempts != attempt {
+			t.Fatalf("attempt %d: %d attempts recorded", attempt, email.Attempts)
+		}
+		wantStatus := common_constants.EmailStatusPending
+		if attempt == common_constants.MaxEmailAttempts {
+			wantStatus = common_constants.EmailStatusDead
+		}
+		if email.Status != wantStatus {
+			t.Fatalf("attempt %d: status %s, want %s", attempt, email.Status, wantStatus)
+		}
+	}
+}
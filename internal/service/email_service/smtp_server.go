@@ -1,43 +1,92 @@
 package email_service
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"net/textproto"
 	"sync"
+	"time"
 
 	"github.com/nikhil/url-shortner-backend/config"
 	"gopkg.in/gomail.v2"
 )
 
-type smtpEmailService struct {
-	emailConfig config.EmailConfig
+// SMTPSender delivers raw messages over one pooled SMTP connection. The connection is dialed on
+// the first message and reused until it fails or CloseIdle finds it idle.
+type SMTPSender struct {
+	dialer   *gomail.Dialer
+	from     string
+	mu       sync.Mutex
+	conn     gomail.SendCloser
+	lastUsed time.Time
 }
 
-var (
-	instance *smtpEmailService
-	once     sync.Once
-)
+func NewSMTPSender(emailConfig config.EmailConfig) *SMTPSender {
+	return &SMTPSender{
+		dialer: gomail.NewDialer(emailConfig.SMTPHost, emailConfig.SMTPPort, emailConfig.SMTPUsername, emailConfig.SMTPPassword),
+		from:   emailConfig.FromEmail,
+	}
+}
 
-// GetSMTPEmailService returns the singleton instance of smtpEmailService
-func GetSMTPEmailService(emailConfig config.EmailConfig) IEmailService {
-	once.Do(func() {
-		instance = &smtpEmailService{
-			emailConfig: emailConfig,
+// Send delivers a MIME message. A pooled connection that went stale, failing without a reply of
+// the server, is redialed once.
+func (s *SMTPSender) Send(to []string, message []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reused := s.conn != nil
+	err := s.send(to, message)
+	var replyErr *textproto.Error
+	if err != nil && reused && !errors.As(err, &replyErr) {
+		err = s.send(to, message)
+	}
+	return err
+}
+
+func (s *SMTPSender) send(to []string, message []byte) error {
+	if s.conn == nil {
+		conn, err := s.dialer.Dial()
+		if err != nil {
+			return fmt.Errorf("failed to connect to smtp server: %w", err)
 		}
-	})
-	return instance
-}
-
-// SendEmail sends mail in a thread-safe manner
-func (e *smtpEmailService) SendEmail(message *gomail.Message) error {
-	message.SetHeader("From", e.emailConfig.FromEmail)
-	dialer := gomail.Dialer{
-		Host:     e.emailConfig.SMTPHost,
-		Port:     e.emailConfig.SMTPPort,
-		Username: e.emailConfig.SMTPUsername,
-		Password: e.emailConfig.SMTPPassword,
+		s.conn = conn
 	}
-	if err := dialer.DialAndSend(message); err != nil {
-		return fmt.Errorf("failed to send email: %v", err)
+	s.lastUsed = time.Now()
+	if err := s.conn.Send(s.from, to, bytes.NewReader(message)); err != nil {
+		// The state of the session is unknown after an error, start over with a new connection
+		s.closeConn()
+		return fmt.Errorf("failed to send email: %w", err)
 	}
 	return nil
 }
+
+// CloseIdle closes the connection when nothing was sent for the given duration
+func (s *SMTPSender) CloseIdle(idle time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil && time.Since(s.lastUsed) >= idle {
+		s.closeConn()
+	}
+}
+
+// Close closes the connection, the next message dials a new one
+func (s *SMTPSender) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeConn()
+}
+
+func (s *SMTPSender) closeConn() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// IsPermanentSMTPError reports whether the server rejected a message for good (5xx reply), so
+// that retrying it can't help
+func IsPermanentSMTPError(err error) bool {
+	var replyErr *textproto.Error
+	return errors.As(err, &replyErr) && replyErr.Code >= 500
+}
@@ -0,0 +1,406 @@
+package email_service
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"gopkg.in/gomail.v2"
+)
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// layoutTemplate is the file of every locale holding the blocks shared by its emails
+const layoutTemplate = "layout"
+
+var (
+	ErrUnknownTemplate = errors.New("unknown email template")
+	ErrInvalidTemplate = errors.New("email template must define subject, text and html")
+)
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// emailTemplates are the templates of the registry, in the order they are listed
+var emailTemplates = []common_constants.EmailTemplate{
+	common_constants.EmailTemplateOTP,
+	common_constants.EmailTemplatePasswordReset,
+	common_constants.EmailTemplateLockoutNotice,
+	common_constants.EmailTemplateLinkExpiryNotice,
+	common_constants.EmailTemplateWorkspaceInvitation,
+	common_constants.EmailTemplateMagicLink,
+	common_constants.EmailTemplateOTPChangeNotice,
+}
+
+// templateSamples returns the data previews of a template are rendered with
+func templateSamples(name common_constants.EmailTemplate) TemplateData {
+	switch name {
+	case common_constants.EmailTemplateOTP:
+		return TemplateData{"OTP": "492039", "Purpose": string(common_constants.OTPPurposeSignup), "ExpiresInMinutes": 5}
+	case common_constants.EmailTemplatePasswordReset:
+		return TemplateData{"OTP": "492039", "ExpiresInMinutes": 5}
+	case common_constants.EmailTemplateLockoutNotice:
+		return TemplateData{"Name": "Jane Doe", "FailedAttempts": 5, "Until": time.Now().Add(15 * time.Minute)}
+	case common_constants.EmailTemplateLinkExpiryNotice:
+		return TemplateData{"Name": "Jane Doe", "ShortURL": "https://sho.rt/abc123", "LongURL": "https://example.com/spring-sale"}
+	case common_constants.EmailTemplateWorkspaceInvitation:
+		return TemplateData{
+			"InviterName": "Jane Doe", "WorkspaceName": "Marketing", "Role": string(common_constants.WorkspaceRoleEditor),
+			"Token": "3f9a1c0e7b2d4f6a8c1e3b5d7f9a0c2e", "ExpiresAt": time.Now().Add(common_constants.WorkspaceInvitationTTL),
+		}
+	case common_constants.EmailTemplateMagicLink:
+		return TemplateData{"Name": "Jane Doe", "Link": "https://sho.rt/login/magic?token=eyJhbGciOi", "ExpiresInMinutes": 10}
+	case common_constants.EmailTemplateOTPChangeNotice:
+		return TemplateData{"Name": "Jane Doe", "Change": "channel", "Channel": string(common_constants.OTPChannelSMS), "PhoneLast4": "0123"}
+	}
+	return TemplateData{}
+}
+
+var templateFuncs = map[string]any{
+	// formatTime formats times the same way in every locale, so they read unambiguously
+	"formatTime": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04 MST")
+	},
+}
+
+// TemplateData is the data an email template is rendered with. The registry adds SupportEmail and Locale.
+type TemplateData map[string]any
+
+// RenderedEmail is an email rendered from a template
+type RenderedEmail struct {
+	Template common_constants.EmailTemplate `json:"template"`
+	Locale   string                         `json:"locale"` // locale the email was rendered in, after fallbacks
+	Subject  string                         `json:"subject"`
+	Text     string                         `json:"text"`
+	HTML     string                         `json:"html"`
+}
+
+// Message returns the email as a multipart message, with the plain text alternative first as
+// clients show the last alternative they support
+func (e *RenderedEmail) Message(to string) *gomail.Message {
+	m := gomail.NewMessage()
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", e.Subject)
+	m.SetBody("text/plain", e.Text)
+	m.AddAlternative("text/html", e.HTML)
+	return m
+}
+
+// TemplateInfo describes a template and the locales it is available in
+type TemplateInfo struct {
+	Name       common_constants.EmailTemplate `json:"name"`
+	Locales    []string                       `json:"locales"`
+	Overridden []string                       `json:"overridden"` // locales read from the templates directory
+}
+
+// templateSource is the content of a template file and where it was read from
+type templateSource struct {
+	content    []byte
+	version    string
+	overridden bool
+}
+
+// parsedTemplate is a template file and the layout of its locale, parsed for both text and HTML
+// output. version changes when a file of the templates directory is edited.
+type parsedTemplate struct {
+	version string
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// TemplateRegistry renders transactional emails. Templates are embedded in the binary, and any file
+// can be overridden by a file at the same path of the templates directory, such as <dir>/es/otp.tmpl,
+// so copy can change without a deploy. Overrides are picked up when they change, without a restart.
+//
+// Every template file defines a "subject", a "text" and an "html" block. The layout.tmpl file of the
+// locale holds the blocks they share.
+type TemplateRegistry struct {
+	dir           string
+	defaultLocale string
+	supportEmail  string
+	log           *logger.Logger
+	mu            sync.Mutex
+	parsed        map[string]*parsedTemplate
+}
+
+// NewTemplateRegistry returns a registry reading overrides from dir, or only the embedded templates
+// when dir is empty. It fails if an embedded template doesn't render, or if a template is missing
+// in the default locale. Overrides that don't render are logged and skipped.
+func NewTemplateRegistry(dir string, defaultLocale string, supportEmail string, log *logger.Logger) (*TemplateRegistry, error) {
+	if dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("email templates directory %s not found", dir)
+		}
+	}
+	r := &TemplateRegistry{
+		dir:           dir,
+		defaultLocale: NormalizeLocale(defaultLocale),
+		supportEmail:  supportEmail,
+		log:           log,
+		parsed:        make(map[string]*parsedTemplate),
+	}
+	if r.defaultLocale == "" {
+		return nil, fmt.Errorf("invalid default locale %q", defaultLocale)
+	}
+
+	for _, name := range emailTemplates {
+		if _, found, _ := r.source(r.defaultLocale, string(name), true); !found {
+			return nil, fmt.Errorf("email template %s is missing in the default locale %s", name, r.defaultLocale)
+		}
+		for _, locale := range r.locales() {
+			if _, found, _ := r.source(locale, string(name), false); found {
+				if _, err := r.render(name, locale, templateSamples(name), false); err != nil {
+					return nil, err
+				}
+			}
+			if _, found, _ := r.source(locale, string(name), true); found {
+				if _, err := r.render(name, locale, templateSamples(name), true); err != nil {
+					log.Errorf("Email template override %s/%s doesn't render, using the embedded one, err: %v", locale, name, err)
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+// NormalizeLocale returns a locale such as "es-MX" as "es-mx", or "" when it isn't a valid locale
+func NormalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	if !localePattern.MatchString(locale) {
+		return ""
+	}
+	return locale
+}
+
+// Render renders a template in the closest available locale: the locale itself, its language, then
+// the default locale. A broken override falls back to the embedded template.
+func (r *TemplateRegistry) Render(name common_constants.EmailTemplate, locale string, data TemplateData) (*RenderedEmail, error) {
+	locale, err := r.resolveLocale(name, locale)
+	if err != nil {
+		return nil, err
+	}
+	email, err := r.render(name, locale, data, true)
+	if err != nil && r.dir != "" {
+		r.log.Errorf("Failed to render email template override %s/%s, using the embedded one, err: %v", locale, name, err)
+		if email, err = r.render(name, locale, data, false); err != nil {
+			// Only the override has the locale, use the default one
+			email, err = r.render(name, r.defaultLocale, data, false)
+		}
+	}
+	return email, err
+}
+
+// Message renders a template and returns it as a message to the given address
+func (r *TemplateRegistry) Message(name common_constants.EmailTemplate, locale string, to string, data TemplateData) (*gomail.Message, error) {
+	email, err := r.Render(name, locale, data)
+	if err != nil {
+		return nil, err
+	}
+	return email.Message(to), nil
+}
+
+// Preview renders a template with sample data. Unlike Render, errors of overrides are returned
+// so that they can be fixed.
+func (r *TemplateRegistry) Preview(name common_constants.EmailTemplate, locale string) (*RenderedEmail, error) {
+	locale, err := r.resolveLocale(name, locale)
+	if err != nil {
+		return nil, err
+	}
+	return r.render(name, locale, templateSamples(name), true)
+}
+
+// Templates lists the templates and the locales they are available in
+func (r *TemplateRegistry) Templates() []TemplateInfo {
+	locales := r.locales()
+	templates := make([]TemplateInfo, 0, len(emailTemplates))
+	for _, name := range emailTemplates {
+		info := TemplateInfo{Name: name, Locales: []string{}, Overridden: []string{}}
+		for _, locale := range locales {
+			source, found, _ := r.source(locale, string(name), true)
+			if !found {
+				continue
+			}
+			info.Locales = append(info.Locales, locale)
+			if source.overridden {
+				info.Overridden = append(info.Overridden, locale)
+			}
+		}
+		templates = append(templates, info)
+	}
+	return templates
+}
+
+// resolveLocale returns the closest locale the template is available in
+func (r *TemplateRegistry) resolveLocale(name common_constants.EmailTemplate, locale string) (string, error) {
+	known := false
+	for _, template := range emailTemplates {
+		known = known || template == name
+	}
+	if !known {
+		return "", ErrUnknownTemplate
+	}
+
+	candidates := []string{}
+	if locale = NormalizeLocale(locale); locale != "" {
+		candidates = append(candidates, locale)
+		if language, _, found := strings.Cut(locale, "-"); found {
+			candidates = append(candidates, language)
+		}
+	}
+	for _, candidate := range append(candidates, r.defaultLocale) {
+		if _, found, _ := r.source(candidate, string(name), true); found {
+			return candidate, nil
+		}
+	}
+	return "", ErrUnknownTemplate
+}
+
+// locales returns the locales with a directory, embedded or in the templates directory
+func (r *TemplateRegistry) locales() []string {
+	seen := map[string]bool{}
+	if entries, err := fs.ReadDir(embeddedTemplates, "templates"); err == nil {
+		for _, entry := range entries {
+			seen[entry.Name()] = entry.IsDir()
+		}
+	}
+	if r.dir != "" {
+		if entries, err := os.ReadDir(r.dir); err == nil {
+			for _, entry := range entries {
+				seen[entry.Name()] = seen[entry.Name()] || entry.IsDir()
+			}
+		}
+	}
+	locales := make([]string, 0, len(seen))
+	for locale, isDir := range seen {
+		if isDir && NormalizeLocale(locale) == locale {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// source reads a template file of a locale, from the templates directory when it has one and
+// withOverrides is set, or from the embedded templates
+func (r *TemplateRegistry) source(locale string, file string, withOverrides bool) (*templateSource, bool, error) {
+	filePath := path.Join(locale, file+".tmpl")
+	if withOverrides && r.dir != "" {
+		overridePath := filepath.Join(r.dir, filepath.FromSlash(filePath))
+		if info, err := os.Stat(overridePath); err == nil && info.Mode().IsRegular() {
+			content, err := os.ReadFile(overridePath)
+			if err != nil {
+				return nil, true, err
+			}
+			return &templateSource{
+				content:    content,
+				version:    fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size()),
+				overridden: true,
+			}, true, nil
+		}
+	}
+	content, err := fs.ReadFile(embeddedTemplates, path.Join("templates", filePath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	return &templateSource{content: content, version: "embedded"}, true, nil
+}
+
+// parse returns the parsed template of a locale, parsing it again when one of its files changed
+func (r *TemplateRegistry) parse(name common_constants.EmailTemplate, locale string, withOverrides bool) (*parsedTemplate, error) {
+	source, found, err := r.source(locale, string(name), withOverrides)
+	if err == nil && !found {
+		err = ErrUnknownTemplate
+	}
+	if err != nil {
+		return nil, err
+	}
+	layout, found, err := r.source(locale, layoutTemplate, withOverrides)
+	if err == nil && !found {
+		// Locales may translate only some emails and share the layout of the default locale
+		layout, found, err = r.source(r.defaultLocale, layoutTemplate, withOverrides)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		layout = &templateSource{version: "none"}
+	}
+
+	key := fmt.Sprintf("%s/%s/%t", locale, name, withOverrides)
+	version := source.version + "|" + layout.version
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if parsed, ok := r.parsed[key]; ok && parsed.version == version {
+		return parsed, nil
+	}
+
+	text := texttemplate.New(string(name)).Funcs(templateFuncs).Option("missingkey=error")
+	html := htmltemplate.New(string(name)).Funcs(templateFuncs).Option("missingkey=error")
+	for _, content := range []string{string(layout.content), string(source.content)} {
+		if _, err = text.Parse(content); err != nil {
+			return nil, fmt.Errorf("failed to parse email template %s/%s: %w", locale, name, err)
+		}
+		if _, err = html.Parse(content); err != nil {
+			return nil, fmt.Errorf("failed to parse email template %s/%s: %w", locale, name, err)
+		}
+	}
+	for _, block := range []string{"subject", "text", "html"} {
+		if text.Lookup(block) == nil {
+			return nil, fmt.Errorf("%w: %s/%s has no %s", ErrInvalidTemplate, locale, name, block)
+		}
+	}
+
+	parsed := &parsedTemplate{version: version, text: text, html: html}
+	r.parsed[key] = parsed
+	return parsed, nil
+}
+
+func (r *TemplateRegistry) render(name common_constants.EmailTemplate, locale string, data TemplateData, withOverrides bool) (*RenderedEmail, error) {
+	parsed, err := r.parse(name, locale, withOverrides)
+	if err != nil {
+		return nil, err
+	}
+
+	templateData := make(TemplateData, len(data)+2)
+	for key, value := range data {
+		templateData[key] = value
+	}
+	templateData["SupportEmail"] = r.supportEmail
+	templateData["Locale"] = locale
+
+	var subject, text, html bytes.Buffer
+	if err = parsed.text.ExecuteTemplate(&subject, "subject", templateData); err != nil {
+		return nil, fmt.Errorf("failed to render email template %s/%s: %w", locale, name, err)
+	}
+	if err = parsed.text.ExecuteTemplate(&text, "text", templateData); err != nil {
+		return nil, fmt.Errorf("failed to render email template %s/%s: %w", locale, name, err)
+	}
+	if err = parsed.html.ExecuteTemplate(&html, "html", templateData); err != nil {
+		return nil, fmt.Errorf("failed to render email template %s/%s: %w", locale, name, err)
+	}
+	return &RenderedEmail{
+		Template: name,
+		Locale:   locale,
+		Subject:  strings.Join(strings.Fields(subject.String()), " "),
+		Text:     strings.TrimSpace(text.String()) + "\n",
+		HTML:     strings.TrimSpace(html.String()) + "\n",
+	}, nil
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/repository"
+	"github.com/nikhil/url-shortner-backend/internal/service/email_service"
+)
+
+// ExpirySweeper periodically marks links that reached their expiry date or click limit as
+// expired, and emails the owners who asked to be notified.
+type ExpirySweeper struct {
+	urlRepo        *repository.URLRepository
+	urlService     *URLService
+	emailService   email_service.IEmailService
+	emailTemplates *email_service.TemplateRegistry
+	log            *logger.Logger
+	sweepInterval  time.Duration
+
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func NewExpirySweeper(
+	urlRepo *repository.URLRepository,
+	urlService *URLService,
+	emailService email_service.IEmailService,
+	emailTemplates *email_service.TemplateRegistry,
+	log *logger.Logger,
+) *ExpirySweeper {
+	return &ExpirySweeper{
+		urlRepo:        urlRepo,
+		urlService:     urlService,
+		emailService:   emailService,
+		emailTemplates: emailTemplates,
+		log:            log,
+		sweepInterval:  common_constants.ExpirySweepInterval,
+		stopCh:         make(chan struct{}),
+		doneCh:         make(chan struct{}),
+	}
+}
+
+// Start launches the background sweeper
+func (s *ExpirySweeper) Start() {
+	go s.run()
+}
+
+// Stop stops the background sweeper, waiting for a running sweep to finish
+func (s *ExpirySweeper) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		<-s.doneCh
+	})
+}
+
+func (s *ExpirySweeper) run() {
+	defer close(s.doneCh)
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.sweep()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// sweep marks expired links batch by batch until none are left
+func (s *ExpirySweeper) sweep() {
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		default:
+		}
+
+		now := time.Now()
+		urls, err := s.urlRepo.FindUnmarkedExpired(now, common_constants.ExpirySweepBatchSize)
+		if err != nil {
+			s.log.Errorf("Failed to find expired urls, err: %v", err)
+			return
+		}
+		if len(urls) == 0 {
+			return
+		}
+
+		ids := make([]uint, len(urls))
+		for i := range urls {
+			ids[i] = urls[i].ID
+		}
+		if err = s.urlRepo.MarkExpired(ids, now); err != nil {
+			s.log.Errorf("Failed to mark %d urls as expired, err: %v", len(ids), err)
+			return
+		}
+		s.notifyOwners(urls)
+
+		if len(urls) < common_constants.ExpirySweepBatchSize {
+			return
+		}
+	}
+}
+
+// notifyOwners emails the owners of expired links that have notifications turned on.
+// A failed email is logged and not retried.
+func (s *ExpirySweeper) notifyOwners(urls []model.URL) {
+	var notify []*model.URL
+	for i := range urls {
+		if urls[i].NotifyOnExpiry && urls[i].User.Email != "" {
+			notify = append(notify, &urls[i])
+		}
+	}
+	if len(notify) == 0 {
+		return
+	}
+	if err := s.urlService.setShortURLs(notify...); err != nil {
+		s.log.Errorf("Failed to build short urls of expired links, err: %v", err)
+		return
+	}
+
+	for _, url := range notify {
+		m, err := s.emailTemplates.Message(common_constants.EmailTemplateLinkExpiryNotice, url.User.Locale, url.User.Email, email_service.TemplateData{
+			"Name":     url.User.Name,
+			"ShortURL": url.ShortURL,
+			"LongURL":  url.LongURL,
+		})
+		if err != nil {
+			s.log.Errorf("Failed to render expiry notification for url id: %d, err: %v", url.ID, err)
+			continue
+		}
+		if err = s.emailService.SendEmail(m); err != nil {
+			s.log.Errorf("Failed to send expiry notification for url id: %d, err: %v", url.ID, err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/repository"
+	"github.com/nikhil/url-shortner-backend/internal/utils"
+	"github.com/nikhil/url-shortner-backend/pkg/token"
+)
+
+// keyManagerInitAttempts bounds how long Init waits for another instance creating the first key
+const keyManagerInitAttempts = 10
+
+// KeyManager keeps the JWT signing keys of the token issuer in sync with the database and
+// rotates them. A new key is published ahead of signing, and the key it replaces stays
+// valid for verification until the longest lived token it signed has expired.
+type KeyManager struct {
+	keyRepo          *repository.SigningKeyRepository
+	issuer           *token.KeySetIssuer
+	encryptionKey    []byte
+	algorithm        string
+	rotationInterval time.Duration
+	log              *logger.Logger
+
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func NewKeyManager(
+	keyRepo *repository.SigningKeyRepository,
+	issuer *token.KeySetIssuer,
+	encryptionKey []byte,
+	algorithm string,
+	rotationInterval time.Duration,
+	log *logger.Logger,
+) *KeyManager {
+	return &KeyManager{
+		keyRepo:          keyRepo,
+		issuer:           issuer,
+		encryptionKey:    encryptionKey,
+		algorithm:        algorithm,
+		rotationInterval: rotationInterval,
+		log:              log,
+		stopCh:           make(chan struct{}),
+		doneCh:           make(chan struct{}),
+	}
+}
+
+// Init loads the keys into the issuer, creating the first key on a fresh database. It must
+// succeed before the server issues any token.
+func (m *KeyManager) Init() error {
+	for attempt := 0; attempt < keyManagerInitAttempts; attempt++ {
+		hasSigningKey, err := m.reload()
+		if err != nil {
+			return err
+		}
+		if hasSigningKey {
+			return nil
+		}
+		rotated, err := m.rotateIfDue()
+		if err != nil {
+			return err
+		}
+		if !rotated {
+			// Another instance holds the rotation lock, wait for its key
+			time.Sleep(time.Second)
+		}
+	}
+	return token.ErrNoSigningKey
+}
+
+// Start launches the background rotation
+func (m *KeyManager) Start() {
+	go m.run()
+}
+
+// Stop stops the background rotation
+func (m *KeyManager) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopCh)
+		<-m.doneCh
+	})
+}
+
+func (m *KeyManager) run() {
+	defer close(m.doneCh)
+	ticker := time.NewTicker(common_constants.SigningKeyRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := m.rotateIfDue(); err != nil {
+				m.log.Errorf("Failed to rotate signing keys: %v", err)
+			}
+			if _, err := m.reload(); err != nil {
+				m.log.Errorf("Failed to reload signing keys: %v", err)
+			}
+			if err := m.keyRepo.DeleteRetired(time.Now()); err != nil {
+				m.log.Errorf("Failed to delete retired signing keys: %v", err)
+			}
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// reload hands the live keys to the issuer and reports whether one of them can sign right now
+func (m *KeyManager) reload() (bool, error) {
+	now := time.Now()
+	keys, err := m.keyRepo.FindLive(now)
+	if err != nil {
+		return false, err
+	}
+
+	var signingKey *token.Key
+	parsed := make([]*token.Key, 0, len(keys))
+	for _, key := range keys {
+		privateKey, err := utils.Decrypt(m.encryptionKey, key.PrivateKey)
+		if err != nil {
+			m.log.Errorf("Failed to decrypt signing key: %s, err: %v", key.KID, err)
+			continue
+		}
+		tokenKey, err := token.ParseKey(key.KID, key.Algorithm, privateKey)
+		if err != nil {
+			m.log.Errorf("Failed to parse signing key: %s, err: %v", key.KID, err)
+			continue
+		}
+		parsed = append(parsed, tokenKey)
+		// Keys are ordered by signing date, the newest one that has started signing wins
+		if !key.SigningFrom.After(now) && (key.RetireAt == nil || key.RetireAt.After(now)) {
+			signingKey = tokenKey
+		}
+	}
+	m.issuer.SetKeys(signingKey, parsed)
+	return signingKey != nil, nil
+}
+
+// rotationDue tells whether a new key is needed and when it should start signing
+func (m *KeyManager) rotationDue(keys []model.SigningKey) (bool, time.Time) {
+	now := time.Now()
+	if len(keys) == 0 || keys[0].SigningFrom.After(now) {
+		// Nothing can sign yet, the new key has to be used straight away
+		return true, now
+	}
+	newest := keys[len(keys)-1]
+	if newest.Algorithm != m.algorithm || now.Sub(newest.SigningFrom) >= m.rotationInterval {
+		return true, now.Add(common_constants.SigningKeyPublishLeadTime)
+	}
+	return false, time.Time{}
+}
+
+// rotateIfDue creates a new key when the newest one is older than the rotation interval or uses
+// another algorithm than the configured one, and schedules the retirement of the previous keys
+func (m *KeyManager) rotateIfDue() (bool, error) {
+	keys, err := m.keyRepo.FindLive(time.Now())
+	if err != nil {
+		return false, err
+	}
+	if due, _ := m.rotationDue(keys); !due {
+		return false, nil
+	}
+
+	ctx := context.Background()
+	acquired, err := m.keyRepo.AcquireRotationLock(ctx, common_constants.SigningKeyRotationLockTTL)
+	if err != nil || !acquired {
+		return false, err
+	}
+	defer func() {
+		if err := m.keyRepo.ReleaseRotationLock(ctx); err != nil {
+			m.log.Errorf("Failed to release signing key rotation lock: %v", err)
+		}
+	}()
+
+	// Check again under the lock, another instance may have rotated in the meantime
+	keys, err = m.keyRepo.FindLive(time.Now())
+	if err != nil {
+		return false, err
+	}
+	due, signingFrom := m.rotationDue(keys)
+	if !due {
+		return false, nil
+	}
+
+	key, err := m.newSigningKey(signingFrom)
+	if err != nil {
+		return false, err
+	}
+	if err = m.keyRepo.Create(key); err != nil {
+		return false, err
+	}
+	// Tokens signed by the previous keys until the new one takes over stay verifiable until they expire
+	if err = m.keyRepo.RetireActive(key.KID, signingFrom.Add(common_constants.RefreshTokenTTL)); err != nil {
+		return false, err
+	}
+	m.log.Infof("Rotated signing key, kid: %s, algorithm: %s, signing from: %s", key.KID, key.Algorithm, signingFrom.Format(time.RFC3339))
+	return true, nil
+}
+
+func (m *KeyManager) newSigningKey(signingFrom time.Time) (*model.SigningKey, error) {
+	suffix, err := utils.GenerateRandomToken(4)
+	if err != nil {
+		return nil, err
+	}
+	// kids sort by creation date, which keeps the newest key first in the JWKS
+	kid := signingFrom.UTC().Format("20060102T150405") + "-" + suffix
+	tokenKey, err := token.GenerateKey(kid, m.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := tokenKey.MarshalPrivate()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := utils.Encrypt(m.encryptionKey, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &model.SigningKey{
+		KID:         kid,
+		Algorithm:   m.algorithm,
+		PrivateKey:  encrypted,
+		SigningFrom: signingFrom,
+	}, nil
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/internal/dto"
+)
+
+// LinkAccess signs the tokens that let a visitor through a protected link once it has been unlocked.
+// A token is bound to the link and a fingerprint of its password, so changing the password revokes all tokens.
+type LinkAccess struct {
+	secret []byte
+}
+
+func NewLinkAccess(secret string) *LinkAccess {
+	return &LinkAccess{secret: []byte(secret)}
+}
+
+// Sign returns an access token for the link that is valid until expiresAt
+func (a *LinkAccess) Sign(url *dto.RedirectURL, expiresAt time.Time) string {
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expiry + "." + a.mac(url, expiry)
+}
+
+// Verify tells whether the token grants access to the link
+func (a *LinkAccess) Verify(url *dto.RedirectURL, token string) bool {
+	expiry, mac, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() >= expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(mac), []byte(a.mac(url, expiry)))
+}
+
+func (a *LinkAccess) mac(url *dto.RedirectURL, expiry string) string {
+	h := hmac.New(sha256.New, a.secret)
+	fmt.Fprintf(h, "%d:%d:%s:%s:%s", url.ID, url.DomainID, url.ShortCode, url.PasswordFingerprint, expiry)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
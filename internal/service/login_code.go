@@ -0,0 +1,74 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/dto"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/service/otp_service"
+)
+
+// RequestLoginCode sends a sign in code over the OTP channel the user picked: email, sms or webhook.
+// Like magic links, nothing is sent, without telling the caller, for unknown, disabled and locked
+// accounts, nor while a code sent moments ago is cooling down.
+func (s *AuthService) RequestLoginCode(ctx *gin.Context, email string) error {
+	log := logger.GetLogger(ctx)
+	// Throttled IPs are told so whether the email is known or not
+	if err := s.checkLoginThrottle(ctx, nil); err != nil {
+		return err
+	}
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil || user.DisabledAt != nil {
+		return nil
+	}
+	lockedUntil, err := s.rateLimitRepo.LockedUntil(ctx, getAccountLockKey(user.ID))
+	if err != nil {
+		log.Errorf("Failed to get lock of user: %d, err: %v", user.ID, err)
+	}
+	if lockedUntil.After(time.Now()) {
+		return nil
+	}
+
+	err = s.otpService.SendOTP(ctx, common_constants.OTPPurposeLogin, s.otpRecipient(ctx, user))
+	if errors.Is(err, otp_service.ErrOTPCooldown) {
+		return nil
+	}
+	if err != nil {
+		log.Errorf("failed to send OTP: %v", err)
+		return err
+	}
+	return nil
+}
+
+// LoginWithCode exchanges a code sent by RequestLoginCode for a session. Wrong codes count as failed
+// logins. Like Login, users who need a second factor get a challenge instead.
+func (s *AuthService) LoginWithCode(ctx *gin.Context, email string, otp string, deviceName string) (*dto.LoginResponse, error) {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		user = nil
+	}
+	if err = s.checkLoginThrottle(ctx, user); err != nil {
+		return nil, err
+	}
+	if user == nil {
+		// Answered like a wrong code, so that unknown emails can't be told apart
+		_ = s.recordLoginFailure(ctx, nil)
+		return nil, otp_service.ErrInvalidOTP
+	}
+
+	if err = s.otpService.VerifyOTP(ctx, common_constants.OTPPurposeLogin, user.Email, otp); err != nil {
+		var throttledErr *LoginThrottledError
+		if failureErr := s.recordLoginFailure(ctx, user); errors.As(failureErr, &throttledErr) {
+			return nil, failureErr
+		}
+		return nil, err
+	}
+	s.clearLoginFailures(ctx, user.ID)
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+	return s.completeLogin(ctx, user, deviceName)
+}
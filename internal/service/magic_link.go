@@ -0,0 +1,165 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/dto"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/service/email_service"
+	"github.com/nikhil/url-shortner-backend/internal/utils"
+	"github.com/nikhil/url-shortner-backend/pkg/token"
+)
+
+var (
+	ErrInvalidMagicLink      = errors.New("invalid, expired or already used magic link")
+	ErrMagicLinkWrongBrowser = errors.New("magic link was requested from another browser")
+)
+
+// magicLinkNonceSize is the size in bytes of the random nonce binding links to a browser
+const magicLinkNonceSize = 16
+
+func getMagicLinkCooldownKey(userID uint) string {
+	return fmt.Sprintf("magic_link_cooldown:%d", userID)
+}
+
+func getMagicLinkUsedKey(tokenID string) string {
+	return "magic_link_used:" + tokenID
+}
+
+// hashMagicLinkNonce is what links carry of the nonce, so that a leaked link doesn't reveal the cookie
+func hashMagicLinkNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestMagicLink emails a single-use sign in link to the owner of the email. The link only works
+// along with the returned nonce, which the browser keeps in a cookie. A nonce the browser already
+// holds is reused so that links requested earlier from it keep working. Nothing is sent, without
+// telling the caller, for unknown, disabled and locked accounts, nor while a link sent moments ago
+// is cooling down.
+func (s *AuthService) RequestMagicLink(ctx *gin.Context, email string, nonce string) (string, error) {
+	log := logger.GetLogger(ctx)
+	if len(nonce) != 2*magicLinkNonceSize {
+		var err error
+		if nonce, err = utils.GenerateRandomToken(magicLinkNonceSize); err != nil {
+			return "", err
+		}
+	}
+
+	// Throttled IPs are told so whether the email is known or not
+	if err := s.checkLoginThrottle(ctx, nil); err != nil {
+		return "", err
+	}
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil || user.DisabledAt != nil {
+		return nonce, nil
+	}
+	lockedUntil, err := s.rateLimitRepo.LockedUntil(ctx, getAccountLockKey(user.ID))
+	if err != nil {
+		log.Errorf("Failed to get lock of user: %d, err: %v", user.ID, err)
+	}
+	if lockedUntil.After(time.Now()) {
+		return nonce, nil
+	}
+	started, err := s.rateLimitRepo.TryLock(ctx, getMagicLinkCooldownKey(user.ID), time.Now().Add(common_constants.MagicLinkCooldown))
+	if err != nil {
+		log.Errorf("Failed to start magic link cooldown of user: %d, err: %v", user.ID, err)
+		return "", err
+	}
+	if !started {
+		return nonce, nil
+	}
+
+	link, err := s.magicLink(user.ID, nonce)
+	if err != nil {
+		log.Errorf("Failed to create magic link of user: %d, err: %v", user.ID, err)
+		return "", err
+	}
+	// Like the lockout notice, sending doesn't hold the response so that its timing doesn't reveal the account
+	go func() {
+		if err := s.sendMagicLink(user, link); err != nil {
+			log.Errorf("Failed to send magic link to user: %d, err: %v", user.ID, err)
+		}
+	}()
+	return nonce, nil
+}
+
+// magicLink signs a link of the user bound to the nonce
+func (s *AuthService) magicLink(userID uint, nonce string) (string, error) {
+	tokenID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	signedToken, err := s.tokenIssuer.Issue(&token.Claims{
+		ID:        tokenID,
+		UserID:    userID,
+		TokenUse:  token.TokenUseMagicLink,
+		Nonce:     hashMagicLinkNonce(nonce),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(common_constants.MagicLinkTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	link, err := url.Parse(s.magicLinkURL)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", signedToken)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+func (s *AuthService) sendMagicLink(user *model.User, link string) error {
+	m, err := s.emailTemplates.Message(common_constants.EmailTemplateMagicLink, user.Locale, user.Email, email_service.TemplateData{
+		"Name":             user.Name,
+		"Link":             link,
+		"ExpiresInMinutes": int(common_constants.MagicLinkTTL / time.Minute),
+	})
+	if err != nil {
+		return err
+	}
+	return s.emailService.SendEmail(m)
+}
+
+// LoginWithMagicLink exchanges a magic link for a session, in the browser holding the nonce the
+// link was requested with. Like Login, users who need a second factor get a challenge instead.
+func (s *AuthService) LoginWithMagicLink(ctx *gin.Context, magicLink string, nonce string, deviceName string) (*dto.LoginResponse, error) {
+	log := logger.GetLogger(ctx)
+	claims, err := s.tokenIssuer.Verify(magicLink)
+	if err != nil || claims.TokenUse != token.TokenUseMagicLink || claims.ID == "" {
+		return nil, ErrInvalidMagicLink
+	}
+	// The browser is checked before the link is used up, so that mail scanners opening links don't burn them
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(hashMagicLinkNonce(nonce)), []byte(claims.Nonce)) != 1 {
+		return nil, ErrMagicLinkWrongBrowser
+	}
+	consumed, err := s.rateLimitRepo.TryLock(ctx, getMagicLinkUsedKey(claims.ID), time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		log.Errorf("Failed to mark magic link: %s as used, err: %v", claims.ID, err)
+		return nil, err
+	}
+	if !consumed {
+		return nil, ErrInvalidMagicLink
+	}
+
+	user, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidMagicLink
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+	return s.completeLogin(ctx, user, deviceName)
+}
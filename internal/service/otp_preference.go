@@ -0,0 +1,270 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/dto"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/service/email_service"
+	"github.com/nikhil/url-shortner-backend/internal/service/otp_service"
+	"github.com/nikhil/url-shortner-backend/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrReauthenticationRequired = errors.New("confirm the change with your password or a code sent over your current otp channel")
+	ErrPhoneNotVerified         = errors.New("a verified phone number is required for sms codes")
+	ErrNoPendingPhone           = errors.New("no phone number is waiting for verification")
+	ErrInvalidOTPChannel        = errors.New("otp channel is not available")
+	ErrInvalidWebhookURL        = errors.New("webhook url must be a public https url")
+)
+
+// webhookSecretSize is the size of webhook signing secrets in bytes
+const webhookSecretSize = 32
+
+// otpRecipient returns where the sign in codes of the user, and the codes confirming changes of where
+// they go, are delivered. Codes fall back to email when the preferred channel isn't available anymore,
+// so users can't lock themselves out. Password reset and unlock codes always go to the email, see
+// ForgotPassword.
+func (s *AuthService) otpRecipient(ctx *gin.Context, user *model.User) *otp_service.Recipient {
+	log := logger.GetLogger(ctx)
+	recipient := otp_service.EmailRecipient(user.Email, user.Locale)
+	switch user.OTPChannel {
+	case common_constants.OTPChannelSMS:
+		if user.PhoneVerifiedAt == nil {
+			return recipient
+		}
+		recipient.Phone = user.Phone
+	case common_constants.OTPChannelWebhook:
+		secret, err := utils.Decrypt(s.encryptionKey, user.OTPWebhookSecret)
+		if err != nil {
+			log.Errorf("Failed to decrypt otp webhook secret of user: %d, err: %v", user.ID, err)
+			return recipient
+		}
+		recipient.WebhookURL = user.OTPWebhookURL
+		recipient.WebhookSecret = string(secret)
+	default:
+		return recipient
+	}
+	recipient.Channel = user.OTPChannel
+	if !s.channelAvailable(recipient.Channel) || s.otpService.ValidateRecipient(recipient) != nil {
+		return otp_service.EmailRecipient(user.Email, user.Locale)
+	}
+	return recipient
+}
+
+func (s *AuthService) channelAvailable(channel common_constants.OTPChannel) bool {
+	for _, available := range s.otpService.Channels() {
+		if available == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *AuthService) newOTPPreferenceResponse(user *model.User) *dto.OTPPreferenceResponse {
+	channels := s.otpService.Channels()
+	availableChannels := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		availableChannels = append(availableChannels, string(channel))
+	}
+	channel := user.OTPChannel
+	if channel == "" {
+		channel = common_constants.OTPChannelEmail
+	}
+	return &dto.OTPPreferenceResponse{
+		Channel:           string(channel),
+		WebhookURL:        user.OTPWebhookURL,
+		Phone:             user.Phone,
+		PhoneVerifiedAt:   user.PhoneVerifiedAt,
+		PendingPhone:      user.PendingPhone,
+		AvailableChannels: availableChannels,
+	}
+}
+
+// reauthenticate confirms that the owner of the account, and not just anyone holding one of its
+// sessions, is moving codes elsewhere. Wrong passwords count as failed logins.
+func (s *AuthService) reauthenticate(ctx *gin.Context, user *model.User, req *dto.Reauthentication) error {
+	if err := s.checkLoginThrottle(ctx, user); err != nil {
+		return err
+	}
+	switch {
+	case req.Password != "":
+		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+			return s.recordLoginFailure(ctx, user)
+		}
+		s.clearLoginFailures(ctx, user.ID)
+		return nil
+	case req.OTP != "":
+		return s.otpService.VerifyOTP(ctx, common_constants.OTPPurposeConfirmOTPChange, user.Email, req.OTP)
+	default:
+		return ErrReauthenticationRequired
+	}
+}
+
+// SendOTPChangeCode sends a code confirming a change of where codes go over the current channel
+func (s *AuthService) SendOTPChangeCode(ctx *gin.Context, userID uint) error {
+	log := logger.GetLogger(ctx)
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if err = s.otpService.SendOTP(ctx, common_constants.OTPPurposeConfirmOTPChange, s.otpRecipient(ctx, user)); err != nil {
+		log.Errorf("failed to send OTP: %v", err)
+		return err
+	}
+	return nil
+}
+
+// notifyOTPChange emails the account address about a change of where codes go, so that a change
+// made from a stolen session doesn't go unnoticed
+func (s *AuthService) notifyOTPChange(ctx *gin.Context, user *model.User, data email_service.TemplateData) {
+	log := logger.GetLogger(ctx)
+	data["Name"] = user.Name
+	m, err := s.emailTemplates.Message(common_constants.EmailTemplateOTPChangeNotice, user.Locale, user.Email, data)
+	if err == nil {
+		err = s.emailService.SendEmail(m)
+	}
+	if err != nil {
+		log.Errorf("Failed to send otp change notice to user: %d, err: %v", user.ID, err)
+	}
+}
+
+// GetOTPPreference returns where codes of the user are delivered
+func (s *AuthService) GetOTPPreference(ctx *gin.Context, userID uint) (*dto.OTPPreferenceResponse, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	return s.newOTPPreferenceResponse(user), nil
+}
+
+// UpdateOTPPreference changes where codes of the user are delivered. Picking a webhook generates a new
+// signing secret, which is only returned by this call.
+func (s *AuthService) UpdateOTPPreference(ctx *gin.Context, userID uint, req *dto.UpdateOTPPreferenceRequest) (*dto.OTPPreferenceResponse, error) {
+	log := logger.GetLogger(ctx)
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if err = s.reauthenticate(ctx, user, &req.Reauthentication); err != nil {
+		return nil, err
+	}
+	channel := common_constants.OTPChannel(req.Channel)
+	if !s.channelAvailable(channel) {
+		return nil, ErrInvalidOTPChannel
+	}
+
+	var webhookURL, webhookSecret, encryptedSecret string
+	switch channel {
+	case common_constants.OTPChannelSMS:
+		if user.PhoneVerifiedAt == nil {
+			return nil, ErrPhoneNotVerified
+		}
+	case common_constants.OTPChannelWebhook:
+		webhookURL = req.WebhookURL
+		if err = s.otpService.ValidateRecipient(&otp_service.Recipient{Channel: channel, WebhookURL: webhookURL}); err != nil {
+			return nil, ErrInvalidWebhookURL
+		}
+		if webhookSecret, err = utils.GenerateRandomToken(webhookSecretSize); err != nil {
+			return nil, err
+		}
+		if encryptedSecret, err = utils.Encrypt(s.encryptionKey, []byte(webhookSecret)); err != nil {
+			log.Errorf("Failed to encrypt otp webhook secret of user: %d, err: %v", user.ID, err)
+			return nil, err
+		}
+	}
+
+	if err = s.userRepo.UpdateOTPChannel(user.ID, channel, webhookURL, encryptedSecret); err != nil {
+		log.Errorf("Failed to update otp channel of user: %d, err: %v", user.ID, err)
+		return nil, err
+	}
+	user.OTPChannel, user.OTPWebhookURL = channel, webhookURL
+	s.notifyOTPChange(ctx, user, email_service.TemplateData{"Change": "channel", "Channel": string(channel)})
+	response := s.newOTPPreferenceResponse(user)
+	response.WebhookSecret = webhookSecret
+	return response, nil
+}
+
+// RegisterPhone texts a code to a new phone number of the user. The number replaces the current one
+// once the code is confirmed with VerifyPhone.
+func (s *AuthService) RegisterPhone(ctx *gin.Context, userID uint, req *dto.RegisterPhoneRequest) (*dto.OTPPreferenceResponse, error) {
+	log := logger.GetLogger(ctx)
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if !s.channelAvailable(common_constants.OTPChannelSMS) {
+		return nil, ErrInvalidOTPChannel
+	}
+	if err = s.reauthenticate(ctx, user, &req.Reauthentication); err != nil {
+		return nil, err
+	}
+	phone := req.Phone
+
+	recipient := &otp_service.Recipient{Email: user.Email, Channel: common_constants.OTPChannelSMS, Phone: phone}
+	if err = s.otpService.SendOTP(ctx, common_constants.OTPPurposeVerifyPhone, recipient); err != nil {
+		log.Errorf("failed to send OTP: %v", err)
+		return nil, err
+	}
+	if err = s.userRepo.UpdatePhone(user.ID, user.Phone, user.PhoneVerifiedAt, phone); err != nil {
+		log.Errorf("Failed to update phone of user: %d, err: %v", user.ID, err)
+		return nil, err
+	}
+	user.PendingPhone = phone
+	return s.newOTPPreferenceResponse(user), nil
+}
+
+// VerifyPhone confirms the pending phone number of the user with the code texted to it
+func (s *AuthService) VerifyPhone(ctx *gin.Context, userID uint, otp string) (*dto.OTPPreferenceResponse, error) {
+	log := logger.GetLogger(ctx)
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.PendingPhone == "" {
+		return nil, ErrNoPendingPhone
+	}
+	if err = s.otpService.VerifyOTP(ctx, common_constants.OTPPurposeVerifyPhone, user.Email, otp); err != nil {
+		return nil, err
+	}
+
+	verifiedAt := time.Now()
+	if err = s.userRepo.UpdatePhone(user.ID, user.PendingPhone, &verifiedAt, ""); err != nil {
+		log.Errorf("Failed to update phone of user: %d, err: %v", user.ID, err)
+		return nil, err
+	}
+	user.Phone, user.PhoneVerifiedAt, user.PendingPhone = user.PendingPhone, &verifiedAt, ""
+	s.notifyOTPChange(ctx, user, email_service.TemplateData{"Change": "phone_verified", "PhoneLast4": user.Phone[max(len(user.Phone)-4, 0):]})
+	return s.newOTPPreferenceResponse(user), nil
+}
+
+// RemovePhone deletes the phone number of the user. Codes go back to email if they were texted.
+func (s *AuthService) RemovePhone(ctx *gin.Context, userID uint, req *dto.RemovePhoneRequest) (*dto.OTPPreferenceResponse, error) {
+	log := logger.GetLogger(ctx)
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if err = s.reauthenticate(ctx, user, &req.Reauthentication); err != nil {
+		return nil, err
+	}
+	if user.OTPChannel == common_constants.OTPChannelSMS {
+		if err = s.userRepo.UpdateOTPChannel(user.ID, common_constants.OTPChannelEmail, "", ""); err != nil {
+			log.Errorf("Failed to update otp channel of user: %d, err: %v", user.ID, err)
+			return nil, err
+		}
+		user.OTPChannel = common_constants.OTPChannelEmail
+	}
+	if err = s.userRepo.UpdatePhone(user.ID, "", nil, ""); err != nil {
+		log.Errorf("Failed to update phone of user: %d, err: %v", user.ID, err)
+		return nil, err
+	}
+	user.Phone, user.PhoneVerifiedAt, user.PendingPhone = "", nil, ""
+	s.notifyOTPChange(ctx, user, email_service.TemplateData{"Change": "phone_removed"})
+	return s.newOTPPreferenceResponse(user), nil
+}
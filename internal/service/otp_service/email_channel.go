@@ -0,0 +1,48 @@
+package otp_service
+
+import (
+	"context"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/service/email_service"
+)
+
+// EmailChannel emails codes, it is the channel of every user without a preference
+type EmailChannel struct {
+	emailService   email_service.IEmailService
+	emailTemplates *email_service.TemplateRegistry
+}
+
+func NewEmailChannel(emailService email_service.IEmailService, emailTemplates *email_service.TemplateRegistry) *EmailChannel {
+	return &EmailChannel{
+		emailService:   emailService,
+		emailTemplates: emailTemplates,
+	}
+}
+
+func (c *EmailChannel) Name() common_constants.OTPChannel {
+	return common_constants.OTPChannelEmail
+}
+
+func (c *EmailChannel) Validate(recipient *Recipient) error {
+	if recipient.Email == "" {
+		return ErrInvalidDestination
+	}
+	return nil
+}
+
+func (c *EmailChannel) Send(_ context.Context, recipient *Recipient, purpose common_constants.OTPPurpose, otp string) error {
+	template := common_constants.EmailTemplateOTP
+	if purpose == common_constants.OTPPurposeResetPassword {
+		template = common_constants.EmailTemplatePasswordReset
+	}
+	m, err := c.emailTemplates.Message(template, recipient.Locale, recipient.Email, email_service.TemplateData{
+		"OTP":              otp,
+		"Purpose":          string(purpose),
+		"ExpiresInMinutes": int(common_constants.OTPCacheTimeOut.Minutes()),
+	})
+	if err != nil {
+		return err
+	}
+	return c.emailService.SendEmail(m)
+}
@@ -0,0 +1,38 @@
+package otp_service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidOTP         = errors.New("wrong OTP")
+	ErrOTPExpired         = errors.New("OTP expired or not requested")
+	ErrTooManyOTPAttempts = errors.New("too many wrong OTPs, request a new one")
+	ErrOTPCooldown        = errors.New("OTP sent too recently")
+	ErrChannelUnavailable = errors.New("OTP channel is not available")
+	ErrInvalidDestination = errors.New("invalid OTP destination")
+)
+
+// ResendCooldownError is returned when a new code is requested too soon after the previous one.
+// It unwraps to ErrOTPCooldown.
+type ResendCooldownError struct {
+	Until time.Time
+}
+
+func (e *ResendCooldownError) Error() string {
+	return fmt.Sprintf("%v, retry at %s", ErrOTPCooldown, e.Until.Format(time.RFC3339))
+}
+
+func (e *ResendCooldownError) Unwrap() error {
+	return ErrOTPCooldown
+}
+
+// RetryAfter returns how long the caller has to wait before requesting a new code
+func (e *ResendCooldownError) RetryAfter() time.Duration {
+	if retryAfter := time.Until(e.Until); retryAfter > 0 {
+		return retryAfter
+	}
+	return 0
+}
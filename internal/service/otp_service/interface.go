@@ -1,11 +1,43 @@
 package otp_service
 
-import "github.com/gin-gonic/gin"
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
+)
 
 type IOTPService interface {
-	GenerateOTP(email string) string
-	SendOTP(email string, otp string) error
-	SaveOTP(ctx *gin.Context, email string, otp string) error
-	VerifyOTP(ctx *gin.Context, email string, otp string) error
-	DeleteOTP(ctx *gin.Context, email string) error
+	// SendOTP generates a new code for the purpose, replacing the pending one, and delivers it through
+	// the channel of the recipient. It fails with a *ResendCooldownError while the previous code of the
+	// purpose was sent too recently.
+	SendOTP(ctx *gin.Context, purpose common_constants.OTPPurpose, recipient *Recipient) error
+	// VerifyOTP checks a code of the purpose and consumes it when it matches
+	VerifyOTP(ctx *gin.Context, purpose common_constants.OTPPurpose, email string, otp string) error
+	// Channels returns the channels codes can be delivered through
+	Channels() []common_constants.OTPChannel
+	// ValidateRecipient checks that codes can be delivered to the recipient, before it is saved as a preference
+	ValidateRecipient(recipient *Recipient) error
+}
+
+// IOTPChannel delivers codes to one kind of destination
+type IOTPChannel interface {
+	Name() common_constants.OTPChannel
+	Validate(recipient *Recipient) error
+	Send(ctx context.Context, recipient *Recipient, purpose common_constants.OTPPurpose, otp string) error
+}
+
+// Recipient is where a code is delivered. Codes are always keyed by Email, Channel picks the destination.
+type Recipient struct {
+	Email         string
+	Channel       common_constants.OTPChannel
+	Phone         string
+	WebhookURL    string
+	WebhookSecret string
+	Locale        string // language of emailed codes
+}
+
+// EmailRecipient delivers codes to an email address, such as the one of a pending signup
+func EmailRecipient(email string, locale string) *Recipient {
+	return &Recipient{Email: email, Channel: common_constants.OTPChannelEmail, Locale: locale}
 }
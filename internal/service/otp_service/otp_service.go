@@ -0,0 +1,160 @@
+package otp_service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/repository"
+	"math/big"
+	"time"
+)
+
+// OTPService issues codes and delivers them through the channel of their recipient
+type OTPService struct {
+	otpRepo  repository.IOTPRepository
+	hashKey  []byte
+	channels map[common_constants.OTPChannel]IOTPChannel
+}
+
+// NewOTPService returns an OTP service delivering codes through the given channels. Codes are
+// stored as HMACs keyed with hashKey.
+func NewOTPService(otpRepo repository.IOTPRepository, hashKey []byte, channels ...IOTPChannel) IOTPService {
+	service := &OTPService{
+		otpRepo:  otpRepo,
+		hashKey:  hashKey,
+		channels: make(map[common_constants.OTPChannel]IOTPChannel, len(channels)),
+	}
+	for _, channel := range channels {
+		service.channels[channel.Name()] = channel
+	}
+	return service
+}
+
+// Channels returns the channels codes can be delivered through
+func (o *OTPService) Channels() []common_constants.OTPChannel {
+	channels := make([]common_constants.OTPChannel, 0, len(o.channels))
+	for _, name := range []common_constants.OTPChannel{
+		common_constants.OTPChannelEmail, common_constants.OTPChannelSMS, common_constants.OTPChannelWebhook,
+	} {
+		if _, ok := o.channels[name]; ok {
+			channels = append(channels, name)
+		}
+	}
+	return channels
+}
+
+func (o *OTPService) ValidateRecipient(recipient *Recipient) error {
+	channel, ok := o.channels[recipient.Channel]
+	if !ok {
+		return ErrChannelUnavailable
+	}
+	return channel.Validate(recipient)
+}
+
+// generateOTP returns a uniformly random code of OTPDigits digits
+func generateOTP() (string, error) {
+	upperBound := big.NewInt(1)
+	for range common_constants.OTPDigits {
+		upperBound.Mul(upperBound, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, upperBound)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", common_constants.OTPDigits, n), nil
+}
+
+// hashOTP binds a code to its purpose and email, a stored hash is useless without the key
+func (o *OTPService) hashOTP(purpose common_constants.OTPPurpose, email string, otp string) string {
+	mac := hmac.New(sha256.New, o.hashKey)
+	mac.Write([]byte(string(purpose) + ":" + email + ":" + otp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (o *OTPService) SendOTP(ctx *gin.Context, purpose common_constants.OTPPurpose, recipient *Recipient) error {
+	log := logger.GetLogger(ctx)
+	channel, ok := o.channels[recipient.Channel]
+	if !ok {
+		return ErrChannelUnavailable
+	}
+	email := recipient.Email
+	until := time.Now().Add(common_constants.OTPResendCooldown)
+	started, err := o.otpRepo.StartCooldown(ctx, purpose, email, until)
+	if err != nil {
+		log.Errorf("Failed to start otp cooldown of: %s, err: %v", email, err)
+		return err
+	}
+	if !started {
+		cooldownUntil, err := o.otpRepo.CooldownUntil(ctx, purpose, email)
+		if err != nil {
+			log.Errorf("Failed to get otp cooldown of: %s, err: %v", email, err)
+		}
+		if cooldownUntil.IsZero() {
+			cooldownUntil = until
+		}
+		return &ResendCooldownError{Until: cooldownUntil}
+	}
+
+	otp, err := generateOTP()
+	if err != nil {
+		return err
+	}
+	err = o.otpRepo.SaveOTP(ctx, purpose, email, &model.OTP{CodeHash: o.hashOTP(purpose, email, otp), SentAt: time.Now()})
+	if err != nil {
+		log.Errorf("Failed to save OTP: %v", err)
+		return err
+	}
+	if err = channel.Send(ctx, recipient, purpose, otp); err != nil {
+		log.Errorf("Failed to send OTP by %s: %v", recipient.Channel, err)
+		if deleteErr := o.otpRepo.DeleteOTP(ctx, purpose, email); deleteErr != nil {
+			log.Errorf("Failed to delete OTP: %v", deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// VerifyOTP counts every attempt against the pending code, which is invalidated after MaxOTPAttempts wrong guesses
+func (o *OTPService) VerifyOTP(ctx *gin.Context, purpose common_constants.OTPPurpose, email string, otp string) error {
+	log := logger.GetLogger(ctx)
+	pending, err := o.otpRepo.GetOTP(ctx, purpose, email)
+	if errors.Is(err, repository.ErrOTPNotFound) {
+		return ErrOTPExpired
+	}
+	if err != nil {
+		return err
+	}
+	attempts, err := o.otpRepo.IncrementAttempts(ctx, purpose, email)
+	if err != nil {
+		log.Errorf("Failed to count otp attempt of: %s, err: %v", email, err)
+		return err
+	}
+	if attempts > common_constants.MaxOTPAttempts {
+		return ErrTooManyOTPAttempts
+	}
+
+	if !hmac.Equal([]byte(pending.CodeHash), []byte(o.hashOTP(purpose, email, otp))) {
+		if attempts < common_constants.MaxOTPAttempts {
+			return ErrInvalidOTP
+		}
+		log.Warnf("Invalidated %s OTP of: %s after %d wrong attempts", purpose, email, attempts)
+		if err = o.otpRepo.DeleteOTP(ctx, purpose, email); err != nil {
+			log.Errorf("Failed to delete OTP: %v", err)
+		}
+		return ErrTooManyOTPAttempts
+	}
+
+	// A code works once
+	if err = o.otpRepo.DeleteOTP(ctx, purpose, email); err != nil {
+		log.Errorf("Failed to delete OTP: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package otp_service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/pkg/sms"
+)
+
+// SMSChannel texts codes to the verified phone number of the recipient
+type SMSChannel struct {
+	sender sms.Sender
+}
+
+func NewSMSChannel(sender sms.Sender) *SMSChannel {
+	return &SMSChannel{
+		sender: sender,
+	}
+}
+
+func (c *SMSChannel) Name() common_constants.OTPChannel {
+	return common_constants.OTPChannelSMS
+}
+
+func (c *SMSChannel) Validate(recipient *Recipient) error {
+	if recipient.Phone == "" {
+		return ErrInvalidDestination
+	}
+	return nil
+}
+
+func (c *SMSChannel) Send(ctx context.Context, recipient *Recipient, _ common_constants.OTPPurpose, otp string) error {
+	body := fmt.Sprintf("%s is your verification code. It expires in %d minutes. Never share it with anyone.",
+		otp, int(common_constants.OTPCacheTimeOut.Minutes()))
+	return c.sender.Send(ctx, recipient.Phone, body)
+}
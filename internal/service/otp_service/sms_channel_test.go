@@ -0,0 +1,152 @@
+package otp_service
+
+import (
+	"errors"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/repository"
+	"github.com/nikhil/url-shortner-backend/pkg/sms"
+)
+
+// memoryOTPRepository keeps codes in memory, in place of redis
+type memoryOTPRepository struct {
+	mu        sync.Mutex
+	otps      map[string]*model.OTP
+	attempts  map[string]int64
+	cooldowns map[string]time.Time
+}
+
+func newMemoryOTPRepository() *memoryOTPRepository {
+	return &memoryOTPRepository{
+		otps:      make(map[string]*model.OTP),
+		attempts:  make(map[string]int64),
+		cooldowns: make(map[string]time.Time),
+	}
+}
+
+func otpKey(purpose common_constants.OTPPurpose, email string) string {
+	return string(purpose) + ":" + email
+}
+
+func (r *memoryOTPRepository) SaveOTP(_ *gin.Context, purpose common_constants.OTPPurpose, email string, otp *model.OTP) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.otps[otpKey(purpose, email)] = otp
+	delete(r.attempts, otpKey(purpose, email))
+	return nil
+}
+
+func (r *memoryOTPRepository) GetOTP(_ *gin.Context, purpose common_constants.OTPPurpose, email string) (*model.OTP, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	otp, ok := r.otps[otpKey(purpose, email)]
+	if !ok {
+		return nil, repository.ErrOTPNotFound
+	}
+	return otp, nil
+}
+
+func (r *memoryOTPRepository) IncrementAttempts(_ *gin.Context, purpose common_constants.OTPPurpose, email string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts[otpKey(purpose, email)]++
+	return r.attempts[otpKey(purpose, email)], nil
+}
+
+func (r *memoryOTPRepository) DeleteOTP(_ *gin.Context, purpose common_constants.OTPPurpose, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.otps, otpKey(purpose, email))
+	delete(r.attempts, otpKey(purpose, email))
+	return nil
+}
+
+func (r *memoryOTPRepository) StartCooldown(_ *gin.Context, purpose common_constants.OTPPurpose, email string, until time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cooldowns[otpKey(purpose, email)].After(time.Now()) {
+		return false, nil
+	}
+	r.cooldowns[otpKey(purpose, email)] = until
+	return true, nil
+}
+
+func (r *memoryOTPRepository) CooldownUntil(_ *gin.Context, purpose common_constants.OTPPurpose, email string) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cooldowns[otpKey(purpose, email)], nil
+}
+
+var smsCodePattern = regexp.MustCompile(`^(\d{6}) is your verification code`)
+
+func TestSMSChannelDeliversThroughStandIn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	standIn := sms.NewStandIn("secret-token")
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	otpService := NewOTPService(
+		newMemoryOTPRepository(), []byte("hash-key"),
+		NewSMSChannel(sms.NewHTTPProvider(server.URL+"/messages", "secret-token")),
+	)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	recipient := &Recipient{Email: "jane@example.com", Channel: common_constants.OTPChannelSMS, Phone: "+14155550123"}
+
+	if err := otpService.SendOTP(ctx, common_constants.OTPPurposeVerifyPhone, recipient); err != nil {
+		t.Fatalf("SendOTP: %v", err)
+	}
+	messages := standIn.Messages(recipient.Phone)
+	if len(messages) != 1 {
+		t.Fatalf("stand-in received %d messages for %s, want 1", len(messages), recipient.Phone)
+	}
+	match := smsCodePattern.FindStringSubmatch(messages[0].Body)
+	if match == nil {
+		t.Fatalf("no code in sms body %q", messages[0].Body)
+	}
+
+	// The texted code only works for its purpose, and only once
+	if err := otpService.VerifyOTP(ctx, common_constants.OTPPurposeResetPassword, recipient.Email, match[1]); err == nil {
+		t.Fatal("phone verification code accepted for a password reset")
+	}
+	if err := otpService.VerifyOTP(ctx, common_constants.OTPPurposeVerifyPhone, recipient.Email, match[1]); err != nil {
+		t.Fatalf("VerifyOTP with the texted code: %v", err)
+	}
+	if err := otpService.VerifyOTP(ctx, common_constants.OTPPurposeVerifyPhone, recipient.Email, match[1]); !errors.Is(err, ErrOTPExpired) {
+		t.Fatalf("second VerifyOTP = %v, want ErrOTPExpired", err)
+	}
+
+	var cooldownErr *ResendCooldownError
+	if err := otpService.SendOTP(ctx, common_constants.OTPPurposeVerifyPhone, recipient); !errors.As(err, &cooldownErr) {
+		t.Fatalf("immediate resend = %v, want a ResendCooldownError", err)
+	}
+}
+
+func TestSMSChannelRejectedByStandIn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	standIn := sms.NewStandIn("secret-token")
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	repo := newMemoryOTPRepository()
+	otpService := NewOTPService(repo, []byte("hash-key"), NewSMSChannel(sms.NewHTTPProvider(server.URL+"/messages", "wrong-token")))
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	recipient := &Recipient{Email: "jane@example.com", Channel: common_constants.OTPChannelSMS, Phone: "+14155550123"}
+
+	if err := otpService.SendOTP(ctx, common_constants.OTPPurposeVerifyPhone, recipient); err == nil {
+		t.Fatal("SendOTP succeeded with a token the stand-in rejects")
+	}
+	if len(standIn.Messages("")) != 0 {
+		t.Fatal("stand-in stored a message sent with the wrong token")
+	}
+	// A code that wasn't delivered isn't left pending
+	if _, err := repo.GetOTP(ctx, common_constants.OTPPurposeVerifyPhone, recipient.Email); !errors.Is(err, repository.ErrOTPNotFound) {
+		t.Fatalf("GetOTP after a failed delivery = %v, want ErrOTPNotFound", err)
+	}
+}
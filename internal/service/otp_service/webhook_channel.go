@@ -0,0 +1,111 @@
+package otp_service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/nikhil/url-shortner-backend/constants"
+)
+
+var errBlockedAddress = errors.New("webhook address is not allowed")
+
+// webhookPayload is the JSON body posted to OTP webhooks
+type webhookPayload struct {
+	Email     string                      `json:"email"`
+	Purpose   common_constants.OTPPurpose `json:"purpose"`
+	OTP       string                      `json:"otp"`
+	ExpiresAt time.Time                   `json:"expires_at"`
+}
+
+// WebhookChannel posts codes to an HTTPS endpoint of the user, for example a chat or automation
+// tool. Every request is signed with the webhook secret of the user: the X-Signature-256 header
+// holds "sha256=" followed by the hex HMAC-SHA256 of the body.
+type WebhookChannel struct {
+	client               *http.Client
+	allowPrivateNetworks bool
+}
+
+// NewWebhookChannel returns a webhook channel. Webhooks can't reach loopback or private addresses,
+// unless allowPrivateNetworks is set for local development.
+func NewWebhookChannel(allowPrivateNetworks bool) *WebhookChannel {
+	dialer := &net.Dialer{Timeout: common_constants.OTPWebhookTimeout}
+	if !allowPrivateNetworks {
+		// Checked on the resolved address of every connection, so DNS can't point a webhook inside
+		dialer.Control = func(_ string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+				return errBlockedAddress
+			}
+			return nil
+		}
+	}
+	return &WebhookChannel{
+		client: &http.Client{
+			Timeout:   common_constants.OTPWebhookTimeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			// A redirect could point the code anywhere
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		allowPrivateNetworks: allowPrivateNetworks,
+	}
+}
+
+func (c *WebhookChannel) Name() common_constants.OTPChannel {
+	return common_constants.OTPChannelWebhook
+}
+
+func (c *WebhookChannel) Validate(recipient *Recipient) error {
+	webhookURL, err := url.Parse(recipient.WebhookURL)
+	if err != nil || webhookURL.Host == "" || webhookURL.User != nil {
+		return ErrInvalidDestination
+	}
+	if webhookURL.Scheme != "https" && !(c.allowPrivateNetworks && webhookURL.Scheme == "http") {
+		return ErrInvalidDestination
+	}
+	return nil
+}
+
+func (c *WebhookChannel) Send(ctx context.Context, recipient *Recipient, purpose common_constants.OTPPurpose, otp string) error {
+	body, err := json.Marshal(&webhookPayload{
+		Email:     recipient.Email,
+		Purpose:   purpose,
+		OTP:       otp,
+		ExpiresAt: time.Now().Add(common_constants.OTPCacheTimeOut).UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, recipient.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, []byte(recipient.WebhookSecret))
+	mac.Write(body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(common_constants.OTPWebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call otp webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to call otp webhook: it answered %d", resp.StatusCode)
+	}
+	return nil
+}
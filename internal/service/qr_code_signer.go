@@ -0,0 +1,54 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// QRCodeSigner signs the public image URLs of QR codes, which <img> tags can load without
+// credentials. A signature covers the link, the rendering options and the expiry of the URL.
+type QRCodeSigner struct {
+	secret []byte
+}
+
+func NewQRCodeSigner(secret string) *QRCodeSigner {
+	return &QRCodeSigner{secret: []byte(secret)}
+}
+
+// Sign returns the query of an image URL of the link, rendered with options, valid until expiresAt
+func (s *QRCodeSigner) Sign(urlID uint, options url.Values, expiresAt time.Time) url.Values {
+	query := url.Values{}
+	for key, values := range options {
+		query[key] = values
+	}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", s.mac(urlID, query))
+	return query
+}
+
+// Verify tells whether the query of an image URL was signed by us for the link and hasn't expired
+func (s *QRCodeSigner) Verify(urlID uint, query url.Values) bool {
+	expiresAt, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() >= expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(query.Get("signature")), []byte(s.mac(urlID, query)))
+}
+
+// mac covers every query parameter but the signature, so that no option can be added or changed
+func (s *QRCodeSigner) mac(urlID uint, query url.Values) string {
+	signed := url.Values{}
+	for key, values := range query {
+		if key != "signature" {
+			signed[key] = values
+		}
+	}
+	h := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(h, "qr:%d:%s", urlID, signed.Encode())
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
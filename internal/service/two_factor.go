@@ -0,0 +1,387 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/dto"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/utils"
+	"github.com/nikhil/url-shortner-backend/pkg/token"
+	"github.com/nikhil/url-shortner-backend/pkg/totp"
+)
+
+var (
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrInvalidChallenge        = errors.New("invalid or expired two-factor challenge")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled    = errors.New("two-factor enrollment hasn't been started")
+	ErrTwoFactorRequired       = errors.New("two-factor authentication is required for your role")
+)
+
+func getTwoFactorChallengeUsedKey(tokenID string) string {
+	return "two_factor_challenge_used:" + tokenID
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeRecoveryCode drops the dash and spaces people type along with recovery codes
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// twoFactorRequired reports whether the policy of the role requires two-factor authentication
+func (s *AuthService) twoFactorRequired(role common_constants.UserRole) (bool, error) {
+	policy, err := s.rolePolicyRepo.FindByRole(role)
+	if err != nil {
+		return false, err
+	}
+	return policy.RequireTwoFactor, nil
+}
+
+// newTwoFactorChallenge answers a correct password of a user who needs a second factor: the
+// challenge token can only be exchanged for a session together with a code.
+func (s *AuthService) newTwoFactorChallenge(user *model.User) (*dto.LoginResponse, error) {
+	challengeToken, _, err := s.createToken(user.ID, "", token.TokenUseTwoFactor, common_constants.TwoFactorChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.LoginResponse{
+		ChallengeToken:         challengeToken,
+		TwoFactorSetupRequired: !user.TwoFactorEnabled(),
+	}, nil
+}
+
+// parseTwoFactorChallenge verifies a challenge token that hasn't been used yet and returns its user
+func (s *AuthService) parseTwoFactorChallenge(ctx *gin.Context, challengeToken string) (*token.Claims, *model.User, error) {
+	log := logger.GetLogger(ctx)
+	claims, err := s.tokenIssuer.Verify(challengeToken)
+	if err != nil || claims.TokenUse != token.TokenUseTwoFactor || claims.ID == "" {
+		return nil, nil, ErrInvalidChallenge
+	}
+	usedUntil, err := s.rateLimitRepo.LockedUntil(ctx, getTwoFactorChallengeUsedKey(claims.ID))
+	if err != nil {
+		log.Errorf("Failed to check two-factor challenge: %s, err: %v", claims.ID, err)
+		return nil, nil, err
+	}
+	if usedUntil.After(time.Now()) {
+		return nil, nil, ErrInvalidChallenge
+	}
+	user, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidChallenge
+	}
+	if user.DisabledAt != nil {
+		return nil, nil, ErrAccountDisabled
+	}
+	return claims, user, nil
+}
+
+// EnrollTwoFactorChallenge starts the enrollment of a user whose role requires two-factor
+// authentication, from the challenge of their login
+func (s *AuthService) EnrollTwoFactorChallenge(ctx *gin.Context, challengeToken string) (*dto.TwoFactorEnrollmentResponse, error) {
+	_, user, err := s.parseTwoFactorChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	return s.startEnrollment(ctx, user)
+}
+
+// LoginTwoFactor completes a login with the code of the user's authenticator or one of their
+// recovery codes. Users enrolling from their login confirm the enrollment with it and get their
+// recovery codes along with the tokens.
+func (s *AuthService) LoginTwoFactor(ctx *gin.Context, challengeToken string, code string, deviceName string) (*dto.LoginResponse, error) {
+	log := logger.GetLogger(ctx)
+	claims, user, err := s.parseTwoFactorChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var recoveryCodes []string
+	if user.TwoFactorEnabled() {
+		err = s.checkCode(ctx, user, func() error { return s.verifySecondFactor(ctx, user, code) })
+	} else {
+		err = s.checkCode(ctx, user, func() error {
+			recoveryCodes, err = s.confirmEnrollment(ctx, user, code)
+			return err
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A challenge gives one session, replaying it would skip the second factor
+	if err = s.rateLimitRepo.Lock(ctx, getTwoFactorChallengeUsedKey(claims.ID), time.Unix(claims.ExpiresAt, 0)); err != nil {
+		log.Errorf("Failed to mark two-factor challenge: %s as used, err: %v", claims.ID, err)
+		return nil, err
+	}
+	response, err := s.startSession(ctx, user, deviceName)
+	if err != nil {
+		return nil, err
+	}
+	response.RecoveryCodes = recoveryCodes
+	return response, nil
+}
+
+// checkCode runs a check of a second factor under the login lockout, wrong codes count as failed logins
+func (s *AuthService) checkCode(ctx *gin.Context, user *model.User, check func() error) error {
+	if err := s.checkLoginThrottle(ctx, user); err != nil {
+		return err
+	}
+	err := check()
+	if err == nil {
+		s.clearLoginFailures(ctx, user.ID)
+		return nil
+	}
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		return err
+	}
+	if throttleErr := s.recordLoginFailure(ctx, user); !errors.Is(throttleErr, ErrInvalidCredentials) {
+		return throttleErr
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+// startEnrollment generates a new pending TOTP secret for the user, replacing any previous pending one
+func (s *AuthService) startEnrollment(ctx *gin.Context, user *model.User) (*dto.TwoFactorEnrollmentResponse, error) {
+	log := logger.GetLogger(ctx)
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	encryptedSecret, err := utils.Encrypt(s.encryptionKey, []byte(secret))
+	if err != nil {
+		log.Errorf("Failed to encrypt totp secret of user: %d, err: %v", user.ID, err)
+		return nil, err
+	}
+	if err = s.userRepo.UpdateTOTP(user.ID, encryptedSecret, nil); err != nil {
+		log.Errorf("Failed to save totp secret of user: %d, err: %v", user.ID, err)
+		return nil, err
+	}
+
+	otpAuthURL := totp.URI(s.totpIssuer, user.Email, secret)
+	opts, err := newQRCodeOptions(&dto.QRCodeRequest{})
+	if err != nil {
+		return nil, err
+	}
+	qrCode, err := utils.RenderQRCode(otpAuthURL, opts)
+	if err != nil {
+		log.Errorf("Failed to render totp qr code of user: %d, err: %v", user.ID, err)
+		return nil, err
+	}
+	return &dto.TwoFactorEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURL: otpAuthURL,
+		QRCode:     fmt.Sprintf("data:%s;base64,%s", qrCode.ContentType, base64.StdEncoding.EncodeToString(qrCode.Data)),
+	}, nil
+}
+
+// confirmEnrollment enables the pending secret of the user with a code from their authenticator
+// and returns their first recovery codes
+func (s *AuthService) confirmEnrollment(ctx *gin.Context, user *model.User, code string) ([]string, error) {
+	log := logger.GetLogger(ctx)
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if err := s.verifyTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+	recoveryCodes, err := s.generateRecoveryCodes(user.ID)
+	if err != nil {
+		log.Errorf("Failed to generate recovery codes of user: %d, err: %v", user.ID, err)
+		return nil, err
+	}
+	now := time.Now()
+	if err = s.userRepo.UpdateTOTP(user.ID, user.TOTPSecret, &now); err != nil {
+		log.Errorf("Failed to enable totp of user: %d, err: %v", user.ID, err)
+		return nil, err
+	}
+	user.TOTPEnabledAt = &now
+	log.Infof("Enabled two-factor authentication of user: %d", user.ID)
+	return recoveryCodes, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code
+func (s *AuthService) verifySecondFactor(ctx *gin.Context, user *model.User, code string) error {
+	log := logger.GetLogger(ctx)
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits && strings.Trim(code, "0123456789") == "" {
+		return s.verifyTOTP(ctx, user, code)
+	}
+
+	used, err := s.recoveryCodeRepo.Use(user.ID, hashRecoveryCode(code), time.Now())
+	if err != nil {
+		log.Errorf("Failed to use recovery code of user: %d, err: %v", user.ID, err)
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	log.Warnf("User: %d logged in with a recovery code", user.ID)
+	return nil
+}
+
+// verifyTOTP checks a code of the user's authenticator. Every code is accepted once.
+func (s *AuthService) verifyTOTP(ctx *gin.Context, user *model.User, code string) error {
+	log := logger.GetLogger(ctx)
+	secret, err := utils.Decrypt(s.encryptionKey, user.TOTPSecret)
+	if err != nil {
+		log.Errorf("Failed to decrypt totp secret of user: %d, err: %v", user.ID, err)
+		return err
+	}
+	step, ok := totp.Validate(string(secret), strings.TrimSpace(code), time.Now(), common_constants.TOTPAllowedSkew)
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	advanced, err := s.userRepo.AdvanceTOTPStep(user.ID, step)
+	if err != nil {
+		log.Errorf("Failed to record totp step of user: %d, err: %v", user.ID, err)
+		return err
+	}
+	if !advanced {
+		log.Warnf("Replayed totp code of user: %d", user.ID)
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// generateRecoveryCodes replaces the recovery codes of the user, the codes are only returned here
+func (s *AuthService) generateRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, 0, common_constants.RecoveryCodeCount)
+	codeHashes := make([]string, 0, common_constants.RecoveryCodeCount)
+	for range common_constants.RecoveryCodeCount {
+		code, err := utils.GenerateRandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+		codeHashes = append(codeHashes, hashRecoveryCode(code))
+	}
+	if err := s.recoveryCodeRepo.Replace(userID, codeHashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *AuthService) GetTwoFactorStatus(ctx *gin.Context, userID uint) (*dto.TwoFactorStatusResponse, error) {
+	log := logger.GetLogger(ctx)
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		log.Errorf("GetTwoFactorStatus err: %v", err)
+		return nil, err
+	}
+	required, err := s.twoFactorRequired(user.UserRole)
+	if err != nil {
+		log.Errorf("Failed to get policy of role: %s, err: %v", user.UserRole, err)
+		return nil, err
+	}
+	status := &dto.TwoFactorStatusResponse{
+		Enabled:   user.TwoFactorEnabled(),
+		EnabledAt: user.TOTPEnabledAt,
+		Required:  required,
+	}
+	if status.Enabled {
+		if status.RecoveryCodesLeft, err = s.recoveryCodeRepo.CountUnused(userID); err != nil {
+			log.Errorf("Failed to count recovery codes of user: %d, err: %v", userID, err)
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// EnrollTwoFactor starts the enrollment of a logged in user. It is enabled once confirmed with a code.
+func (s *AuthService) EnrollTwoFactor(ctx *gin.Context, userID uint) (*dto.TwoFactorEnrollmentResponse, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	return s.startEnrollment(ctx, user)
+}
+
+// ConfirmTwoFactor enables two-factor authentication with a code of the enrolled authenticator
+func (s *AuthService) ConfirmTwoFactor(ctx *gin.Context, userID uint, code string) ([]string, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	var recoveryCodes []string
+	err = s.checkCode(ctx, user, func() error {
+		recoveryCodes, err = s.confirmEnrollment(ctx, user, code)
+		return err
+	})
+	return recoveryCodes, err
+}
+
+// DisableTwoFactor turns two-factor authentication off, unless the role of the user requires it
+func (s *AuthService) DisableTwoFactor(ctx *gin.Context, userID uint, code string) error {
+	log := logger.GetLogger(ctx)
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled() {
+		return ErrTwoFactorNotEnabled
+	}
+	required, err := s.twoFactorRequired(user.UserRole)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorRequired
+	}
+	if err = s.checkCode(ctx, user, func() error { return s.verifySecondFactor(ctx, user, code) }); err != nil {
+		return err
+	}
+
+	if err = s.userRepo.UpdateTOTP(user.ID, "", nil); err != nil {
+		log.Errorf("Failed to disable totp of user: %d, err: %v", user.ID, err)
+		return err
+	}
+	if err = s.recoveryCodeRepo.DeleteByUserID(user.ID); err != nil {
+		log.Errorf("Failed to delete recovery codes of user: %d, err: %v", user.ID, err)
+	}
+	log.Infof("Disabled two-factor authentication of user: %d", user.ID)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, invalidating the previous ones
+func (s *AuthService) RegenerateRecoveryCodes(ctx *gin.Context, userID uint, code string) ([]string, error) {
+	log := logger.GetLogger(ctx)
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if err = s.checkCode(ctx, user, func() error { return s.verifySecondFactor(ctx, user, code) }); err != nil {
+		return nil, err
+	}
+	recoveryCodes, err := s.generateRecoveryCodes(user.ID)
+	if err != nil {
+		log.Errorf("Failed to generate recovery codes of user: %d, err: %v", user.ID, err)
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
@@ -2,137 +2,860 @@
 package service
 
 import (
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
 	"github.com/nikhil/url-shortner-backend/internal/dto"
 	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
 	"github.com/nikhil/url-shortner-backend/internal/model"
 	"github.com/nikhil/url-shortner-backend/internal/repository"
 	"github.com/nikhil/url-shortner-backend/internal/utils"
-	"github.com/skip2/go-qrcode"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"net"
+	neturl "net/url"
+	"strings"
 	"time"
 )
 
+var (
+	ErrURLNotFound           = errors.New("url not found")
+	ErrInvalidDateRange      = errors.New("from must be before to")
+	ErrAliasAlreadyExists    = errors.New("alias already exists")
+	ErrInvalidCursor         = errors.New("invalid cursor")
+	ErrInvalidQRCodeOptions  = errors.New("invalid QR code options")
+	ErrInvalidQRCodeURL      = errors.New("invalid or expired QR code image URL")
+	ErrURLExpired            = errors.New("url has expired")
+	ErrURLDisabled           = errors.New("url has been disabled")
+	ErrIncorrectURLPassword  = errors.New("incorrect password")
+	ErrTooManyUnlockAttempts = errors.New("too many unlock attempts")
+	ErrInvalidExpiry         = errors.New("expiry must be in the future, and expires_days and expires_at can't be combined")
+	ErrInvalidLongURL        = errors.New("long_url must be an http or https URL")
+)
+
+const (
+	defaultStatsBucket     = "day"
+	defaultStatsTopLimit   = 10
+	defaultStatsWindowDays = 30
+	defaultURLPageSize     = 20
+)
+
 type URLService struct {
-	urlRepo *repository.URLRepository
+	urlRepo        *repository.URLRepository
+	clickEventRepo *repository.ClickEventRepository
+	clickTracker   *ClickTracker
+	aliasPolicy    *AliasPolicy
+	domainService  *DomainService
+	rateLimitRepo  *repository.RateLimitRepository
+	linkAccess     *LinkAccess
+	qrCodeSigner   *QRCodeSigner
+	publicBaseURL  string
 }
 
-func NewURLService(urlRepo *repository.URLRepository) *URLService {
+func NewURLService(
+	urlRepo *repository.URLRepository,
+	clickEventRepo *repository.ClickEventRepository,
+	clickTracker *ClickTracker,
+	aliasPolicy *AliasPolicy,
+	domainService *DomainService,
+	rateLimitRepo *repository.RateLimitRepository,
+	linkAccess *LinkAccess,
+	qrCodeSigner *QRCodeSigner,
+	publicBaseURL string,
+) *URLService {
 	return &URLService{
-		urlRepo: urlRepo,
+		urlRepo:        urlRepo,
+		clickEventRepo: clickEventRepo,
+		clickTracker:   clickTracker,
+		aliasPolicy:    aliasPolicy,
+		domainService:  domainService,
+		rateLimitRepo:  rateLimitRepo,
+		linkAccess:     linkAccess,
+		qrCodeSigner:   qrCodeSigner,
+		publicBaseURL:  strings.TrimSuffix(publicBaseURL, "/"),
 	}
 }
 
-func (s *URLService) CreateShortURL(ctx *gin.Context, userID uint, req *dto.CreateShortURLRequest) (*model.URL, error) {
+// CreateShortURL creates a link in a workspace. Custom domains have to belong to the creator.
+func (s *URLService) CreateShortURL(ctx *gin.Context, userID uint, workspaceID uint, req *dto.CreateShortURLRequest) (*model.URL, error) {
 	log := logger.GetLogger(ctx)
-	var expiresAt *time.Time
-	t := time.Now().AddDate(0, 0, req.ExpiresDays)
-	expiresAt = &t
-	var err error
-	if req.Alias == "" {
-		req.Alias, err = utils.GenerateShortCode()
+	url, err := s.newURL(ctx, userID, workspaceID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.urlRepo.Create(url)
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, fmt.Errorf("%w: %s", ErrAliasAlreadyExists, url.ShortCode)
+	}
+	if err != nil {
+		log.Errorf("CreateShortURL err: %v", err)
+		return nil, err
+	}
+	s.invalidateCachedURL(ctx, url.DomainID, url.ShortCode)
+
+	if err = s.setShortURLs(url); err != nil {
+		log.Errorf("CreateShortURL short url err: %v", err)
+		return nil, err
+	}
+	return url, nil
+}
+
+func (s *URLService) CreateShortURLs(
+	ctx *gin.Context, userID uint, workspaceID uint, createBulkShortURLsRequest []dto.CreateShortURLRequest,
+) ([]*model.URL, error) {
+	log := logger.GetLogger(ctx)
+	var urls []*model.URL
+	seenShortCodes := make(map[string]struct{}, len(createBulkShortURLsRequest))
+	for i := range createBulkShortURLsRequest {
+		url, err := s.newURL(ctx, userID, workspaceID, &createBulkShortURLsRequest[i])
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("%d:%s", url.DomainID, url.ShortCode)
+		if _, seen := seenShortCodes[key]; seen {
+			return nil, fmt.Errorf("%w: %s", ErrAliasAlreadyExists, url.ShortCode)
+		}
+		seenShortCodes[key] = struct{}{}
+		urls = append(urls, url)
+	}
+	err := s.urlRepo.CreateBulk(urls)
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, ErrAliasAlreadyExists
+	}
+	if err != nil {
+		log.Errorf("CreateShortURLs err: %v", err)
+		return nil, err
+	}
+	for _, url := range urls {
+		s.invalidateCachedURL(ctx, url.DomainID, url.ShortCode)
+	}
+	if err = s.setShortURLs(urls...); err != nil {
+		log.Errorf("CreateShortURLs short url err: %v", err)
+		return nil, err
 	}
+	return urls, nil
+}
 
+// newURL builds (without saving) the URL described by a create request
+func (s *URLService) newURL(ctx *gin.Context, userID uint, workspaceID uint, req *dto.CreateShortURLRequest) (*model.URL, error) {
+	log := logger.GetLogger(ctx)
+	if _, err := utils.ParseHTTPURL(req.LongURL); err != nil {
+		return nil, ErrInvalidLongURL
+	}
+	expiresAt, err := newExpiresAt(req.ExpiresDays, req.ExpiresAt)
 	if err != nil {
 		return nil, err
 	}
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	var maxClicks *int64
+	if req.MaxClicks > 0 {
+		maxClicks = &req.MaxClicks
+	}
+	redirectType := common_constants.DefaultRedirectType
+	if req.RedirectType != "" {
+		redirectType = common_constants.RedirectType(req.RedirectType)
+	}
+
+	domainID, err := s.domainService.GetUserDomainID(userID, req.Domain, true)
+	if err != nil {
+		return nil, err
+	}
+
+	shortCode, err := s.claimShortCode(ctx, domainID, req.Alias)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := hashURLPassword(req.Password)
 	if err != nil {
 		log.Errorf("Failed to hash password: %v", err)
 		return nil, err
 	}
 
-	url := &model.URL{
-		UserID:    userID,
-		LongURL:   req.LongURL,
-		ExpiresAt: expiresAt,
-		ShortCode: req.Alias,
-		Password:  string(hashedPassword),
+	return &model.URL{
+		UserID:         userID,
+		WorkspaceID:    workspaceID,
+		LongURL:        req.LongURL,
+		ExpiresAt:      expiresAt,
+		MaxClicks:      maxClicks,
+		NotifyOnExpiry: req.NotifyOnExpiry,
+		RedirectType:   redirectType,
+		DomainID:       domainID,
+		ShortCode:      shortCode,
+		Password:       hashedPassword,
+		IsProtected:    req.Password != "",
+	}, nil
+}
+
+// newExpiresAt turns a relative (days from now) or absolute expiry into a timestamp, nil meaning never
+func newExpiresAt(expiresDays int, expiresAt *time.Time) (*time.Time, error) {
+	if expiresDays != 0 && expiresAt != nil {
+		return nil, ErrInvalidExpiry
+	}
+	if expiresDays != 0 {
+		t := time.Now().AddDate(0, 0, expiresDays)
+		return &t, nil
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+	return expiresAt, nil
+}
+
+// claimShortCode validates a custom alias, or generates a short code when none is given.
+// Short codes are unique per domain, and the unique index remains the final word when two
+// requests race for the same alias.
+func (s *URLService) claimShortCode(ctx *gin.Context, domainID uint, alias string) (string, error) {
+	log := logger.GetLogger(ctx)
+	if alias != "" {
+		if err := s.checkAliasAvailability(ctx, domainID, alias); err != nil {
+			return "", err
+		}
+		return alias, nil
 	}
 
-	err = s.urlRepo.Create(url)
+	for attempt := 0; attempt < common_constants.MaxShortCodeGenerationAttempts; attempt++ {
+		shortCode, err := utils.GenerateShortCode()
+		if err != nil {
+			return "", err
+		}
+		exists, err := s.urlRepo.ExistsShortCode(domainID, shortCode)
+		if err != nil {
+			log.Errorf("Failed to check short code: %s, err: %v", shortCode, err)
+			return "", err
+		}
+		if !exists {
+			return shortCode, nil
+		}
+	}
+	return "", errors.New("failed to generate a unique short code")
+}
+
+// CheckAliasAvailability returns nil when the alias is valid and nobody has claimed it yet on the
+// given domain of the user (the main host when empty)
+func (s *URLService) CheckAliasAvailability(ctx *gin.Context, userID uint, domain string, alias string) error {
+	domainID, err := s.domainService.GetUserDomainID(userID, domain, false)
+	if err != nil {
+		return err
+	}
+	return s.checkAliasAvailability(ctx, domainID, alias)
+}
+
+func (s *URLService) checkAliasAvailability(ctx *gin.Context, domainID uint, alias string) error {
+	log := logger.GetLogger(ctx)
+	if err := s.aliasPolicy.Validate(alias); err != nil {
+		return err
+	}
+	exists, err := s.urlRepo.ExistsShortCode(domainID, alias)
+	if err != nil {
+		log.Errorf("Failed to check alias: %s, err: %v", alias, err)
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w: %s", ErrAliasAlreadyExists, alias)
+	}
+	return nil
+}
+
+// hashURLPassword hashes the password of a protected link. Unprotected links store no password at all.
+func hashURLPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+// GetLongURL resolves a short code on the domain serving the request host
+func (s *URLService) GetLongURL(ctx *gin.Context, host string, shortCode string) (*dto.RedirectURL, error) {
+	domainID := s.domainService.ResolveHostDomainID(ctx, host)
+	url, err := s.resolveShortCode(ctx, domainID, shortCode)
 	if err != nil {
-		log.Errorf("CreateShortURL err: %v", err)
 		return nil, err
 	}
 
+	if url.DisabledAt != nil {
+		return nil, ErrURLDisabled
+	}
+	if s.isExpired(url) {
+		return nil, ErrURLExpired
+	}
+
 	return url, nil
 }
 
-func (s *URLService) CreateShortURLs(
-	ctx *gin.Context, userID uint, createBulkShortURLsRequest []dto.CreateShortURLRequest,
-) ([]*model.URL, error) {
+// UnlockURL checks the password of a protected link and returns an access token for it. Wrong
+// guesses are throttled per link and client IP. Unprotected links are returned without a token.
+func (s *URLService) UnlockURL(ctx *gin.Context, host string, shortCode string, password string) (*dto.RedirectURL, string, error) {
 	log := logger.GetLogger(ctx)
-	var urls []*model.URL
-	for _, request := range createBulkShortURLsRequest {
-		var expiresAt *time.Time
-		t := time.Now().AddDate(0, 0, request.ExpiresDays)
-		expiresAt = &t
-		var err error
-		if request.Alias == "" {
-			request.Alias, err = utils.GenerateShortCode()
+	url, err := s.GetLongURL(ctx, host, shortCode)
+	if err != nil {
+		return nil, "", err
+	}
+	if !url.IsProtected {
+		return url, "", nil
+	}
+
+	// Every attempt is counted before the password is checked, so that parallel guesses can't
+	// all get in under the limit
+	attemptsKey := fmt.Sprintf("unlock_attempts:%d:%s", url.ID, ctx.ClientIP())
+	attempts, err := s.rateLimitRepo.Increment(ctx, attemptsKey, common_constants.UnlockAttemptWindow)
+	if err != nil {
+		log.Errorf("Failed to count unlock attempt: %s, err: %v", attemptsKey, err)
+	}
+	if attempts > common_constants.MaxUnlockAttempts {
+		return nil, "", ErrTooManyUnlockAttempts
+	}
+	// The redirect cache doesn't hold password hashes, so the hash is read from postgres
+	protectedURL, err := s.urlRepo.FindByID(url.ID)
+	if err != nil {
+		log.Errorf("Failed to get url: %d, err: %v", url.ID, err)
+		return nil, "", err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(protectedURL.Password), []byte(password)) != nil {
+		return nil, "", ErrIncorrectURLPassword
+	}
+	if err = s.rateLimitRepo.Reset(ctx, attemptsKey); err != nil {
+		log.Errorf("Failed to reset unlock attempts: %s, err: %v", attemptsKey, err)
+	}
+	return url, s.linkAccess.Sign(url, time.Now().Add(common_constants.LinkAccessTTL)), nil
+}
+
+// HasLinkAccess tells whether the access token of a visitor lets them through a protected link
+func (s *URLService) HasLinkAccess(url *dto.RedirectURL, token string) bool {
+	return token != "" && s.linkAccess.Verify(url, token)
+}
+
+// isExpired tells whether a link is past its expiry date or click limit. Clicks that the
+// click tracker hasn't flushed yet count towards the limit.
+func (s *URLService) isExpired(url *dto.RedirectURL) bool {
+	if url.ExpiredAt != nil {
+		return true
+	}
+	if url.ExpiresAt != nil && !time.Now().Before(*url.ExpiresAt) {
+		return true
+	}
+	return url.MaxClicks != nil && url.Clicks+s.clickTracker.Pending(url.ID) >= *url.MaxClicks
+}
+
+// resolveShortCode is a read-through cache over URLRepository.FindByShortCode. Unknown short
+// codes are cached too, so that scanning random codes doesn't reach postgres.
+func (s *URLService) resolveShortCode(ctx *gin.Context, domainID uint, shortCode string) (*dto.RedirectURL, error) {
+	log := logger.GetLogger(ctx)
+	url, err := s.urlRepo.GetURLFromCache(ctx, domainID, shortCode)
+	if err == nil {
+		return url, nil
+	}
+	if errors.Is(err, repository.ErrURLCachedAsNotFound) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	storedURL, err := s.urlRepo.FindByShortCode(domainID, shortCode)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if cacheErr := s.urlRepo.SaveURLNotFoundToCache(ctx, domainID, shortCode); cacheErr != nil {
+			log.Errorf("Failed to cache unknown short code: %s, err: %v", shortCode, cacheErr)
 		}
-		if err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	url = dto.NewRedirectURL(storedURL)
+	if cacheErr := s.urlRepo.SaveURLToCache(ctx, url); cacheErr != nil {
+		log.Errorf("Failed to cache short code: %s, err: %v", shortCode, cacheErr)
+	}
+	return url, nil
+}
+
+// invalidateCachedURL drops the cached entry (positive or negative) of a short code
+func (s *URLService) invalidateCachedURL(ctx *gin.Context, domainID uint, shortCode string) {
+	log := logger.GetLogger(ctx)
+	if err := s.urlRepo.DeleteURLFromCache(ctx, domainID, shortCode); err != nil {
+		log.Errorf("Failed to invalidate cached short code: %s, err: %v", shortCode, err)
+	}
+}
+
+// RecordClick hands the click of a redirect over to the click tracker, which counts it
+// and stores its analytics event asynchronously.
+func (s *URLService) RecordClick(ctx *gin.Context, url *dto.RedirectURL) {
+	s.clickTracker.Track(newClickEvent(ctx, url))
+}
+
+func newClickEvent(ctx *gin.Context, url *dto.RedirectURL) *model.ClickEvent {
+	referrer := ctx.Request.Referer()
+	var referrerHost string
+	if parsed, err := neturl.Parse(referrer); err == nil {
+		referrerHost = strings.ToLower(parsed.Hostname())
+	}
+
+	ipAddress := ctx.ClientIP()
+	ipVersion := 0
+	if ip := net.ParseIP(ipAddress); ip != nil {
+		ipVersion = 6
+		if ip.To4() != nil {
+			ipVersion = 4
+		}
+	}
+
+	// Country is resolved from the client IP by the CDN / load balancer in front of us
+	country := ctx.GetHeader("CF-IPCountry")
+	if country == "" {
+		country = ctx.GetHeader("X-Country-Code")
+	}
+	if len(country) != 2 {
+		country = ""
+	}
+
+	return &model.ClickEvent{
+		URLID:        url.ID,
+		ShortCode:    url.ShortCode,
+		Referrer:     referrer,
+		ReferrerHost: referrerHost,
+		UserAgent:    ctx.Request.UserAgent(),
+		IPAddress:    ipAddress,
+		IPVersion:    ipVersion,
+		Country:      strings.ToUpper(country),
+		ClickedAt:    time.Now(),
+	}
+}
+
+func (s *URLService) GetURLStats(
+	ctx *gin.Context, workspaceID uint, domain string, shortCode string, req *dto.URLStatsRequest,
+) (*dto.URLStatsResponse, error) {
+	log := logger.GetLogger(ctx)
+	url, err := s.findWorkspaceURL(ctx, workspaceID, domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.setShortURLs(url); err != nil {
+		log.Errorf("GetURLStats short url err: %v", err)
+		return nil, err
+	}
+
+	if req.Bucket == "" {
+		req.Bucket = defaultStatsBucket
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultStatsTopLimit
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if req.From.IsZero() {
+		req.From = req.To.AddDate(0, 0, -defaultStatsWindowDays)
+	}
+	if !req.From.Before(req.To) {
+		return nil, ErrInvalidDateRange
+	}
+
+	clicks, err := s.clickEventRepo.CountByBucket(url.ID, req.Bucket, req.From, req.To)
+	if err != nil {
+		log.Errorf("GetURLStats count by bucket err: %v", err)
+		return nil, err
+	}
+	total, err := s.clickEventRepo.CountTotal(url.ID, req.From, req.To)
+	if err != nil {
+		log.Errorf("GetURLStats count total err: %v", err)
+		return nil, err
+	}
+	topReferrers, err := s.clickEventRepo.TopReferrers(url.ID, req.From, req.To, req.Limit)
+	if err != nil {
+		log.Errorf("GetURLStats top referrers err: %v", err)
+		return nil, err
+	}
+	topUserAgents, err := s.clickEventRepo.TopUserAgents(url.ID, req.From, req.To, req.Limit)
+	if err != nil {
+		log.Errorf("GetURLStats top user agents err: %v", err)
+		return nil, err
+	}
+
+	return &dto.URLStatsResponse{
+		ShortCode:     url.ShortCode,
+		ShortURL:      url.ShortURL,
+		TotalClicks:   total,
+		Bucket:        req.Bucket,
+		From:          req.From,
+		To:            req.To,
+		Clicks:        clicks,
+		TopReferrers:  topReferrers,
+		TopUserAgents: topUserAgents,
+	}, nil
+}
+
+// GetWorkspaceURL returns a URL of the workspace on a verified domain (the main host when empty).
+// URLs of other workspaces are reported as not found.
+func (s *URLService) GetWorkspaceURL(ctx *gin.Context, workspaceID uint, domain string, shortCode string) (*model.URL, error) {
+	log := logger.GetLogger(ctx)
+	url, err := s.findWorkspaceURL(ctx, workspaceID, domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.setShortURLs(url); err != nil {
+		log.Errorf("GetWorkspaceURL short url err: %v", err)
+		return nil, err
+	}
+	return url, nil
+}
+
+func (s *URLService) findWorkspaceURL(ctx *gin.Context, workspaceID uint, domain string, shortCode string) (*model.URL, error) {
+	log := logger.GetLogger(ctx)
+	domainID, err := s.domainService.GetVerifiedDomainID(domain)
+	if errors.Is(err, ErrDomainNotFound) {
+		return nil, ErrURLNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	url, err := s.urlRepo.FindByShortCode(domainID, shortCode)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrURLNotFound
+	}
+	if err != nil {
+		log.Errorf("GetWorkspaceURL err: %v", err)
+		return nil, err
+	}
+	if url.WorkspaceID != workspaceID {
+		return nil, ErrURLNotFound
+	}
+	return url, nil
+}
+
+func (s *URLService) UpdateShortURL(
+	ctx *gin.Context, workspaceID uint, domain string, shortCode string, req *dto.UpdateShortURLRequest,
+) (*model.URL, error) {
+	log := logger.GetLogger(ctx)
+	url, err := s.findWorkspaceURL(ctx, workspaceID, domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.LongURL != nil {
+		if _, err = utils.ParseHTTPURL(*req.LongURL); err != nil {
+			return nil, ErrInvalidLongURL
+		}
+		url.LongURL = *req.LongURL
+	}
+	if req.RemoveExpiry {
+		url.ExpiresAt = nil
+	}
+	if req.ExpiresDays != nil || req.ExpiresAt != nil {
+		expiresDays := 0
+		if req.ExpiresDays != nil {
+			expiresDays = *req.ExpiresDays
+		}
+		if url.ExpiresAt, err = newExpiresAt(expiresDays, req.ExpiresAt); err != nil {
 			return nil, err
 		}
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	}
+	if req.RemoveMaxClicks {
+		url.MaxClicks = nil
+	}
+	if req.MaxClicks != nil {
+		url.MaxClicks = req.MaxClicks
+	}
+	if req.NotifyOnExpiry != nil {
+		url.NotifyOnExpiry = *req.NotifyOnExpiry
+	}
+	if req.RedirectType != nil {
+		url.RedirectType = common_constants.RedirectType(*req.RedirectType)
+	}
+	// Pushing back the expiry or raising the click limit of an expired link brings it back to life
+	if expiredAt := url.ExpiredAt; expiredAt != nil {
+		url.ExpiredAt = nil
+		if s.isExpired(dto.NewRedirectURL(url)) {
+			url.ExpiredAt = expiredAt
+		}
+	}
+	if req.RemovePassword {
+		req.Password = new(string)
+	}
+	if req.Password != nil {
+		hashedPassword, err := hashURLPassword(*req.Password)
 		if err != nil {
 			log.Errorf("Failed to hash password: %v", err)
 			return nil, err
 		}
-		urls = append(urls, &model.URL{
-			UserID:    userID,
-			LongURL:   request.LongURL,
-			ExpiresAt: expiresAt,
-			ShortCode: request.Alias,
-			Password:  string(hashedPassword),
-		})
+		url.Password = hashedPassword
+		url.IsProtected = *req.Password != ""
+	}
+	if req.Alias != nil && *req.Alias != url.ShortCode {
+		if err = s.checkAliasAvailability(ctx, url.DomainID, *req.Alias); err != nil {
+			return nil, err
+		}
+		url.ShortCode = *req.Alias
+	}
+
+	err = s.urlRepo.Update(url)
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, fmt.Errorf("%w: %s", ErrAliasAlreadyExists, url.ShortCode)
 	}
-	err := s.urlRepo.CreateBulk(urls)
 	if err != nil {
-		log.Errorf("CreateShortURLs err: %v", err)
+		log.Errorf("UpdateShortURL err: %v", err)
 		return nil, err
 	}
-	return urls, nil
+	s.invalidateCachedURL(ctx, url.DomainID, shortCode)
+	s.invalidateCachedURL(ctx, url.DomainID, url.ShortCode)
+
+	if err = s.setShortURLs(url); err != nil {
+		log.Errorf("UpdateShortURL short url err: %v", err)
+		return nil, err
+	}
+	return url, nil
 }
 
-func (s *URLService) GetLongURL(ctx *gin.Context, shortCode string) (*model.URL, error) {
+// DeleteShortURL soft deletes a URL so that its click history survives
+func (s *URLService) DeleteShortURL(ctx *gin.Context, workspaceID uint, domain string, shortCode string) error {
 	log := logger.GetLogger(ctx)
-	url, err := s.urlRepo.FindByShortCode(shortCode)
+	url, err := s.findWorkspaceURL(ctx, workspaceID, domain, shortCode)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	if url.ExpiresAt != nil && time.Now().After(*url.ExpiresAt) {
-		return nil, errors.New("url has expired")
+	if err = s.urlRepo.Delete(url); err != nil {
+		log.Errorf("DeleteShortURL err: %v", err)
+		return err
 	}
+	s.invalidateCachedURL(ctx, url.DomainID, shortCode)
+	return nil
+}
 
-	err = s.urlRepo.IncrementClicks(shortCode)
+// SetURLDisabled takes any link down, or brings it back, on behalf of an admin
+func (s *URLService) SetURLDisabled(ctx *gin.Context, urlID uint, disabled bool) (*model.URL, error) {
+	log := logger.GetLogger(ctx)
+	url, err := s.urlRepo.FindByID(urlID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrURLNotFound
+	}
 	if err != nil {
-		log.Errorf("increment clicks failed: %v", err)
+		log.Errorf("SetURLDisabled find err: %v", err)
 		return nil, err
 	}
 
+	if disabled && url.DisabledAt == nil {
+		now := time.Now()
+		url.DisabledAt = &now
+	} else if !disabled {
+		url.DisabledAt = nil
+	}
+	if err = s.urlRepo.Update(url); err != nil {
+		log.Errorf("SetURLDisabled err: %v", err)
+		return nil, err
+	}
+	s.invalidateCachedURL(ctx, url.DomainID, url.ShortCode)
+	if err = s.setShortURLs(url); err != nil {
+		log.Errorf("SetURLDisabled short url err: %v", err)
+		return nil, err
+	}
 	return url, nil
 }
 
-func (s *URLService) GetUserURLs(userID uint) ([]model.URL, error) {
-	return s.urlRepo.FindByUserID(userID)
+// GetWorkspaceURLs returns one page of the workspace's URLs along with the cursor of the next page
+func (s *URLService) GetWorkspaceURLs(
+	ctx *gin.Context, workspaceID uint, req *dto.ListURLsRequest,
+) ([]model.URL, *utils.PaginationMeta, error) {
+	return s.listURLs(ctx, &repository.URLListFilter{WorkspaceID: workspaceID}, req)
+}
+
+// GetUserURLs returns one page of the URLs created by a user, in any workspace
+func (s *URLService) GetUserURLs(
+	ctx *gin.Context, userID uint, req *dto.ListURLsRequest,
+) ([]model.URL, *utils.PaginationMeta, error) {
+	return s.listURLs(ctx, &repository.URLListFilter{UserID: userID}, req)
+}
+
+func (s *URLService) listURLs(
+	ctx *gin.Context, filter *repository.URLListFilter, req *dto.ListURLsRequest,
+) ([]model.URL, *utils.PaginationMeta, error) {
+	log := logger.GetLogger(ctx)
+	filter.Status = req.Status
+	filter.IsProtected = req.Protected
+	filter.CreatedFrom = req.CreatedFrom
+	filter.CreatedTo = req.CreatedTo
+	filter.Search = req.Search
+	filter.SortBy = req.SortBy
+	filter.Descending = req.Order != "asc"
+	filter.Limit = req.Limit
+	if filter.SortBy == "" {
+		filter.SortBy = repository.URLSortByCreatedAt
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultURLPageSize
+	}
+	if req.Cursor != "" {
+		cursor, err := repository.DecodeURLCursor(req.Cursor)
+		if err != nil || cursor.SortBy != filter.SortBy || !cursor.Valid() {
+			return nil, nil, ErrInvalidCursor
+		}
+		filter.Cursor = cursor
+	}
+
+	urls, nextCursor, err := s.urlRepo.FindByFilter(filter)
+	if err != nil {
+		log.Errorf("listURLs err: %v", err)
+		return nil, nil, err
+	}
+	total, err := s.urlRepo.CountByFilter(filter)
+	if err != nil {
+		log.Errorf("listURLs count err: %v", err)
+		return nil, nil, err
+	}
+	urlPointers := make([]*model.URL, len(urls))
+	for i := range urls {
+		urlPointers[i] = &urls[i]
+	}
+	if err = s.setShortURLs(urlPointers...); err != nil {
+		log.Errorf("listURLs short url err: %v", err)
+		return nil, nil, err
+	}
+
+	return urls, &utils.PaginationMeta{
+		NextCursor: nextCursor,
+		TotalCount: total,
+		Limit:      filter.Limit,
+	}, nil
+}
+
+// setShortURLs fills the public link of URLs: on their custom domain when they have one,
+// on the public base URL otherwise
+func (s *URLService) setShortURLs(urls ...*model.URL) error {
+	var domainIDs []uint
+	for _, url := range urls {
+		if url.DomainID != common_constants.DefaultDomainID {
+			domainIDs = append(domainIDs, url.DomainID)
+		}
+	}
+	hostnames, err := s.domainService.GetHostnames(domainIDs)
+	if err != nil {
+		return err
+	}
+	for _, url := range urls {
+		baseURL := s.publicBaseURL
+		if hostname, ok := hostnames[url.DomainID]; ok {
+			baseURL = "https://" + hostname
+		}
+		url.ShortURL = baseURL + "/" + url.ShortCode
+	}
+	return nil
 }
 
-func (s *URLService) GenerateQRCodeBase64(ctx *gin.Context, shortCode string) (string, error) {
+// GenerateQRCode renders the QR code of one of the workspace's links with the requested options. It
+// also returns a signed public URL of the same image, for <img> tags which can't send credentials.
+func (s *URLService) GenerateQRCode(
+	ctx *gin.Context, workspaceID uint, domain string, shortCode string, req *dto.QRCodeRequest,
+) (*utils.QRCodeImage, string, error) {
 	log := logger.GetLogger(ctx)
-	url := "https://localhost:8080/api/v1/url/" + shortCode
-	png, err := qrcode.Encode(url, qrcode.Medium, 256)
+	opts, err := newQRCodeOptions(req)
+	if err != nil {
+		return nil, "", err
+	}
+	url, err := s.GetWorkspaceURL(ctx, workspaceID, domain, shortCode)
+	if err != nil {
+		return nil, "", err
+	}
+	image, err := utils.RenderQRCode(url.ShortURL, opts)
 	if err != nil {
 		log.Errorf("GenerateQRCode err: %v", err)
-		return "", err
+		return nil, "", err
 	}
-	encodedPNG := base64.StdEncoding.EncodeToString(png)
+	query := s.qrCodeSigner.Sign(url.ID, qrCodeOptionsQuery(req), time.Now().Add(common_constants.QRCodeImageURLTTL))
+	imageURL := fmt.Sprintf("%s/api/v1/qr/%d?%s", s.publicBaseURL, url.ID, query.Encode())
+	return image, imageURL, nil
+}
 
-	return fmt.Sprintf("data:image/png;base64,%s", encodedPNG), nil
+// GetSignedQRCode renders the QR code of a signed image URL, which needs no credentials. The
+// signature fixes the link and the options, so the image can't be changed from the URL.
+func (s *URLService) GetSignedQRCode(ctx *gin.Context, urlID uint, query neturl.Values, req *dto.QRCodeRequest) (*utils.QRCodeImage, error) {
+	log := logger.GetLogger(ctx)
+	if !s.qrCodeSigner.Verify(urlID, query) {
+		return nil, ErrInvalidQRCodeURL
+	}
+	opts, err := newQRCodeOptions(req)
+	if err != nil {
+		return nil, err
+	}
+	url, err := s.urlRepo.FindByID(urlID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrURLNotFound
+	}
+	if err != nil {
+		log.Errorf("GetSignedQRCode err: %v", err)
+		return nil, err
+	}
+	if err = s.setShortURLs(url); err != nil {
+		log.Errorf("GetSignedQRCode short url err: %v", err)
+		return nil, err
+	}
+	image, err := utils.RenderQRCode(url.ShortURL, opts)
+	if err != nil {
+		log.Errorf("GetSignedQRCode err: %v", err)
+		return nil, err
+	}
+	return image, nil
+}
 
+// qrCodeOptionsQuery returns the rendering options of a request as the query of an image URL
+func qrCodeOptionsQuery(req *dto.QRCodeRequest) neturl.Values {
+	query := neturl.Values{}
+	if req.Size != 0 {
+		query.Set("size", fmt.Sprint(req.Size))
+	}
+	if req.Level != "" {
+		query.Set("level", req.Level)
+	}
+	if req.Foreground != "" {
+		query.Set("fg", req.Foreground)
+	}
+	if req.Background != "" {
+		query.Set("bg", req.Background)
+	}
+	if req.QuietZone != nil {
+		query.Set("quiet_zone", fmt.Sprint(*req.QuietZone))
+	}
+	if req.Format != "" {
+		query.Set("format", req.Format)
+	}
+	return query
+}
+
+func newQRCodeOptions(req *dto.QRCodeRequest) (utils.QRCodeOptions, error) {
+	opts := utils.QRCodeOptions{
+		Size:      common_constants.QRCodeDefaultSize,
+		QuietZone: common_constants.QRCodeDefaultQuietZone,
+		Format:    utils.QRCodeFormatPNG,
+	}
+	if req.Size != 0 {
+		opts.Size = req.Size
+	}
+	if req.QuietZone != nil {
+		opts.QuietZone = *req.QuietZone
+	}
+	if req.Format != "" {
+		opts.Format = req.Format
+	}
+
+	var err error
+	if opts.Level, err = utils.ParseQRCodeLevel(req.Level); err != nil {
+		return opts, ErrInvalidQRCodeOptions
+	}
+	foreground, background := req.Foreground, req.Background
+	if foreground == "" {
+		foreground = common_constants.QRCodeDefaultForeground
+	}
+	if background == "" {
+		background = common_constants.QRCodeDefaultBackground
+	}
+	if opts.Foreground, err = utils.ParseHexColor(foreground); err != nil {
+		return opts, ErrInvalidQRCodeOptions
+	}
+	if opts.Background, err = utils.ParseHexColor(background); err != nil {
+		return opts, ErrInvalidQRCodeOptions
+	}
+	if opts.Foreground == opts.Background {
+		return opts, ErrInvalidQRCodeOptions
+	}
+	return opts, nil
 }
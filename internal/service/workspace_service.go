@@ -0,0 +1,414 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikhil/url-shortner-backend/constants"
+	"github.com/nikhil/url-shortner-backend/internal/dto"
+	"github.com/nikhil/url-shortner-backend/internal/middleware/logger"
+	"github.com/nikhil/url-shortner-backend/internal/model"
+	"github.com/nikhil/url-shortner-backend/internal/repository"
+	"github.com/nikhil/url-shortner-backend/internal/service/email_service"
+	"github.com/nikhil/url-shortner-backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWorkspaceNotFound         = errors.New("workspace not found")
+	ErrWorkspaceNotEmpty         = errors.New("workspace still has links")
+	ErrPersonalWorkspace         = errors.New("personal workspaces can't be shared, renamed or deleted")
+	ErrMemberNotFound            = errors.New("member not found")
+	ErrAlreadyMember             = errors.New("user is already a member of the workspace")
+	ErrLastWorkspaceOwner        = errors.New("a workspace needs at least one owner")
+	ErrInvitationNotFound        = errors.New("invitation not found or expired")
+	ErrInsufficientWorkspaceRole = errors.New("your role in the workspace doesn't allow this")
+)
+
+type WorkspaceService struct {
+	workspaceRepo  *repository.WorkspaceRepository
+	userRepo       *repository.UserRepository
+	urlRepo        *repository.URLRepository
+	emailService   email_service.IEmailService
+	emailTemplates *email_service.TemplateRegistry
+}
+
+func NewWorkspaceService(
+	workspaceRepo *repository.WorkspaceRepository,
+	userRepo *repository.UserRepository,
+	urlRepo *repository.URLRepository,
+	emailService email_service.IEmailService,
+	emailTemplates *email_service.TemplateRegistry,
+) *WorkspaceService {
+	return &WorkspaceService{
+		workspaceRepo:  workspaceRepo,
+		userRepo:       userRepo,
+		urlRepo:        urlRepo,
+		emailService:   emailService,
+		emailTemplates: emailTemplates,
+	}
+}
+
+func newWorkspaceResponse(member *model.WorkspaceMember) *dto.WorkspaceResponse {
+	return &dto.WorkspaceResponse{
+		Workspace: &member.Workspace,
+		Personal:  member.Workspace.IsPersonal(),
+		Role:      member.Role,
+	}
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ResolveMembership returns the membership of a user in the workspace named by the X-Workspace-ID
+// header, their personal workspace when the header is empty. Workspaces the user isn't a member
+// of are reported as not found.
+func (s *WorkspaceService) ResolveMembership(ctx *gin.Context, userID uint, rawWorkspaceID string) (*model.WorkspaceMember, error) {
+	log := logger.GetLogger(ctx)
+	if rawWorkspaceID == "" {
+		return s.ensurePersonalWorkspace(ctx, userID)
+	}
+	workspaceID, err := strconv.ParseUint(rawWorkspaceID, 10, 64)
+	if err != nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	member, err := s.workspaceRepo.FindMember(uint(workspaceID), userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		log.Errorf("Failed to find membership of user: %d in workspace: %d, err: %v", userID, workspaceID, err)
+		return nil, err
+	}
+	return member, nil
+}
+
+// ensurePersonalWorkspace returns the owner membership of the user's personal workspace, creating
+// it for users who signed up after the workspaces migration
+func (s *WorkspaceService) ensurePersonalWorkspace(ctx *gin.Context, userID uint) (*model.WorkspaceMember, error) {
+	log := logger.GetLogger(ctx)
+	workspace, err := s.workspaceRepo.FindPersonal(userID)
+	if err == nil {
+		return s.workspaceRepo.FindMember(workspace.ID, userID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Errorf("Failed to find personal workspace of user: %d, err: %v", userID, err)
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		log.Errorf("Failed to find user: %d, err: %v", userID, err)
+		return nil, err
+	}
+	member, err := s.workspaceRepo.CreateWithOwner(&model.Workspace{Name: user.Name, PersonalUserID: &userID}, userID)
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		// Created by a concurrent request
+		workspace, err = s.workspaceRepo.FindPersonal(userID)
+		if err != nil {
+			return nil, err
+		}
+		return s.workspaceRepo.FindMember(workspace.ID, userID)
+	}
+	if err != nil {
+		log.Errorf("Failed to create personal workspace of user: %d, err: %v", userID, err)
+		return nil, err
+	}
+	return member, nil
+}
+
+func (s *WorkspaceService) CreateWorkspace(ctx *gin.Context, userID uint, req *dto.CreateWorkspaceRequest) (*dto.WorkspaceResponse, error) {
+	log := logger.GetLogger(ctx)
+	member, err := s.workspaceRepo.CreateWithOwner(&model.Workspace{Name: strings.TrimSpace(req.Name)}, userID)
+	if err != nil {
+		log.Errorf("CreateWorkspace err: %v", err)
+		return nil, err
+	}
+	return newWorkspaceResponse(member), nil
+}
+
+// ListWorkspaces returns the workspaces the user is a member of, personal workspace first
+func (s *WorkspaceService) ListWorkspaces(ctx *gin.Context, userID uint) ([]*dto.WorkspaceResponse, error) {
+	log := logger.GetLogger(ctx)
+	if _, err := s.ensurePersonalWorkspace(ctx, userID); err != nil {
+		return nil, err
+	}
+	members, err := s.workspaceRepo.FindMembershipsByUserID(userID)
+	if err != nil {
+		log.Errorf("ListWorkspaces err: %v", err)
+		return nil, err
+	}
+	responses := make([]*dto.WorkspaceResponse, 0, len(members))
+	for i := range members {
+		responses = append(responses, newWorkspaceResponse(&members[i]))
+	}
+	return responses, nil
+}
+
+func (s *WorkspaceService) UpdateWorkspace(ctx *gin.Context, member *model.WorkspaceMember, req *dto.UpdateWorkspaceRequest) (*dto.WorkspaceResponse, error) {
+	log := logger.GetLogger(ctx)
+	if member.Workspace.IsPersonal() {
+		return nil, ErrPersonalWorkspace
+	}
+	member.Workspace.Name = strings.TrimSpace(req.Name)
+	if err := s.workspaceRepo.Update(&member.Workspace); err != nil {
+		log.Errorf("UpdateWorkspace err: %v", err)
+		return nil, err
+	}
+	return newWorkspaceResponse(member), nil
+}
+
+// DeleteWorkspace removes a team workspace that no longer has links
+func (s *WorkspaceService) DeleteWorkspace(ctx *gin.Context, member *model.WorkspaceMember) error {
+	log := logger.GetLogger(ctx)
+	if member.Workspace.IsPersonal() {
+		return ErrPersonalWorkspace
+	}
+	count, err := s.urlRepo.CountByWorkspaceID(member.WorkspaceID)
+	if err != nil {
+		log.Errorf("DeleteWorkspace count urls err: %v", err)
+		return err
+	}
+	if count > 0 {
+		return ErrWorkspaceNotEmpty
+	}
+	if err = s.workspaceRepo.Delete(&member.Workspace); err != nil {
+		log.Errorf("DeleteWorkspace err: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *WorkspaceService) ListMembers(ctx *gin.Context, workspaceID uint) ([]*dto.WorkspaceMemberResponse, error) {
+	log := logger.GetLogger(ctx)
+	members, err := s.workspaceRepo.FindMembers(workspaceID)
+	if err != nil {
+		log.Errorf("ListMembers err: %v", err)
+		return nil, err
+	}
+	responses := make([]*dto.WorkspaceMemberResponse, 0, len(members))
+	for _, member := range members {
+		responses = append(responses, &dto.WorkspaceMemberResponse{
+			UserID:   member.UserID,
+			Email:    member.User.Email,
+			Name:     member.User.Name,
+			Role:     member.Role,
+			JoinedAt: member.CreatedAt,
+		})
+	}
+	return responses, nil
+}
+
+// InviteMember emails an invitation to join the workspace. The invitee doesn't need an account yet,
+// but has to accept with the account of the invited email.
+func (s *WorkspaceService) InviteMember(
+	ctx *gin.Context, inviter *model.WorkspaceMember, req *dto.InviteWorkspaceMemberRequest,
+) (*model.WorkspaceInvitation, error) {
+	log := logger.GetLogger(ctx)
+	if inviter.Workspace.IsPersonal() {
+		return nil, ErrPersonalWorkspace
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if user, err := s.userRepo.FindByEmail(email); err == nil {
+		if _, err = s.workspaceRepo.FindMember(inviter.WorkspaceID, user.ID); err == nil {
+			return nil, ErrAlreadyMember
+		}
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		log.Errorf("Failed to generate invitation token: %v", err)
+		return nil, err
+	}
+	invitation := &model.WorkspaceInvitation{
+		WorkspaceID: inviter.WorkspaceID,
+		Email:       email,
+		Role:        common_constants.WorkspaceRole(req.Role),
+		TokenHash:   hashInvitationToken(token),
+		InvitedBy:   inviter.UserID,
+		ExpiresAt:   time.Now().Add(common_constants.WorkspaceInvitationTTL),
+	}
+	if err = s.workspaceRepo.CreateInvitation(invitation); err != nil {
+		log.Errorf("InviteMember err: %v", err)
+		return nil, err
+	}
+
+	inviterName := ""
+	if user, err := s.userRepo.FindByID(inviter.UserID); err == nil {
+		inviterName = user.Name
+	}
+	if err = s.sendInvitation(invitation, inviter.Workspace.Name, inviterName, token); err != nil {
+		log.Errorf("Failed to send invitation: %d, err: %v", invitation.ID, err)
+		if deleteErr := s.workspaceRepo.DeleteInvitation(invitation); deleteErr != nil {
+			log.Errorf("Failed to delete unsent invitation: %d, err: %v", invitation.ID, deleteErr)
+		}
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (s *WorkspaceService) sendInvitation(invitation *model.WorkspaceInvitation, workspaceName string, inviterName string, token string) error {
+	// Invitees who already have an account get the email in their locale
+	locale := ""
+	if invitee, err := s.userRepo.FindByEmail(invitation.Email); err == nil {
+		locale = invitee.Locale
+	}
+	m, err := s.emailTemplates.Message(common_constants.EmailTemplateWorkspaceInvitation, locale, invitation.Email, email_service.TemplateData{
+		"InviterName":   inviterName,
+		"WorkspaceName": workspaceName,
+		"Role":          string(invitation.Role),
+		"Token":         token,
+		"ExpiresAt":     invitation.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	return s.emailService.SendEmail(m)
+}
+
+func (s *WorkspaceService) ListInvitations(ctx *gin.Context, workspaceID uint) ([]model.WorkspaceInvitation, error) {
+	log := logger.GetLogger(ctx)
+	invitations, err := s.workspaceRepo.FindPendingInvitations(workspaceID, time.Now())
+	if err != nil {
+		log.Errorf("ListInvitations err: %v", err)
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (s *WorkspaceService) RevokeInvitation(ctx *gin.Context, workspaceID uint, invitationID uint) error {
+	log := logger.GetLogger(ctx)
+	invitation, err := s.workspaceRepo.FindInvitation(workspaceID, invitationID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvitationNotFound
+	}
+	if err != nil {
+		log.Errorf("RevokeInvitation find err: %v", err)
+		return err
+	}
+	if err = s.workspaceRepo.DeleteInvitation(invitation); err != nil {
+		log.Errorf("RevokeInvitation err: %v", err)
+		return err
+	}
+	return nil
+}
+
+// AcceptInvitation adds the user to the workspace of an invitation sent to their email
+func (s *WorkspaceService) AcceptInvitation(ctx *gin.Context, userID uint, token string) (*dto.WorkspaceResponse, error) {
+	log := logger.GetLogger(ctx)
+	invitation, err := s.workspaceRepo.FindInvitationByTokenHash(hashInvitationToken(token), time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		log.Errorf("AcceptInvitation find err: %v", err)
+		return nil, err
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		log.Errorf("AcceptInvitation find user err: %v", err)
+		return nil, err
+	}
+	// Invitations can't be forwarded to another account
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return nil, ErrInvitationNotFound
+	}
+
+	member := &model.WorkspaceMember{WorkspaceID: invitation.WorkspaceID, UserID: userID, Role: invitation.Role}
+	err = s.workspaceRepo.CreateMember(member)
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, ErrAlreadyMember
+	}
+	if err != nil {
+		log.Errorf("AcceptInvitation err: %v", err)
+		return nil, err
+	}
+	if err = s.workspaceRepo.DeleteInvitation(invitation); err != nil {
+		log.Errorf("Failed to delete accepted invitation: %d, err: %v", invitation.ID, err)
+	}
+	member.Workspace = invitation.Workspace
+	log.Infof("User: %d joined workspace: %d as %s", userID, member.WorkspaceID, member.Role)
+	return newWorkspaceResponse(member), nil
+}
+
+// UpdateMemberRole changes the role of a member, keeping at least one owner
+func (s *WorkspaceService) UpdateMemberRole(
+	ctx *gin.Context, workspaceID uint, userID uint, req *dto.UpdateWorkspaceMemberRequest,
+) (*model.WorkspaceMember, error) {
+	log := logger.GetLogger(ctx)
+	member, err := s.findMember(ctx, workspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	role := common_constants.WorkspaceRole(req.Role)
+	if member.Role == common_constants.WorkspaceRoleOwner && role != common_constants.WorkspaceRoleOwner {
+		if err = s.checkNotLastOwner(ctx, workspaceID); err != nil {
+			return nil, err
+		}
+	}
+	member.Role = role
+	if err = s.workspaceRepo.UpdateMember(member); err != nil {
+		log.Errorf("UpdateMemberRole err: %v", err)
+		return nil, err
+	}
+	return member, nil
+}
+
+// RemoveMember removes a member from a team workspace. Owners can remove anyone, other members
+// can only leave; the last owner can't leave.
+func (s *WorkspaceService) RemoveMember(ctx *gin.Context, actor *model.WorkspaceMember, userID uint) error {
+	log := logger.GetLogger(ctx)
+	if actor.Workspace.IsPersonal() {
+		return ErrPersonalWorkspace
+	}
+	if actor.UserID != userID && actor.Role != common_constants.WorkspaceRoleOwner {
+		return ErrInsufficientWorkspaceRole
+	}
+	member, err := s.findMember(ctx, actor.WorkspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Role == common_constants.WorkspaceRoleOwner {
+		if err = s.checkNotLastOwner(ctx, actor.WorkspaceID); err != nil {
+			return err
+		}
+	}
+	if err = s.workspaceRepo.DeleteMember(member); err != nil {
+		log.Errorf("RemoveMember err: %v", err)
+		return err
+	}
+	log.Infof("User: %d removed user: %d from workspace: %d", actor.UserID, userID, actor.WorkspaceID)
+	return nil
+}
+
+func (s *WorkspaceService) findMember(ctx *gin.Context, workspaceID uint, userID uint) (*model.WorkspaceMember, error) {
+	log := logger.GetLogger(ctx)
+	member, err := s.workspaceRepo.FindMember(workspaceID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMemberNotFound
+	}
+	if err != nil {
+		log.Errorf("Failed to find member: %d of workspace: %d, err: %v", userID, workspaceID, err)
+		return nil, err
+	}
+	return member, nil
+}
+
+func (s *WorkspaceService) checkNotLastOwner(ctx *gin.Context, workspaceID uint) error {
+	owners, err := s.workspaceRepo.CountOwners(workspaceID)
+	if err != nil {
+		logger.GetLogger(ctx).Errorf("Failed to count owners of workspace: %d, err: %v", workspaceID, err)
+		return err
+	}
+	if owners <= 1 {
+		return ErrLastWorkspaceOwner
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	QRCodeFormatPNG = "png"
+	QRCodeFormatSVG = "svg"
+)
+
+var ErrInvalidHexColor = errors.New("invalid hex color")
+
+// QRCodeOptions describes how a QR code is rendered
+type QRCodeOptions struct {
+	Size       int // width and height in pixels
+	Level      qrcode.RecoveryLevel
+	Foreground color.RGBA
+	Background color.RGBA
+	QuietZone  int // blank modules around the symbol
+	Format     string
+}
+
+// QRCodeImage is a rendered QR code along with its content type
+type QRCodeImage struct {
+	Data        []byte
+	ContentType string
+}
+
+// ParseQRCodeLevel maps the L/M/Q/H error correction letters to go-qrcode recovery levels
+func ParseQRCodeLevel(level string) (qrcode.RecoveryLevel, error) {
+	switch strings.ToUpper(level) {
+	case "L":
+		return qrcode.Low, nil
+	case "", "M":
+		return qrcode.Medium, nil
+	case "Q":
+		return qrcode.High, nil
+	case "H":
+		return qrcode.Highest, nil
+	}
+	return 0, fmt.Errorf("invalid error correction level %q", level)
+}
+
+// ParseHexColor parses RRGGBB or RRGGBBAA colors, with or without a leading '#'
+func ParseHexColor(hex string) (color.RGBA, error) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return color.RGBA{}, ErrInvalidHexColor
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, ErrInvalidHexColor
+	}
+	if len(hex) == 6 {
+		value = value<<8 | 0xff
+	}
+	return color.RGBA{R: uint8(value >> 24), G: uint8(value >> 16), B: uint8(value >> 8), A: uint8(value)}, nil
+}
+
+// RenderQRCode encodes content as a QR code in the requested format
+func RenderQRCode(content string, opts QRCodeOptions) (*QRCodeImage, error) {
+	qr, err := qrcode.New(content, opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	// The quiet zone is drawn by us so that its width is configurable
+	qr.DisableBorder = true
+	modules := withQuietZone(qr.Bitmap(), opts.QuietZone)
+
+	switch opts.Format {
+	case QRCodeFormatSVG:
+		return &QRCodeImage{Data: renderQRCodeSVG(modules, opts), ContentType: "image/svg+xml"}, nil
+	default:
+		data, err := renderQRCodePNG(modules, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &QRCodeImage{Data: data, ContentType: "image/png"}, nil
+	}
+}
+
+func withQuietZone(bitmap [][]bool, quietZone int) [][]bool {
+	size := len(bitmap) + 2*quietZone
+	modules := make([][]bool, size)
+	for y := range modules {
+		modules[y] = make([]bool, size)
+	}
+	for y, row := range bitmap {
+		copy(modules[y+quietZone][quietZone:], row)
+	}
+	return modules
+}
+
+// renderQRCodePNG scales the modules to the requested size with nearest neighbour sampling
+func renderQRCodePNG(modules [][]bool, opts QRCodeOptions) ([]byte, error) {
+	count := len(modules)
+	size := opts.Size
+	if size < count {
+		size = count
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{opts.Background, opts.Foreground})
+	for y := 0; y < size; y++ {
+		row := modules[y*count/size]
+		for x := 0; x < size; x++ {
+			if row[x*count/size] {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderQRCodeSVG draws one path with a sub-path per horizontal run of dark modules
+func renderQRCodeSVG(modules [][]bool, opts QRCodeOptions) []byte {
+	count := len(modules)
+	var path strings.Builder
+	for y, row := range modules {
+		for x := 0; x < count; {
+			if !row[x] {
+				x++
+				continue
+			}
+			start := x
+			for x < count && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, count, count)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" %s/>`, count, count, svgFill(opts.Background))
+	fmt.Fprintf(&buf, `<path d="%s" %s/>`, path.String(), svgFill(opts.Foreground))
+	buf.WriteString(`</svg>`)
+	return buf.Bytes()
+}
+
+func svgFill(c color.RGBA) string {
+	return fmt.Sprintf(`fill="#%02x%02x%02x" fill-opacity="%.3f"`, c.R, c.G, c.B, float64(c.A)/255)
+}
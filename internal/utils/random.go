@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// GenerateRandomToken returns n random bytes from the CSPRNG, hex encoded
+func GenerateRandomToken(n int) (string, error) {
+	token := make([]byte, n)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
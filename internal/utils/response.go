@@ -10,6 +10,14 @@ type APIResponse struct {
 	Message   string      `json:"message"`
 	Data      interface{} `json:"data"`
 	ErrorCode string      `json:"error_code"`
+	Meta      interface{} `json:"meta,omitempty"`
+}
+
+// PaginationMeta is the meta of a paginated list response
+type PaginationMeta struct {
+	NextCursor string `json:"next_cursor"`
+	TotalCount int64  `json:"total_count"`
+	Limit      int    `json:"limit"`
 }
 
 // ResponseBuilder helps construct API responses
@@ -44,6 +52,11 @@ func (rb *ResponseBuilder) SetErrorCode(code string) *ResponseBuilder {
 	return rb
 }
 
+func (rb *ResponseBuilder) SetMeta(meta interface{}) *ResponseBuilder {
+	rb.response.Meta = meta
+	return rb
+}
+
 func (rb *ResponseBuilder) Build(ctx *gin.Context) {
 	ctx.JSON(rb.response.Status, rb.response)
 }
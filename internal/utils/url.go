@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"errors"
+	"net/url"
+)
+
+var ErrUnsupportedURLScheme = errors.New("url must be an absolute http or https URL")
+
+// ParseHTTPURL parses an absolute http or https URL. Links only ever point at web pages, other schemes
+// (javascript:, data:, vbscript:...) would run attacker chosen content on our domain.
+func ParseHTTPURL(rawURL string) (*url.URL, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrUnsupportedURLScheme
+	}
+	return parsed, nil
+}
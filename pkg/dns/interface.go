@@ -0,0 +1,8 @@
+package dns
+
+import "context"
+
+// TXTResolver defines the contract for DNS TXT record lookups
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
@@ -0,0 +1,41 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+const lookupTimeout = 5 * time.Second
+
+type Resolver struct {
+	resolver *net.Resolver
+}
+
+// NewResolver returns a resolver that queries the given DNS server (host:port). An empty address
+// uses the system resolver; pointing it at a local DNS server is how verification is tested locally.
+func NewResolver(serverAddr string) *Resolver {
+	if serverAddr == "" {
+		return &Resolver{resolver: net.DefaultResolver}
+	}
+	return &Resolver{
+		resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				dialer := net.Dialer{Timeout: lookupTimeout}
+				return dialer.DialContext(ctx, network, serverAddr)
+			},
+		},
+	}
+}
+
+func (r *Resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	records, err := r.resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup TXT records of %s: %v", name, err)
+	}
+	return records, nil
+}
@@ -0,0 +1,177 @@
+// Package dnsstandin is a local DNS server for development and tests. It answers TXT queries from
+// records kept in memory, which are set over HTTP, and answers every other query with no records.
+// Point DNS_RESOLVER_ADDR at it to verify custom domains without publishing real records.
+package dnsstandin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	maxUDPMessageSize = 512
+	recordTTL         = 0
+)
+
+// Server is the stand-in. ServeUDP answers DNS queries, ServeHTTP lists TXT records on GET /records,
+// sets one on PUT /records?name=<name>&value=<value> and removes the ones of a name on
+// DELETE /records?name=<name>.
+type Server struct {
+	mu      sync.Mutex
+	records map[string][]string
+	mux     *http.ServeMux
+}
+
+func NewServer() *Server {
+	s := &Server{records: make(map[string][]string), mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /records", s.list)
+	s.mux.HandleFunc("PUT /records", s.set)
+	s.mux.HandleFunc("DELETE /records", s.remove)
+	return s
+}
+
+// SetTXT adds a TXT record to a name
+func (s *Server) SetTXT(name string, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name = canonicalName(name)
+	s.records[name] = append(s.records[name], value)
+}
+
+// RemoveTXT removes the TXT records of a name
+func (s *Server) RemoveTXT(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, canonicalName(name))
+}
+
+// ServeUDP answers DNS queries until the connection is closed
+func (s *Server) ServeUDP(conn net.PacketConn) error {
+	buf := make([]byte, maxUDPMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		response, err := s.answer(buf[:n])
+		if err != nil {
+			log.Printf("dns-standin dropped a query from %s: %v", addr, err)
+			continue
+		}
+		conn.WriteTo(response, addr)
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// answer builds the response to a query. Names with TXT records are answered authoritatively, any
+// other name doesn't exist.
+func (s *Server) answer(query []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	values, found := s.records[canonicalName(question.Name.String())]
+	values = append([]string(nil), values...)
+	s.mu.Unlock()
+
+	responseHeader := dnsmessage.Header{
+		ID:               header.ID,
+		Response:         true,
+		OpCode:           header.OpCode,
+		Authoritative:    true,
+		RecursionDesired: header.RecursionDesired,
+	}
+	if !found {
+		responseHeader.RCode = dnsmessage.RCodeNameError
+	}
+	builder := dnsmessage.NewBuilder(make([]byte, 0, maxUDPMessageSize), responseHeader)
+	builder.EnableCompression()
+	if err = builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err = builder.Question(question); err != nil {
+		return nil, err
+	}
+	if err = builder.StartAnswers(); err != nil {
+		return nil, err
+	}
+	if question.Type == dnsmessage.TypeTXT {
+		log.Printf("TXT query for %s, %d records", question.Name, len(values))
+		for _, value := range values {
+			err = builder.TXTResource(
+				dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: recordTTL},
+				dnsmessage.TXTResource{TXT: splitTXT(value)},
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return builder.Finish()
+}
+
+// splitTXT splits a value into the 255 byte strings a TXT record is made of
+func splitTXT(value string) []string {
+	var parts []string
+	for len(value) > 255 {
+		parts = append(parts, value[:255])
+		value = value[255:]
+	}
+	return append(parts, value)
+}
+
+// canonicalName lowercases a name and makes it fully qualified
+func canonicalName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".") + "."
+}
+
+func (s *Server) list(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	records := make(map[string][]string, len(s.records))
+	for name, values := range s.records {
+		records[name] = append([]string(nil), values...)
+	}
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+func (s *Server) set(w http.ResponseWriter, r *http.Request) {
+	name, value := r.URL.Query().Get("name"), r.URL.Query().Get("value")
+	if name == "" || value == "" {
+		http.Error(w, "name and value are required", http.StatusBadRequest)
+		return
+	}
+	s.SetTXT(name, value)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) remove(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	s.RemoveTXT(name)
+	w.WriteHeader(http.StatusNoContent)
+}
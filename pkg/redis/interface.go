@@ -13,5 +13,10 @@ type CacheClient interface {
 	Delete(ctx context.Context, key string) error
 	Exists(ctx context.Context, key string) (bool, error)
 	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+	CompareAndSet(ctx context.Context, key string, field string, expected string, value interface{}, expiration time.Duration) (bool, error)
+	Increment(ctx context.Context, key string, expiration time.Duration) (int64, error)
+	SetAdd(ctx context.Context, key string, member string, expiration time.Duration) error
+	SetMembers(ctx context.Context, key string) ([]string, error)
+	SetRemove(ctx context.Context, key string, members ...string) error
 	Close() error
 }
@@ -16,6 +16,20 @@ var (
 	once     sync.Once
 )
 
+// compareAndSetScript replaces the JSON value of KEYS[1] with ARGV[3], expiring in ARGV[4]
+// milliseconds, when its field ARGV[1] still holds ARGV[2]
+var compareAndSetScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if not current then
+	return 0
+end
+if cjson.decode(current)[ARGV[1]] ~= ARGV[2] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[3], 'PX', ARGV[4])
+return 1
+`)
+
 type Client struct {
 	client *redis.Client
 }
@@ -136,3 +150,71 @@ func (r *Client) SetNX(ctx context.Context, key string, value interface{}, expir
 
 	return success, nil
 }
+
+// CompareAndSet atomically replaces the JSON value of a key, but only while the given field of the
+// stored value still holds expected. It reports false, without changing anything, when the field
+// holds something else or the key doesn't exist.
+func (r *Client) CompareAndSet(
+	ctx context.Context, key string, field string, expected string, value interface{}, expiration time.Duration,
+) (bool, error) {
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal value: %v", err)
+	}
+
+	set, err := compareAndSetScript.Run(ctx, r.client, []string{key}, field, expected, string(jsonBytes), expiration.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to compare and set key %s: %v", key, err)
+	}
+
+	return set == 1, nil
+}
+
+// Increment atomically increments a counter. The expiration is only set when the key is created,
+// so the counter works as a fixed window starting at the first increment.
+func (r *Client) Increment(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, expiration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to increment key %s: %v", key, err)
+	}
+
+	return incr.Val(), nil
+}
+
+// SetAdd adds a member to a set and (re)sets the expiration of the whole set
+func (r *Client) SetAdd(ctx context.Context, key string, member string, expiration time.Duration) error {
+	pipe := r.client.TxPipeline()
+	pipe.SAdd(ctx, key, member)
+	pipe.Expire(ctx, key, expiration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to add to set %s: %v", key, err)
+	}
+
+	return nil
+}
+
+func (r *Client) SetMembers(ctx context.Context, key string) ([]string, error) {
+	members, err := r.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of set %s: %v", key, err)
+	}
+
+	return members, nil
+}
+
+func (r *Client) SetRemove(ctx context.Context, key string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(members))
+	for i, member := range members {
+		args[i] = member
+	}
+	if err := r.client.SRem(ctx, key, args...).Err(); err != nil {
+		return fmt.Errorf("failed to remove from set %s: %v", key, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const sendTimeout = 10 * time.Second
+
+// Message is the JSON body posted to the provider for every SMS
+type Message struct {
+	To   string `json:"to"`
+	Body string `json:"body"`
+}
+
+// HTTPProvider sends messages by posting them as JSON to an SMS gateway, authenticated with a
+// bearer token. The stand-in server of this package speaks the same protocol.
+type HTTPProvider struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewHTTPProvider(url string, token string) *HTTPProvider {
+	return &HTTPProvider{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: sendTimeout},
+	}
+}
+
+func (p *HTTPProvider) Send(ctx context.Context, to string, body string) error {
+	payload, err := json.Marshal(&Message{To: to, Body: body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send sms: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to send sms: provider answered %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package sms
+
+import "context"
+
+// Sender defines the contract for SMS providers
+type Sender interface {
+	Send(ctx context.Context, to string, body string) error
+}
@@ -0,0 +1,86 @@
+package sms
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const maxStandInMessages = 1000
+
+// ReceivedMessage is a message accepted by the stand-in
+type ReceivedMessage struct {
+	Message
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// StandIn is a local SMS provider for development and tests. It accepts the messages of
+// HTTPProvider on POST /messages, logs them and lists them on GET /messages?to=<phone>, newest
+// last. Nothing is delivered.
+type StandIn struct {
+	token    string
+	mu       sync.Mutex
+	messages []ReceivedMessage
+	mux      *http.ServeMux
+}
+
+// NewStandIn returns a stand-in requiring the given bearer token, or no token when empty
+func NewStandIn(token string) *StandIn {
+	s := &StandIn{token: token, mux: http.NewServeMux()}
+	s.mux.HandleFunc("POST /messages", s.receive)
+	s.mux.HandleFunc("GET /messages", s.list)
+	s.mux.HandleFunc("DELETE /messages", s.clear)
+	return s
+}
+
+func (s *StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Messages returns the messages received so far for a phone number, every message when empty
+func (s *StandIn) Messages(to string) []ReceivedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := make([]ReceivedMessage, 0, len(s.messages))
+	for _, message := range s.messages {
+		if to == "" || message.To == to {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+func (s *StandIn) receive(w http.ResponseWriter, r *http.Request) {
+	var message Message
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&message); err != nil || message.To == "" {
+		http.Error(w, "invalid message", http.StatusBadRequest)
+		return
+	}
+	log.Printf("sms to %s: %s", message.To, message.Body)
+
+	s.mu.Lock()
+	s.messages = append(s.messages, ReceivedMessage{Message: message, ReceivedAt: time.Now()})
+	if len(s.messages) > maxStandInMessages {
+		s.messages = s.messages[len(s.messages)-maxStandInMessages:]
+	}
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *StandIn) list(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Messages(r.URL.Query().Get("to")))
+}
+
+func (s *StandIn) clear(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	s.messages = nil
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
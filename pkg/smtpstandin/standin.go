@@ -0,0 +1,234 @@
+// Package smtpstandin is a local SMTP server for development and tests. It accepts every message
+// without TLS or authentication, keeps it in memory and lists it over HTTP. Nothing is delivered.
+// Failures can be injected to exercise retries and dead-lettering.
+package smtpstandin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxMessages    = 1000
+	maxMessageSize = 10 << 20
+	commandTimeout = 5 * time.Minute
+)
+
+// Message is a message accepted by the stand-in
+type Message struct {
+	From       string    `json:"from"`
+	To         []string  `json:"to"`
+	Data       string    `json:"data"` // the whole MIME message
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// Server is the stand-in. Serve answers SMTP, ServeHTTP lists messages on GET /messages?to=<address>,
+// newest last, clears them on DELETE /messages and injects failures on POST /failures.
+type Server struct {
+	mu       sync.Mutex
+	messages []Message
+	// failures is how many of the next messages are rejected, with failureCode
+	failures    int
+	failureCode int
+	mux         *http.ServeMux
+}
+
+func NewServer() *Server {
+	s := &Server{mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /messages", s.list)
+	s.mux.HandleFunc("DELETE /messages", s.clear)
+	s.mux.HandleFunc("POST /failures", s.fail)
+	return s
+}
+
+// Serve accepts SMTP connections until the listener is closed
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// FailNext rejects the next count messages with the given reply code, 451 for a temporary
+// failure or 550 for a permanent one
+func (s *Server) FailNext(count int, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures, s.failureCode = count, code
+}
+
+// Messages returns the messages received so far for an address, every message when empty
+func (s *Server) Messages(to string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := make([]Message, 0, len(s.messages))
+	for _, message := range s.messages {
+		for _, recipient := range message.To {
+			if to == "" || strings.EqualFold(recipient, to) {
+				messages = append(messages, message)
+				break
+			}
+		}
+	}
+	return messages
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handle runs one SMTP session. It speaks just enough of RFC 5321 for SMTP clients such as gomail.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(code int, text string) {
+		fmt.Fprintf(conn, "%d %s\r\n", code, text)
+	}
+
+	var from string
+	var to []string
+	reply(220, "smtp-standin ready")
+	for {
+		conn.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			fmt.Fprintf(conn, "250-smtp-standin\r\n250-8BITMIME\r\n250 SIZE %d\r\n", maxMessageSize)
+		case "HELO":
+			reply(250, "smtp-standin")
+		case "MAIL":
+			from, to = addressOf(arg), nil
+			reply(250, "OK")
+		case "RCPT":
+			to = append(to, addressOf(arg))
+			reply(250, "OK")
+		case "DATA":
+			if len(to) == 0 {
+				reply(503, "RCPT first")
+				continue
+			}
+			reply(354, "End data with <CR><LF>.<CR><LF>")
+			data, err := readData(reader)
+			if err != nil {
+				reply(552, err.Error())
+				return
+			}
+			if code := s.nextFailure(); code != 0 {
+				reply(code, "rejected by smtp-standin")
+				continue
+			}
+			s.store(Message{From: from, To: to, Data: data, ReceivedAt: time.Now()})
+			reply(250, "OK")
+		case "RSET":
+			from, to = "", nil
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Command not implemented")
+		}
+	}
+}
+
+// readData reads a message up to the lone "." line, undoing the dot-stuffing of the client
+func readData(reader *bufio.Reader) (string, error) {
+	var data strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			return data.String(), nil
+		}
+		if data.Len()+len(line) > maxMessageSize {
+			return "", io.ErrShortBuffer
+		}
+		data.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+// addressOf returns the address of a "FROM:<address>" or "TO:<address>" argument
+func addressOf(arg string) string {
+	_, address, _ := strings.Cut(arg, ":")
+	address, _, _ = strings.Cut(strings.TrimSpace(address), " ")
+	return strings.Trim(address, "<>")
+}
+
+func (s *Server) nextFailure() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures == 0 {
+		return 0
+	}
+	s.failures--
+	return s.failureCode
+}
+
+func (s *Server) store(message Message) {
+	log.Printf("email from %s to %s, %d bytes", message.From, strings.Join(message.To, ", "), len(message.Data))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, message)
+	if len(s.messages) > maxMessages {
+		s.messages = s.messages[len(s.messages)-maxMessages:]
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Messages(r.URL.Query().Get("to")))
+}
+
+func (s *Server) clear(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	s.messages = nil
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fail handles POST /failures?count=<n>&code=<451|550>
+func (s *Server) fail(w http.ResponseWriter, r *http.Request) {
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count < 0 {
+		http.Error(w, "count must be a number of messages", http.StatusBadRequest)
+		return
+	}
+	var code int
+	switch r.URL.Query().Get("code") {
+	case "", "451":
+		code = 451
+	case "550":
+		code = 550
+	default:
+		http.Error(w, "code must be 451 or 550", http.StatusBadRequest)
+		return
+	}
+	s.FailNext(count, code)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,22 @@
+package token
+
+const (
+	TokenUseAccess  = "access"
+	TokenUseRefresh = "refresh"
+	// TokenUseTwoFactor is the challenge of a login waiting for its second factor
+	TokenUseTwoFactor = "two_factor"
+	// TokenUseMagicLink is an emailed sign in link, bound to the browser it was requested from
+	TokenUseMagicLink = "magic_link"
+)
+
+// Claims are the JWT claims of the tokens issued by this backend
+type Claims struct {
+	ID        string `json:"jti"`
+	Issuer    string `json:"iss,omitempty"`
+	UserID    uint   `json:"user_id"`
+	SessionID string `json:"sid,omitempty"`
+	TokenUse  string `json:"token_use"`
+	Nonce     string `json:"nonce,omitempty"` // hash of the browser nonce of magic links
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
@@ -0,0 +1,7 @@
+package token
+
+// Issuer defines the contract for signing and verifying tokens
+type Issuer interface {
+	Issue(claims *Claims) (string, error)
+	Verify(token string) (*Claims, error)
+}
@@ -0,0 +1,168 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+const rsaKeyBits = 2048
+
+var ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+
+// Key is a signing key identified by its kid. HS256 keys are symmetric and never published.
+type Key struct {
+	ID        string
+	Algorithm string
+
+	secret     []byte
+	privateKey crypto.Signer
+	publicKey  crypto.PublicKey
+}
+
+// GenerateKey creates a new random key for the algorithm
+func GenerateKey(id string, algorithm string) (*Key, error) {
+	key := &Key{ID: id, Algorithm: algorithm}
+	switch algorithm {
+	case AlgorithmHS256:
+		key.secret = make([]byte, 32)
+		if _, err := rand.Read(key.secret); err != nil {
+			return nil, err
+		}
+	case AlgorithmRS256:
+		privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		key.privateKey, key.publicKey = privateKey, privateKey.Public()
+	case AlgorithmEdDSA:
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key.privateKey, key.publicKey = privateKey, publicKey
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+	return key, nil
+}
+
+// ParseKey restores a key from the output of MarshalPrivate
+func ParseKey(id string, algorithm string, private []byte) (*Key, error) {
+	key := &Key{ID: id, Algorithm: algorithm}
+	if algorithm == AlgorithmHS256 {
+		key.secret = private
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	switch privateKey := parsed.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != AlgorithmRS256 {
+			return nil, fmt.Errorf("%w: rsa key for %s", ErrUnsupportedAlgorithm, algorithm)
+		}
+		key.privateKey, key.publicKey = privateKey, privateKey.Public()
+	case ed25519.PrivateKey:
+		if algorithm != AlgorithmEdDSA {
+			return nil, fmt.Errorf("%w: ed25519 key for %s", ErrUnsupportedAlgorithm, algorithm)
+		}
+		key.privateKey, key.publicKey = privateKey, privateKey.Public()
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedAlgorithm, parsed)
+	}
+	return key, nil
+}
+
+// MarshalPrivate returns the secret of HS256 keys and the PKCS #8 DER private key of the others
+func (k *Key) MarshalPrivate() ([]byte, error) {
+	if k.Algorithm == AlgorithmHS256 {
+		return k.secret, nil
+	}
+	return x509.MarshalPKCS8PrivateKey(k.privateKey)
+}
+
+func (k *Key) sign(signingInput []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case AlgorithmHS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signingInput)
+		return mac.Sum(nil), nil
+	case AlgorithmRS256:
+		digest := sha256.Sum256(signingInput)
+		return k.privateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case AlgorithmEdDSA:
+		return k.privateKey.Sign(rand.Reader, signingInput, crypto.Hash(0))
+	}
+	return nil, ErrUnsupportedAlgorithm
+}
+
+func (k *Key) verify(signingInput []byte, signature []byte) bool {
+	switch k.Algorithm {
+	case AlgorithmHS256:
+		expected, _ := k.sign(signingInput)
+		return hmac.Equal(signature, expected)
+	case AlgorithmRS256:
+		publicKey, ok := k.publicKey.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		digest := sha256.Sum256(signingInput)
+		return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) == nil
+	case AlgorithmEdDSA:
+		publicKey, ok := k.publicKey.(ed25519.PublicKey)
+		return ok && ed25519.Verify(publicKey, signingInput, signature)
+	}
+	return false
+}
+
+// JWK is the public part of a key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv,omitempty"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWK returns the public key as a JWK, false for symmetric keys which can't be published
+func (k *Key) PublicJWK() (JWK, bool) {
+	jwk := JWK{Algorithm: k.Algorithm, Use: "sig", KeyID: k.ID}
+	switch publicKey := k.publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
@@ -0,0 +1,160 @@
+package token
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+	ErrUnknownKey   = errors.New("token signed with an unknown key")
+	ErrNoSigningKey = errors.New("no signing key available")
+)
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// KeySetIssuer issues JWTs with the current signing key and verifies them against every key
+// that is still live, so tokens survive a key rotation until the old key is retired.
+type KeySetIssuer struct {
+	issuer string
+
+	mu         sync.RWMutex
+	signingKey *Key
+	keys       map[string]*Key
+}
+
+func NewKeySetIssuer(issuer string) *KeySetIssuer {
+	return &KeySetIssuer{
+		issuer: issuer,
+		keys:   make(map[string]*Key),
+	}
+}
+
+// SetKeys replaces the signing key and the keys accepted for verification
+func (i *KeySetIssuer) SetKeys(signingKey *Key, keys []*Key) {
+	byID := make(map[string]*Key, len(keys))
+	for _, key := range keys {
+		byID[key.ID] = key
+	}
+	if signingKey != nil {
+		byID[signingKey.ID] = signingKey
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.signingKey = signingKey
+	i.keys = byID
+}
+
+// Issue signs the claims with the current signing key, filling in the issuer and issue time
+func (i *KeySetIssuer) Issue(claims *Claims) (string, error) {
+	i.mu.RLock()
+	key := i.signingKey
+	i.mu.RUnlock()
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+
+	claims.Issuer = i.issuer
+	if claims.IssuedAt == 0 {
+		claims.IssuedAt = time.Now().Unix()
+	}
+	encodedHeader, err := encodeSegment(&header{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	encodedClaims, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodedHeader + "." + encodedClaims
+	signature, err := key.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks the signature, algorithm, issuer and expiry of a token and returns its claims.
+// The algorithm of the header must match the one of the key, so "none" or an HS256 header
+// signed with a public key are rejected.
+func (i *KeySetIssuer) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, ErrInvalidToken
+	}
+	i.mu.RLock()
+	key, ok := i.keys[h.KeyID]
+	i.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if h.Algorithm != key.Algorithm {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Issuer != i.issuer {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+	return &claims, nil
+}
+
+// JWKS returns the public keys that tokens may be signed with, newest kid first
+func (i *KeySetIssuer) JWKS() *JWKSet {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	set := &JWKSet{Keys: []JWK{}}
+	for _, key := range i.keys {
+		if jwk, ok := key.PublicJWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	sort.Slice(set.Keys, func(a, b int) bool { return set.Keys[a].KeyID > set.Keys[b].KeyID })
+	return set
+}
+
+func encodeSegment(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeSegment(segment string, dest interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(dest)
+}
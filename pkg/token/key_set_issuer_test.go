@@ -0,0 +1,222 @@
+package token
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testIssuer = "https://sho.rt"
+
+func newTestKey(t *testing.T, id string, algorithm string) *Key {
+	t.Helper()
+	key, err := GenerateKey(id, algorithm)
+	if err != nil {
+		t.Fatalf("GenerateKey(%s): %v", algorithm, err)
+	}
+	return key
+}
+
+func newTestClaims() *Claims {
+	return &Claims{ID: "jti-1", UserID: 42, SessionID: "sid-1", TokenUse: TokenUseAccess, ExpiresAt: time.Now().Add(time.Minute).Unix()}
+}
+
+// forge builds a token from a raw header and claims with a caller chosen signature, the way an attacker would
+func forge(t *testing.T, h *header, claims *Claims, sign func(signingInput []byte) []byte) string {
+	t.Helper()
+	encodedHeader, err := encodeSegment(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedClaims, err := encodeSegment(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := encodedHeader + "." + encodedClaims
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signingInput)))
+}
+
+func TestKeySetIssuerRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmEdDSA, AlgorithmHS256} {
+		t.Run(algorithm, func(t *testing.T) {
+			issuer := NewKeySetIssuer(testIssuer)
+			issuer.SetKeys(newTestKey(t, "k1", algorithm), nil)
+
+			token, err := issuer.Issue(newTestClaims())
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+			claims, err := issuer.Verify(token)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if claims.UserID != 42 || claims.SessionID != "sid-1" || claims.Issuer != testIssuer || claims.IssuedAt == 0 {
+				t.Fatalf("Verify returned %+v", claims)
+			}
+
+			// Keys restored from storage verify the tokens of the original
+			private, err := issuer.signingKey.MarshalPrivate()
+			if err != nil {
+				t.Fatalf("MarshalPrivate: %v", err)
+			}
+			restored, err := ParseKey("k1", algorithm, private)
+			if err != nil {
+				t.Fatalf("ParseKey: %v", err)
+			}
+			other := NewKeySetIssuer(testIssuer)
+			other.SetKeys(nil, []*Key{restored})
+			if _, err = other.Verify(token); err != nil {
+				t.Fatalf("Verify with the restored key: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeySetIssuerRejectsAlgorithmNone(t *testing.T) {
+	issuer := NewKeySetIssuer(testIssuer)
+	issuer.SetKeys(newTestKey(t, "rsa", AlgorithmRS256), nil)
+	claims := newTestClaims()
+	claims.Issuer = testIssuer
+
+	for _, algorithm := range []string{"none", "None", ""} {
+		token := forge(t, &header{Algorithm: algorithm, Type: "JWT", KeyID: "rsa"}, claims, func([]byte) []byte { return nil })
+		if _, err := issuer.Verify(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("alg %q: Verify = %v, want ErrInvalidToken", algorithm, err)
+		}
+	}
+}
+
+func TestKeySetIssuerRejectsHS256SignedWithPublicKey(t *testing.T) {
+	rsaKey := newTestKey(t, "rsa", AlgorithmRS256)
+	issuer := NewKeySetIssuer(testIssuer)
+	issuer.SetKeys(rsaKey, nil)
+	claims := newTestClaims()
+	claims.Issuer = testIssuer
+
+	// The public key is known to everyone through the JWKS, an HMAC keyed with it must not pass
+	publicKey, err := x509.MarshalPKIXPublicKey(rsaKey.publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacKey := &Key{ID: "rsa", Algorithm: AlgorithmHS256, secret: publicKey}
+	token := forge(t, &header{Algorithm: AlgorithmHS256, Type: "JWT", KeyID: "rsa"}, claims, func(signingInput []byte) []byte {
+		signature, _ := hmacKey.sign(signingInput)
+		return signature
+	})
+	if _, err = issuer.Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestKeySetIssuerRejectsKeyConfusion(t *testing.T) {
+	rsaKey := newTestKey(t, "rsa", AlgorithmRS256)
+	edKey := newTestKey(t, "ed", AlgorithmEdDSA)
+	otherRSAKey := newTestKey(t, "rsa-2", AlgorithmRS256)
+	issuer := NewKeySetIssuer(testIssuer)
+	issuer.SetKeys(rsaKey, []*Key{edKey, otherRSAKey})
+	claims := newTestClaims()
+	claims.Issuer = testIssuer
+
+	tests := []struct {
+		name string
+		h    *header
+		key  *Key
+	}{
+		// The header names the algorithm of another live key
+		{"alg of another key", &header{Algorithm: AlgorithmEdDSA, Type: "JWT", KeyID: "rsa"}, edKey},
+		// The header names another key of the same algorithm as the one that signed
+		{"kid of another key", &header{Algorithm: AlgorithmRS256, Type: "JWT", KeyID: "rsa-2"}, rsaKey},
+		// Signed by the right key, but the header lies about the algorithm
+		{"rewritten alg", &header{Algorithm: AlgorithmHS256, Type: "JWT", KeyID: "rsa"}, rsaKey},
+	}
+	for _, tt := range tests {
+		token := forge(t, tt.h, claims, func(signingInput []byte) []byte {
+			signature, err := tt.key.sign(signingInput)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return signature
+		})
+		if _, err := issuer.Verify(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: Verify = %v, want ErrInvalidToken", tt.name, err)
+		}
+	}
+}
+
+func TestKeySetIssuerRejectsTamperedClaims(t *testing.T) {
+	issuer := NewKeySetIssuer(testIssuer)
+	issuer.SetKeys(newTestKey(t, "ed", AlgorithmEdDSA), nil)
+	token, err := issuer.Issue(newTestClaims())
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	claims := newTestClaims()
+	claims.Issuer, claims.UserID = testIssuer, 1
+	encodedClaims, err := encodeSegment(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	if _, err = issuer.Verify(parts[0] + "." + encodedClaims + "." + parts[2]); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestKeySetIssuerRejectsWrongIssuer(t *testing.T) {
+	key := newTestKey(t, "ed", AlgorithmEdDSA)
+	other := NewKeySetIssuer("https://evil.example")
+	other.SetKeys(key, nil)
+	token, err := other.Issue(newTestClaims())
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	issuer := NewKeySetIssuer(testIssuer)
+	issuer.SetKeys(key, nil)
+	if _, err = issuer.Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestKeySetIssuerRejectsExpiredToken(t *testing.T) {
+	issuer := NewKeySetIssuer(testIssuer)
+	issuer.SetKeys(newTestKey(t, "ed", AlgorithmEdDSA), nil)
+	claims := newTestClaims()
+	claims.ExpiresAt = time.Now().Unix()
+	token, err := issuer.Issue(claims)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, err = issuer.Verify(token); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("Verify = %v, want ErrExpiredToken", err)
+	}
+}
+
+func TestKeySetIssuerRejectsRetiredKey(t *testing.T) {
+	oldKey := newTestKey(t, "old", AlgorithmRS256)
+	newKey := newTestKey(t, "new", AlgorithmRS256)
+	issuer := NewKeySetIssuer(testIssuer)
+	issuer.SetKeys(oldKey, nil)
+	token, err := issuer.Issue(newTestClaims())
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	// Rotated but still live, tokens of the old key keep working
+	issuer.SetKeys(newKey, []*Key{oldKey})
+	if _, err = issuer.Verify(token); err != nil {
+		t.Fatalf("Verify after rotation: %v", err)
+	}
+
+	issuer.SetKeys(newKey, nil)
+	if _, err = issuer.Verify(token); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Verify after retirement = %v, want ErrUnknownKey", err)
+	}
+	if jwks := issuer.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != "new" {
+		t.Fatalf("JWKS after retirement = %+v, want only the new key", jwks.Keys)
+	}
+}
@@ -0,0 +1,88 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of RFC 6238 appendix B, "12345678901234567890" base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfcVectors are the SHA-1 test vectors of RFC 6238 appendix B. The RFC lists 8 digit codes, 6 digit
+// codes are their last 6 digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeMatchesRFC6238Vectors(t *testing.T) {
+	for _, vector := range rfcVectors {
+		code, err := Code(rfcSecret, Step(time.Unix(vector.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", vector.unix, err)
+		}
+		if code != vector.code {
+			t.Errorf("Code at %d = %s, want %s", vector.unix, code, vector.code)
+		}
+	}
+}
+
+func TestCodeAcceptsSecretsAsAppsShowThem(t *testing.T) {
+	want, _ := Code(rfcSecret, 1)
+	for _, secret := range []string{strings.ToLower(rfcSecret), rfcSecret + "===="} {
+		if code, err := Code(secret, 1); err != nil || code != want {
+			t.Errorf("Code(%q) = %s, %v, want %s", secret, code, err, want)
+		}
+	}
+	for _, secret := range []string{"", "not base32!"} {
+		if _, err := Code(secret, 1); err != ErrInvalidSecret {
+			t.Errorf("Code(%q) err = %v, want ErrInvalidSecret", secret, err)
+		}
+	}
+}
+
+func TestValidateRespectsSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	for delta := int64(-2); delta <= 2; delta++ {
+		code, err := Code(rfcSecret, current+delta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := Validate(rfcSecret, code, now, 1)
+		if inWindow := delta >= -1 && delta <= 1; ok != inWindow {
+			t.Errorf("code of step %+d accepted = %v, want %v", delta, ok, inWindow)
+			continue
+		}
+		if ok && step != current+delta {
+			t.Errorf("code of step %+d matched step %d, want %d", delta, step, current+delta)
+		}
+	}
+
+	// No skew only accepts the current step
+	previous, _ := Code(rfcSecret, current-1)
+	if _, ok := Validate(rfcSecret, previous, now, 0); ok {
+		t.Error("code of the previous step accepted without skew")
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	for _, code := range []string{"", "50471", "0050471", "05047a"} {
+		if _, ok := Validate(rfcSecret, code, now, 1); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+	if _, ok := Validate("", "050471", now, 1); ok {
+		t.Error("code accepted for an invalid secret")
+	}
+}